@@ -0,0 +1,321 @@
+// Package album stores named, ordered collections of images. Albums refer
+// to images by filename and are kept in memory, with every change written
+// through to a bbolt database like the image catalog.
+package album
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// albumsBucket is the bbolt bucket holding one JSON document per album
+var albumsBucket = []byte("albums")
+
+// Album visibilities
+const (
+	VisibilityPublic  = "public"  // listed and readable by everyone
+	VisibilityPrivate = "private" // only readable by its owner and admins
+)
+
+// ErrNotFound is returned when an album does not exist
+var ErrNotFound = errors.New("album: not found")
+
+// Album is a named collection of images in a manual order
+type Album struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Cover is the filename of the cover image, empty to use the first image
+	Cover      string    `json:"cover,omitempty"`
+	Visibility string    `json:"visibility"`
+	Owner      string    `json:"owner,omitempty"`
+	Images     []string  `json:"images"` // filenames in display order
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// IsPublic reports whether everyone may see the album
+func (a *Album) IsPublic() bool {
+	return a.Visibility != VisibilityPrivate
+}
+
+// Contains reports whether filename is part of the album
+func (a *Album) Contains(filename string) bool {
+	return slices.Contains(a.Images, filename)
+}
+
+// clone returns a copy that does not share the image list
+func (a *Album) clone() Album {
+	c := *a
+	c.Images = slices.Clone(a.Images)
+	return c
+}
+
+// Store keeps all albums in memory and persists them to a bbolt database
+type Store struct {
+	write  sync.Mutex // serializes modifications, see Update
+	mu     sync.RWMutex
+	db     *bolt.DB // nil when albums are not persisted
+	albums map[string]*Album
+}
+
+// Open loads the albums from db. A nil db gives an in-memory store.
+func Open(db *bolt.DB) (*Store, error) {
+	s := &Store{
+		db:     db,
+		albums: make(map[string]*Album),
+	}
+
+	if db == nil {
+		return s, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(albumsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var a Album
+			if err := json.Unmarshal(v, &a); err != nil {
+				return nil // skip corrupt entries
+			}
+			s.albums[a.ID] = &a
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns a copy of the album with the given ID
+func (s *Store) Get(id string) (Album, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.albums[id]
+	if !ok {
+		return Album{}, false
+	}
+	return a.clone(), true
+}
+
+// All returns copies of all albums sorted by name, then ID
+func (s *Store) All() []Album {
+	s.mu.RLock()
+	result := make([]Album, 0, len(s.albums))
+	for _, a := range s.albums {
+		result = append(result, a.clone())
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		ni, nj := strings.ToLower(result[i].Name), strings.ToLower(result[j].Name)
+		if ni != nj {
+			return ni < nj
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// Create stores a new album, assigning its ID and timestamps
+func (s *Store) Create(a Album) (Album, error) {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	id, err := newID()
+	if err != nil {
+		return Album{}, err
+	}
+	a.ID = id
+	a.CreatedAt = time.Now().UTC()
+	a.UpdatedAt = a.CreatedAt
+	if a.Images == nil {
+		a.Images = []string{}
+	}
+
+	if err := s.persist(a.ID, &a); err != nil {
+		return Album{}, err
+	}
+	s.mu.Lock()
+	s.albums[a.ID] = &a
+	s.mu.Unlock()
+	return a.clone(), nil
+}
+
+// Update applies fn to a copy of the album and stores the result unless fn
+// fails. Modifications are serialized, so concurrent read-modify-write
+// cycles do not lose changes.
+func (s *Store) Update(id string, fn func(a *Album) error) (Album, error) {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	a, ok := s.Get(id)
+	if !ok {
+		return Album{}, ErrNotFound
+	}
+	if err := fn(&a); err != nil {
+		return Album{}, err
+	}
+	a.UpdatedAt = time.Now().UTC()
+
+	if err := s.persist(id, &a); err != nil {
+		return Album{}, err
+	}
+	s.mu.Lock()
+	s.albums[id] = &a
+	s.mu.Unlock()
+	return a.clone(), nil
+}
+
+// UpdateAll applies fn to a copy of every album and stores, in a single
+// transaction, those for which fn returns true. It returns how many
+// albums changed.
+func (s *Store) UpdateAll(fn func(a *Album) bool) (int, error) {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	var changed []*Album
+	for _, a := range s.All() {
+		a := a
+		if fn(&a) {
+			a.UpdatedAt = time.Now().UTC()
+			changed = append(changed, &a)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+
+	if s.db != nil {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(albumsBucket)
+			if err != nil {
+				return err
+			}
+			for _, a := range changed {
+				data, err := json.Marshal(a)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(a.ID), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	for _, a := range changed {
+		s.albums[a.ID] = a
+	}
+	s.mu.Unlock()
+	return len(changed), nil
+}
+
+// Delete removes an album
+func (s *Store) Delete(id string) error {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	if _, ok := s.Get(id); !ok {
+		return ErrNotFound
+	}
+	if err := s.persist(id, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.albums, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// RemoveImage drops filename from every album, clearing it as a cover.
+// It returns how many albums changed.
+func (s *Store) RemoveImage(filename string) (int, error) {
+	return s.UpdateAll(func(a *Album) bool {
+		if !a.Contains(filename) && a.Cover != filename {
+			return false
+		}
+		a.Images = slices.DeleteFunc(a.Images, func(name string) bool { return name == filename })
+		if a.Cover == filename {
+			a.Cover = ""
+		}
+		return true
+	})
+}
+
+// RenameImage replaces filename from with to in every album, keeping the
+// position of the image. It returns how many albums changed.
+func (s *Store) RenameImage(from, to string) (int, error) {
+	return s.UpdateAll(func(a *Album) bool {
+		if !a.Contains(from) && a.Cover != from {
+			return false
+		}
+		images := make([]string, 0, len(a.Images))
+		for _, name := range a.Images {
+			if name == from {
+				name = to
+			}
+			if !slices.Contains(images, name) {
+				images = append(images, name)
+			}
+		}
+		a.Images = images
+		if a.Cover == from {
+			a.Cover = to
+		}
+		return true
+	})
+}
+
+// persist writes a (or deletes the key when a is nil) to the database
+func (s *Store) persist(id string, a *Album) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(albumsBucket)
+		if err != nil {
+			return err
+		}
+		if a == nil {
+			return bucket.Delete([]byte(id))
+		}
+
+		data, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// newID generates a random album ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -3,9 +3,9 @@ package app
 import (
 	"github.com/gantoho/go-img-sys/internal/config"
 	"github.com/gantoho/go-img-sys/internal/router"
+	"github.com/gantoho/go-img-sys/internal/service"
 	"github.com/gantoho/go-img-sys/pkg/auth"
 	"github.com/gantoho/go-img-sys/pkg/logger"
-	"github.com/gantoho/go-img-sys/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -28,11 +28,32 @@ func New() *Server {
 
 // Start initializes and starts the server
 func (s *Server) Start() {
-	// Ensure upload directory exists
-	if err := utils.EnsureDir(s.config.File.UploadDir); err != nil {
-		s.logger.Fatal("Failed to create upload directory: %v", err)
+	// Open the database first, the deduplicating storage keeps its index there
+	cat, err := service.InitDatabase(s.config)
+	if err != nil {
+		s.logger.Fatal("Failed to open database: %v", err)
 	}
 
+	// Initialize storage backend (creates the upload directory for local storage)
+	if _, err := service.InitStorage(s.config); err != nil {
+		s.logger.Fatal("Failed to initialize storage: %v", err)
+	}
+
+	// Bring the image catalog in sync with the storage
+	s.logger.Info("Image catalog loaded: %d images", cat.Len())
+	go s.reconcileCatalog()
+
+	// Start the background job workers, resuming jobs interrupted by the last shutdown
+	if _, err := service.InitJobs(s.config); err != nil {
+		s.logger.Fatal("Failed to start job manager: %v", err)
+	}
+
+	// Purge images kept in the trash longer than the retention period
+	service.NewTrashService().StartAutoPurge()
+
+	// Discard resumable uploads that were abandoned
+	service.NewUploadService().StartAutoExpire()
+
 	// Initialize API key manager with default keys
 	keyManager := auth.GetManager()
 	keyManager.InitDefaultKeys()
@@ -46,7 +67,7 @@ func (s *Server) Start() {
 
 	// Print startup info
 	s.logger.Info("Starting Image Server on %s", s.config.Server.Port)
-	s.logger.Info("Upload directory: %s", s.config.File.UploadDir)
+	s.logger.Info("Storage backend: %s, upload directory: %s", s.config.File.Storage, s.config.File.UploadDir)
 
 	// Start server
 	addr := s.config.Server.Port
@@ -55,8 +76,28 @@ func (s *Server) Start() {
 	}
 }
 
+// reconcileCatalog runs the startup reconciliation pass between the
+// catalog and the storage content
+func (s *Server) reconcileCatalog() {
+	result, err := service.ReconcileCatalog()
+	if err != nil {
+		s.logger.Error("Catalog reconciliation failed: %v", err)
+		return
+	}
+
+	s.logger.Info("Catalog reconciled: %d scanned, %d added, %d updated, %d removed",
+		result.Scanned, result.Added, result.Updated, result.Removed)
+	for _, msg := range result.Errors {
+		s.logger.Warn("Catalog reconciliation: %s", msg)
+	}
+}
+
 // Close gracefully closes the server
 func (s *Server) Close() {
 	s.logger.Info("Shutting down server...")
+	service.StopJobs()
+	if err := service.CloseDatabase(); err != nil {
+		s.logger.Error("Failed to close database: %v", err)
+	}
 	defer s.logger.Close()
 }
@@ -0,0 +1,328 @@
+// Package blobs stores content addressed by its SHA-256, so identical
+// images saved under different names share one copy. An index maps every
+// object name to the blob holding its content and counts the references of
+// each blob; like the image catalog it is kept in memory, with every change
+// written through to a bbolt database.
+package blobs
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// refsBucket is the bbolt bucket holding one JSON document per object name
+var refsBucket = []byte("blobs")
+
+// Ref points an object name at the blob holding its content
+type Ref struct {
+	Blob    string    `json:"blob"` // hex encoded SHA-256 of the content
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Entry is an object name with its ref
+type Entry struct {
+	Name string
+	Ref
+}
+
+// Usage compares the size of all objects with the size actually stored
+type Usage struct {
+	Objects      int   // object names
+	Blobs        int   // distinct contents
+	LogicalSize  int64 // total size of all objects
+	PhysicalSize int64 // total size of all blobs
+}
+
+// Index maps object names to blobs and counts the references of each blob
+type Index struct {
+	mu     sync.RWMutex
+	db     *bolt.DB // nil when the index is not persisted
+	refs   map[string]Ref
+	names  []string       // names of refs, sorted for prefix lookups
+	counts map[string]int // blob -> number of names referring to it
+}
+
+// OpenIndex loads the index from db. A nil db gives an in-memory index.
+func OpenIndex(db *bolt.DB) (*Index, error) {
+	x := &Index{
+		db:     db,
+		refs:   make(map[string]Ref),
+		counts: make(map[string]int),
+	}
+
+	if db == nil {
+		return x, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(refsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var ref Ref
+			if err := json.Unmarshal(v, &ref); err != nil {
+				return nil // skip corrupt entries
+			}
+			x.refs[string(k)] = ref
+			x.names = append(x.names, string(k))
+			x.counts[ref.Blob]++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// bbolt iterates keys in byte order, which is the order of names
+	return x, nil
+}
+
+// Get returns the ref of name
+func (x *Index) Get(name string) (Ref, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	ref, ok := x.refs[name]
+	return ref, ok
+}
+
+// Count returns how many names refer to blob
+func (x *Index) Count(blob string) int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.counts[blob]
+}
+
+// IsDir reports whether any name lies below dir
+func (x *Index) IsDir(dir string) bool {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return dir != "" && len(x.below(dir)) > 0
+}
+
+// List returns the names below dir sorted by name, or all names when dir
+// is empty
+func (x *Index) List(dir string) []Entry {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	names := x.below(dir)
+	result := make([]Entry, 0, len(names))
+	for _, name := range names {
+		result = append(result, Entry{Name: name, Ref: x.refs[name]})
+	}
+	return result
+}
+
+// Children returns the names directly below dir and the directories
+// directly below it, both sorted by name. The names inside each
+// subdirectory are skipped, not visited.
+func (x *Index) Children(dir string) ([]Entry, []string) {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	names := x.below(dir)
+	entries := make([]Entry, 0)
+	var dirs []string
+	for i := 0; i < len(names); {
+		name := names[i]
+		idx := strings.Index(name[len(prefix):], "/")
+		if idx < 0 {
+			entries = append(entries, Entry{Name: name, Ref: x.refs[name]})
+			i++
+			continue
+		}
+
+		sub := name[:len(prefix)+idx]
+		dirs = append(dirs, sub)
+		end, _ := slices.BinarySearch(names[i:], sub+dirEnd)
+		i += end
+	}
+
+	// "a-b/c" sorts before "a/c", so directories come in the order of the
+	// names below them rather than their own
+	slices.Sort(dirs)
+	return entries, dirs
+}
+
+// Len returns the number of names
+func (x *Index) Len() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.refs)
+}
+
+// Usage returns the logical and physical size of the indexed content
+func (x *Index) Usage() Usage {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	usage := Usage{Objects: len(x.refs), Blobs: len(x.counts)}
+	seen := make(map[string]bool, len(x.counts))
+	for _, ref := range x.refs {
+		usage.LogicalSize += ref.Size
+		if !seen[ref.Blob] {
+			seen[ref.Blob] = true
+			usage.PhysicalSize += ref.Size
+		}
+	}
+	return usage
+}
+
+// Set points name at ref. It returns the ref name had before, if any.
+func (x *Index) Set(name string, ref Ref) (Ref, bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	err := x.update(func(bucket *bolt.Bucket) error {
+		return putRef(bucket, name, ref)
+	})
+	if err != nil {
+		return Ref{}, false, err
+	}
+
+	old, replaced := x.refs[name]
+	if replaced {
+		x.release(old.Blob)
+	} else {
+		x.insertName(name)
+	}
+	x.refs[name] = ref
+	x.counts[ref.Blob]++
+	return old, replaced, nil
+}
+
+// Delete removes name and returns the ref it had
+func (x *Index) Delete(name string) (Ref, bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	ref, ok := x.refs[name]
+	if !ok {
+		return Ref{}, false, nil
+	}
+
+	err := x.update(func(bucket *bolt.Bucket) error {
+		return bucket.Delete([]byte(name))
+	})
+	if err != nil {
+		return Ref{}, false, err
+	}
+
+	delete(x.refs, name)
+	x.removeName(name)
+	x.release(ref.Blob)
+	return ref, true, nil
+}
+
+// Rename moves the ref of from to to. It returns the ref to had before, if
+// any, and storage.ErrNotExist when from does not exist.
+func (x *Index) Rename(from, to string) (Ref, bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	ref, ok := x.refs[from]
+	if !ok {
+		return Ref{}, false, storage.ErrNotExist
+	}
+	if from == to {
+		return Ref{}, false, nil
+	}
+
+	err := x.update(func(bucket *bolt.Bucket) error {
+		if err := bucket.Delete([]byte(from)); err != nil {
+			return err
+		}
+		return putRef(bucket, to, ref)
+	})
+	if err != nil {
+		return Ref{}, false, err
+	}
+
+	old, replaced := x.refs[to]
+	if replaced {
+		x.release(old.Blob)
+	} else {
+		x.insertName(to)
+	}
+	delete(x.refs, from)
+	x.removeName(from)
+	x.refs[to] = ref
+	return old, replaced, nil
+}
+
+// dirEnd is the character following "/", so dir+dirEnd sorts after every
+// name below dir
+const dirEnd = "0"
+
+// below returns the sorted names below dir, or all names when dir is
+// empty; the caller holds x.mu
+func (x *Index) below(dir string) []string {
+	if dir == "" {
+		return x.names
+	}
+	start, _ := slices.BinarySearch(x.names, dir+"/")
+	end, _ := slices.BinarySearch(x.names, dir+dirEnd)
+	return x.names[start:end]
+}
+
+// insertName adds name to the sorted names, the caller holds x.mu
+func (x *Index) insertName(name string) {
+	if i, found := slices.BinarySearch(x.names, name); !found {
+		x.names = slices.Insert(x.names, i, name)
+	}
+}
+
+// removeName drops name from the sorted names, the caller holds x.mu
+func (x *Index) removeName(name string) {
+	if i, found := slices.BinarySearch(x.names, name); found {
+		x.names = slices.Delete(x.names, i, i+1)
+	}
+}
+
+// release drops one reference of blob, the caller holds x.mu
+func (x *Index) release(blob string) {
+	if x.counts[blob] <= 1 {
+		delete(x.counts, blob)
+		return
+	}
+	x.counts[blob]--
+}
+
+// update runs fn in a write transaction on the refs bucket
+func (x *Index) update(fn func(bucket *bolt.Bucket) error) error {
+	if x.db == nil {
+		return nil
+	}
+
+	return x.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(refsBucket)
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+}
+
+// putRef writes the ref of name to bucket
+func putRef(bucket *bolt.Bucket, name string, ref Ref) error {
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(name), data)
+}
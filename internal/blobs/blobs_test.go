@@ -0,0 +1,97 @@
+package blobs
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestIndexPrefixLookups(t *testing.T) {
+	db, err := bolt.Open(filepath.Join(t.TempDir(), "index.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("opening database: %v", err)
+	}
+	defer db.Close()
+
+	x, err := OpenIndex(db)
+	if err != nil {
+		t.Fatalf("OpenIndex: %v", err)
+	}
+	// Siblings sorting right before and after "a/" must not count as below a
+	for _, name := range []string{"a/z.jpg", "a.jpg", "a-b/c.jpg", "a/b/c.jpg", "a0.jpg", "a/b/d/e.jpg", "a/c.jpg", "b.jpg", "a/b.jpg"} {
+		if _, _, err := x.Set(name, Ref{Blob: "blob"}); err != nil {
+			t.Fatalf("Set(%q): %v", name, err)
+		}
+	}
+	if _, _, err := x.Rename("a/z.jpg", "a/y/z.jpg"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if _, _, err := x.Delete("a/c.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	check := func(t *testing.T, x *Index) {
+		tests := []struct {
+			dir      string
+			isDir    bool
+			list     string
+			children string
+			subdirs  string
+		}{
+			{
+				dir:      "",
+				list:     "a-b/c.jpg a.jpg a/b.jpg a/b/c.jpg a/b/d/e.jpg a/y/z.jpg a0.jpg b.jpg",
+				children: "a.jpg a0.jpg b.jpg",
+				subdirs:  "a a-b",
+			},
+			{
+				dir:      "a",
+				isDir:    true,
+				list:     "a/b.jpg a/b/c.jpg a/b/d/e.jpg a/y/z.jpg",
+				children: "a/b.jpg",
+				subdirs:  "a/b a/y",
+			},
+			{dir: "a/b", isDir: true, list: "a/b/c.jpg a/b/d/e.jpg", children: "a/b/c.jpg", subdirs: "a/b/d"},
+			{dir: "a-b", isDir: true, list: "a-b/c.jpg", children: "a-b/c.jpg"},
+			{dir: "a/c.jpg"},
+			{dir: "a.jpg"},
+			{dir: "b"},
+		}
+
+		for _, tt := range tests {
+			if got := x.IsDir(tt.dir); got != tt.isDir {
+				t.Errorf("IsDir(%q) = %v, want %v", tt.dir, got, tt.isDir)
+			}
+			if got := entryNames(x.List(tt.dir)); got != tt.list {
+				t.Errorf("List(%q) = %s, want %s", tt.dir, got, tt.list)
+			}
+			entries, dirs := x.Children(tt.dir)
+			if got := entryNames(entries); got != tt.children {
+				t.Errorf("Children(%q) names = %s, want %s", tt.dir, got, tt.children)
+			}
+			if got := strings.Join(dirs, " "); got != tt.subdirs {
+				t.Errorf("Children(%q) dirs = %s, want %s", tt.dir, got, tt.subdirs)
+			}
+		}
+	}
+
+	t.Run("InMemory", func(t *testing.T) { check(t, x) })
+	t.Run("Reopened", func(t *testing.T) {
+		reopened, err := OpenIndex(db)
+		if err != nil {
+			t.Fatalf("OpenIndex: %v", err)
+		}
+		check(t, reopened)
+	})
+}
+
+// entryNames joins the names of entries
+func entryNames(entries []Entry) string {
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name)
+	}
+	return strings.Join(names, " ")
+}
@@ -0,0 +1,427 @@
+package blobs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+const (
+	// blobsDir is the area of the underlying storage holding the blobs,
+	// stored as .blobs/<first two hex digits>/<sha256>
+	blobsDir = ".blobs"
+	// incomingDir holds content being written until its hash is known
+	incomingDir = blobsDir + "/incoming"
+	// emptyBlob is the SHA-256 of no content, shared by all reservations
+	emptyBlob = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// Storage is a storage.Storage keeping the content of every object in a
+// blob of the underlying storage. Objects with identical content share one
+// blob, which is removed when the last object referring to it goes away.
+// Names are resolved through the index only; the blob area itself is not
+// accessible through Storage.
+type Storage struct {
+	inner storage.Storage
+	index *Index
+	mu    sync.Mutex // serializes reference changes with blob creation and removal
+}
+
+// New returns a deduplicating storage keeping its blobs in inner
+func New(inner storage.Storage, index *Index) *Storage {
+	return &Storage{inner: inner, index: index}
+}
+
+// Usage returns the logical and physical size of the stored objects
+func (s *Storage) Usage() Usage {
+	return s.index.Usage()
+}
+
+// Put stores r in a staging object while hashing it, then either moves it
+// into place as a new blob or drops it when the blob already exists. The
+// returned FileInfo reports which of the two happened.
+func (s *Storage) Put(name string, r io.Reader) (*storage.FileInfo, error) {
+	name, err := s.cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	staged, err := stagingName()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.New()
+	info, err := s.inner.Put(staged, io.TeeReader(r, hash))
+	if err != nil {
+		_ = s.inner.Delete(staged)
+		return nil, err
+	}
+
+	ref := Ref{Blob: hex.EncodeToString(hash.Sum(nil)), Size: info.Size, ModTime: info.ModTime}
+	deduplicated, err := s.link(name, ref, staged)
+	if err != nil {
+		_ = s.inner.Delete(staged)
+		return nil, err
+	}
+
+	return &storage.FileInfo{
+		Name:         name,
+		Size:         ref.Size,
+		ModTime:      ref.ModTime,
+		Deduplicated: deduplicated,
+	}, nil
+}
+
+// Get returns a stream over the blob of name
+func (s *Storage) Get(name string) (io.ReadCloser, error) {
+	return s.Open(name)
+}
+
+// Open returns a seekable reader over the blob of name
+func (s *Storage) Open(name string) (io.ReadSeekCloser, error) {
+	ref, err := s.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.inner.Open(blobName(ref.Blob))
+}
+
+// Stat returns information about name from the index. Prefixes of stored
+// objects are reported as directories.
+func (s *Storage) Stat(name string) (*storage.FileInfo, error) {
+	name, err := s.cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref, ok := s.index.Get(name); ok {
+		return &storage.FileInfo{Name: name, Size: ref.Size, ModTime: ref.ModTime}, nil
+	}
+	if s.index.IsDir(name) {
+		return &storage.FileInfo{Name: name, IsDir: true}, nil
+	}
+	return nil, storage.ErrNotExist
+}
+
+// List returns the entries below prefix sorted by name. Directories only
+// exist as prefixes of stored objects.
+func (s *Storage) List(prefix string, recursive bool) ([]storage.FileInfo, error) {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "\\", "/"), "/")
+	if prefix == "." {
+		prefix = ""
+	}
+	if prefix != "" {
+		var err error
+		if prefix, err = s.cleanName(prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]storage.FileInfo, 0)
+	var entries []Entry
+	if recursive {
+		entries = s.index.List(prefix)
+	} else {
+		var dirs []string
+		entries, dirs = s.index.Children(prefix)
+		for _, dir := range dirs {
+			result = append(result, storage.FileInfo{Name: dir, IsDir: true})
+		}
+	}
+	for _, e := range entries {
+		result = append(result, storage.FileInfo{Name: e.Name, Size: e.Size, ModTime: e.ModTime})
+	}
+
+	if len(result) == 0 && prefix != "" {
+		return nil, storage.ErrNotExist
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Delete removes name, and its blob when no other object refers to it
+func (s *Storage) Delete(name string) error {
+	name, err := s.cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ref, ok, err := s.index.Delete(name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return storage.ErrNotExist
+	}
+	return s.release(ref.Blob)
+}
+
+// Rename points to at the blob of from. Only the index changes; the blob
+// of an object replaced at to is removed when no longer referenced.
+func (s *Storage) Rename(from, to string) error {
+	from, err := s.cleanName(from)
+	if err != nil {
+		return err
+	}
+	to, err = s.cleanName(to)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, replaced, err := s.index.Rename(from, to)
+	if err != nil {
+		return err
+	}
+	if replaced {
+		return s.release(old.Blob)
+	}
+	return nil
+}
+
+// Reserve points name at the empty blob unless name or a directory with
+// that name exists
+func (s *Storage) Reserve(name string) error {
+	name, err := s.cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.index.Get(name); ok || s.index.IsDir(name) {
+		return storage.ErrExist
+	}
+
+	object := blobName(emptyBlob)
+	if _, err := s.inner.Stat(object); err != nil {
+		if _, err := s.inner.Put(object, bytes.NewReader(nil)); err != nil {
+			return err
+		}
+	}
+	_, _, err = s.index.Set(name, Ref{Blob: emptyBlob, ModTime: time.Now()})
+	return err
+}
+
+// Import moves objects of the underlying storage that are not blobs yet,
+// e.g. written by a run without deduplication, into blobs and removes
+// leftovers of interrupted uploads. It returns how many objects moved.
+func (s *Storage) Import() (int, error) {
+	objects, err := s.inner.List("", true)
+	if err != nil {
+		return 0, err
+	}
+
+	imported := 0
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Name, incomingDir+"/") {
+			_ = s.inner.Delete(obj.Name)
+			continue
+		}
+		if obj.Name == blobsDir || strings.HasPrefix(obj.Name, blobsDir+"/") {
+			continue
+		}
+
+		blob, err := s.hash(obj.Name)
+		if err != nil {
+			return imported, err
+		}
+		ref := Ref{Blob: blob, Size: obj.Size, ModTime: obj.ModTime}
+		if _, err := s.link(obj.Name, ref, obj.Name); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		s.removeEmptyDirs("")
+	}
+	return imported, nil
+}
+
+// Export writes every object of index back to inner under its own name and
+// removes the blobs, undoing deduplication. Objects whose blob is missing
+// are dropped from the index. It returns how many objects were written.
+func Export(inner storage.Storage, index *Index) (int, error) {
+	if index.Len() == 0 {
+		return 0, nil
+	}
+
+	exported := 0
+	for _, e := range index.List("") {
+		object := blobName(e.Blob)
+
+		r, err := inner.Get(object)
+		if err != nil && !storage.IsNotExist(err) {
+			return exported, err
+		}
+		if err == nil {
+			_, err = inner.Put(e.Name, r)
+			r.Close()
+			if err != nil {
+				return exported, err
+			}
+			exported++
+		}
+
+		if _, _, err := index.Delete(e.Name); err != nil {
+			return exported, err
+		}
+		if index.Count(e.Blob) == 0 {
+			if err := inner.Delete(object); err != nil && !storage.IsNotExist(err) {
+				return exported, err
+			}
+		}
+	}
+
+	s := New(inner, index)
+	if s.removeEmptyDirs(blobsDir) {
+		_ = inner.Delete(blobsDir)
+	}
+	return exported, nil
+}
+
+// link points name at ref. When the blob does not exist yet, the content
+// at staged becomes the blob; otherwise staged is deleted. It reports
+// whether the blob already existed.
+func (s *Storage) link(name string, ref Ref, staged string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	object := blobName(ref.Blob)
+	exists := false
+	if s.index.Count(ref.Blob) > 0 {
+		_, err := s.inner.Stat(object)
+		exists = err == nil
+	}
+	if !exists {
+		if err := s.inner.Rename(staged, object); err != nil {
+			return false, err
+		}
+	}
+
+	old, replaced, err := s.index.Set(name, ref)
+	if err != nil {
+		if !exists {
+			// Nothing refers to the new blob, hand the content back
+			_ = s.inner.Rename(object, staged)
+		}
+		return false, err
+	}
+
+	if exists {
+		_ = s.inner.Delete(staged)
+	}
+	if replaced {
+		if err := s.release(old.Blob); err != nil {
+			return false, err
+		}
+	}
+	return exists, nil
+}
+
+// release removes blob once nothing refers to it, the caller holds s.mu
+func (s *Storage) release(blob string) error {
+	if s.index.Count(blob) > 0 {
+		return nil
+	}
+	object := blobName(blob)
+	if err := s.inner.Delete(object); err != nil && !storage.IsNotExist(err) {
+		return err
+	}
+	// Remove the shard directory once empty (only the local storage has directories)
+	_ = s.inner.Delete(path.Dir(object))
+	return nil
+}
+
+// lookup returns the ref of name
+func (s *Storage) lookup(name string) (Ref, error) {
+	name, err := s.cleanName(name)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	ref, ok := s.index.Get(name)
+	if !ok {
+		return Ref{}, storage.ErrNotExist
+	}
+	return ref, nil
+}
+
+// hash returns the hex encoded SHA-256 of an object of the underlying storage
+func (s *Storage) hash(name string) (string, error) {
+	r, err := s.inner.Get(name)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// removeEmptyDirs removes the directories below dir left empty by Import
+// or Export, reporting whether dir is empty. Only the local storage has
+// directories.
+func (s *Storage) removeEmptyDirs(dir string) bool {
+	entries, err := s.inner.List(dir, false)
+	if err != nil {
+		return false
+	}
+
+	remaining := len(entries)
+	for _, entry := range entries {
+		if !entry.IsDir || entry.Name == blobsDir {
+			continue
+		}
+		if s.removeEmptyDirs(entry.Name) && s.inner.Delete(entry.Name) == nil {
+			remaining--
+		}
+	}
+	return remaining == 0
+}
+
+// cleanName normalizes an object name and rejects names in the blob area
+func (s *Storage) cleanName(name string) (string, error) {
+	name, err := storage.CleanName(name)
+	if err != nil {
+		return "", err
+	}
+	if name == blobsDir || strings.HasPrefix(name, blobsDir+"/") {
+		return "", storage.ErrInvalidName
+	}
+	return name, nil
+}
+
+// blobName returns the name of a blob in the underlying storage
+func blobName(blob string) string {
+	return blobsDir + "/" + blob[:2] + "/" + blob
+}
+
+// stagingName returns a unique name for content being written
+func stagingName() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return incomingDir + "/" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,209 @@
+package blobs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+func TestStorageRefcount(t *testing.T) {
+	inner := storage.NewMemoryStorage()
+	index, _ := OpenIndex(nil)
+	s := New(inner, index)
+
+	info := put(t, s, "a.jpg", "same")
+	if info.Deduplicated || info.Size != 4 {
+		t.Errorf("first Put = %+v", info)
+	}
+	if info := put(t, s, "dir/b.jpg", "same"); !info.Deduplicated {
+		t.Errorf("Put of identical content was not deduplicated")
+	}
+	put(t, s, "c.jpg", "other")
+	checkBlobs(t, inner, 2)
+	if usage := s.Usage(); usage != (Usage{Objects: 3, Blobs: 2, LogicalSize: 13, PhysicalSize: 9}) {
+		t.Errorf("Usage = %+v", usage)
+	}
+
+	// The shared blob stays while any name refers to it
+	if err := s.Delete("a.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	checkBlobs(t, inner, 2)
+	if got := get(t, s, "dir/b.jpg"); got != "same" {
+		t.Errorf("content after deleting the other name = %q", got)
+	}
+
+	// Replacing content releases the old blob
+	put(t, s, "dir/b.jpg", "new")
+	checkBlobs(t, inner, 2)
+	if err := s.Rename("dir/b.jpg", "c.jpg"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	checkBlobs(t, inner, 1)
+	if got := get(t, s, "c.jpg"); got != "new" {
+		t.Errorf("content after Rename over c.jpg = %q", got)
+	}
+
+	if err := s.Delete("c.jpg"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	checkBlobs(t, inner, 0)
+	if index.Len() != 0 {
+		t.Errorf("index keeps %d names", index.Len())
+	}
+}
+
+func TestStorageReserve(t *testing.T) {
+	inner := storage.NewMemoryStorage()
+	index, _ := OpenIndex(nil)
+	s := New(inner, index)
+	put(t, s, "dir/a.jpg", "a")
+
+	for _, name := range []string{"dir/a.jpg", "dir"} {
+		if err := s.Reserve(name); !storage.IsExist(err) {
+			t.Errorf("Reserve(%q): %v, want ErrExist", name, err)
+		}
+	}
+
+	if err := s.Reserve("b.jpg"); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := s.Reserve("b.jpg"); !storage.IsExist(err) {
+		t.Errorf("second Reserve: %v, want ErrExist", err)
+	}
+	if info, err := s.Stat("b.jpg"); err != nil || info.Size != 0 {
+		t.Errorf("Stat of reservation = %+v, %v", info, err)
+	}
+	put(t, s, "b.jpg", "b")
+	if got := get(t, s, "b.jpg"); got != "b" {
+		t.Errorf("content after Put over reservation = %q", got)
+	}
+	// Only the real content is left once the reservation is replaced
+	checkBlobs(t, inner, 2)
+}
+
+func TestStorageHidesBlobs(t *testing.T) {
+	index, _ := OpenIndex(nil)
+	s := New(storage.NewMemoryStorage(), index)
+	put(t, s, "a.jpg", "a")
+
+	for _, name := range []string{".blobs", ".blobs/incoming/x", blobName(emptyBlob)} {
+		if _, err := s.Get(name); err != storage.ErrInvalidName {
+			t.Errorf("Get(%q): %v, want ErrInvalidName", name, err)
+		}
+		if _, err := s.Put(name, strings.NewReader("x")); err != storage.ErrInvalidName {
+			t.Errorf("Put(%q): %v, want ErrInvalidName", name, err)
+		}
+	}
+
+	entries, err := s.List("", true)
+	if err != nil || len(entries) != 1 || entries[0].Name != "a.jpg" {
+		t.Errorf("List = %+v, %v; want only a.jpg", entries, err)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	dir := t.TempDir()
+	inner, err := storage.NewLocalStorage(dir)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	for name, content := range map[string]string{
+		"a.jpg":                 "same",
+		"x/y/b.jpg":             "same",
+		"c.jpg":                 "other",
+		incomingDir + "/stale0": "interrupted upload",
+	} {
+		if _, err := inner.Put(name, strings.NewReader(content)); err != nil {
+			t.Fatalf("Put(%q): %v", name, err)
+		}
+	}
+
+	index, _ := OpenIndex(nil)
+	s := New(inner, index)
+	imported, err := s.Import()
+	if err != nil || imported != 3 {
+		t.Fatalf("Import = %d, %v; want 3", imported, err)
+	}
+	checkBlobs(t, inner, 2)
+	if _, err := os.Stat(filepath.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Errorf("emptied directory x left behind: %v", err)
+	}
+	if _, err := inner.Stat(incomingDir + "/stale0"); !storage.IsNotExist(err) {
+		t.Errorf("interrupted upload left behind: %v", err)
+	}
+	if got := get(t, s, "x/y/b.jpg"); got != "same" {
+		t.Errorf("imported content = %q", got)
+	}
+
+	// Importing again finds nothing new
+	if imported, err := s.Import(); err != nil || imported != 0 {
+		t.Errorf("second Import = %d, %v; want 0", imported, err)
+	}
+
+	exported, err := Export(inner, index)
+	if err != nil || exported != 3 {
+		t.Fatalf("Export = %d, %v; want 3", exported, err)
+	}
+	if index.Len() != 0 {
+		t.Errorf("index keeps %d names after Export", index.Len())
+	}
+	for name, want := range map[string]string{"a.jpg": "same", "x/y/b.jpg": "same", "c.jpg": "other"} {
+		if got := get(t, inner, name); got != want {
+			t.Errorf("exported %s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, blobsDir)); !os.IsNotExist(err) {
+		t.Errorf("blob area left behind after Export: %v", err)
+	}
+}
+
+// put stores content under name or fails the test
+func put(t *testing.T, s storage.Storage, name, content string) *storage.FileInfo {
+	t.Helper()
+	info, err := s.Put(name, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Put(%q): %v", name, err)
+	}
+	return info
+}
+
+// get returns the content of name or fails the test
+func get(t *testing.T, s storage.Storage, name string) string {
+	t.Helper()
+	r, err := s.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", name, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %q: %v", name, err)
+	}
+	return string(data)
+}
+
+// checkBlobs fails the test unless inner holds want blobs besides the
+// empty one shared by reservations
+func checkBlobs(t *testing.T, inner storage.Storage, want int) {
+	t.Helper()
+	entries, err := inner.List(blobsDir, true)
+	if err != nil && !storage.IsNotExist(err) {
+		t.Fatalf("listing blobs: %v", err)
+	}
+
+	n := 0
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name, incomingDir+"/") && !strings.HasSuffix(e.Name, emptyBlob) {
+			n++
+		}
+	}
+	if n != want {
+		t.Errorf("%d blobs stored, want %d", n, want)
+	}
+}
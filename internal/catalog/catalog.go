@@ -0,0 +1,469 @@
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+	bolt "go.etcd.io/bbolt"
+)
+
+// imagesBucket is the bbolt bucket holding one JSON record per image
+var imagesBucket = []byte("images")
+
+// Record is the catalog entry of a stored image
+type Record struct {
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mime_type"`
+	Width      int       `json:"width"`
+	Height     int       `json:"height"`
+	Checksum   string    `json:"checksum"` // hex encoded SHA-256 of the content
+	ModTime    time.Time `json:"mod_time"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Uploader   string    `json:"uploader,omitempty"`
+	// OriginalName is the name the image was uploaded under when it is
+	// stored under another one, e.g. by the rename, hash or uuid strategies
+	OriginalName string `json:"original_name,omitempty"`
+	// Aliases are later uploads of the same content under other names,
+	// which the hash strategy stores as this image
+	Aliases []Alias `json:"aliases,omitempty"`
+	// Meta is the embedded EXIF/XMP/IPTC metadata, nil for records probed
+	// before metadata was extracted
+	Meta *imagemeta.Metadata `json:"meta,omitempty"`
+	// Tags are user-defined labels, lowercase and sorted. They belong to the
+	// filename and survive overwrites of the content.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// Alias is an upload whose content was already stored as another image
+type Alias struct {
+	Name       string    `json:"name"`
+	Uploader   string    `json:"uploader,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+// HasAlias reports whether name was recorded as an alias
+func (r *Record) HasAlias(name string) bool {
+	for _, a := range r.Aliases {
+		if a.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrNotFound is returned when updating a record that does not exist
+var ErrNotFound = errors.New("catalog: record not found")
+
+// HasTag reports whether the image is labelled tag, either by a user or by
+// the keywords embedded in the file. Comparison ignores case.
+func (r *Record) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	if r.Meta != nil {
+		for _, keyword := range r.Meta.Keywords {
+			if strings.EqualFold(keyword, tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Image orientations derived from the dimensions
+const (
+	OrientationLandscape = "landscape"
+	OrientationPortrait  = "portrait"
+	OrientationSquare    = "square"
+)
+
+// AspectRatio returns width divided by height, 0 when the dimensions are unknown
+func (r *Record) AspectRatio() float64 {
+	if r.Width <= 0 || r.Height <= 0 {
+		return 0
+	}
+	return float64(r.Width) / float64(r.Height)
+}
+
+// Orientation returns whether the image is landscape, portrait or square,
+// "" when the dimensions are unknown
+func (r *Record) Orientation() string {
+	switch {
+	case r.Width <= 0 || r.Height <= 0:
+		return ""
+	case r.Width > r.Height:
+		return OrientationLandscape
+	case r.Width < r.Height:
+		return OrientationPortrait
+	default:
+		return OrientationSquare
+	}
+}
+
+// Catalog keeps image metadata in memory for fast queries and writes every
+// change through to a bbolt database, so listings never scan the storage
+type Catalog struct {
+	write   sync.Mutex // serializes modifications, see Update
+	mu      sync.RWMutex
+	db      *bolt.DB // nil when the catalog is not persisted
+	records map[string]*Record
+	names   []string       // all filenames, for O(1) random picks
+	pos     map[string]int // filename -> index in names
+	sorted  []string       // filenames sorted by name, rebuilt lazily
+	// changed collects the filenames modified while a reconciliation pass
+	// runs, nil otherwise; guarded by write
+	changed map[string]bool
+}
+
+// Open loads the catalog from db. A nil db gives an in-memory catalog.
+func Open(db *bolt.DB) (*Catalog, error) {
+	c := &Catalog{
+		db:      db,
+		records: make(map[string]*Record),
+		pos:     make(map[string]int),
+	}
+
+	if db == nil {
+		return c, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(imagesBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				// Skip corrupt entries, reconciliation recreates them
+				return nil
+			}
+			c.insert(&rec)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Len returns the number of records
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.records)
+}
+
+// Get returns a copy of the record for filename
+func (c *Catalog) Get(filename string) (Record, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	rec, ok := c.records[filename]
+	if !ok {
+		return Record{}, false
+	}
+	return *rec, true
+}
+
+// Put inserts or replaces a record
+func (c *Catalog) Put(rec Record) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	c.touch(rec.Filename)
+	return c.put(rec)
+}
+
+// Delete removes the record for filename; missing records are ignored
+func (c *Catalog) Delete(filename string) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	c.touch(filename)
+	return c.delete(filename)
+}
+
+// Update applies fn to a copy of the record for filename and stores the
+// result unless fn fails. Modifications are serialized, so concurrent
+// read-modify-write cycles do not lose changes.
+func (c *Catalog) Update(filename string, fn func(rec *Record) error) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	rec, ok := c.Get(filename)
+	if !ok {
+		return ErrNotFound
+	}
+	if err := fn(&rec); err != nil {
+		return err
+	}
+
+	c.touch(filename)
+	if err := c.persist(filename, &rec); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.insert(&rec)
+	c.mu.Unlock()
+	return nil
+}
+
+// Rename moves the record of from to the name to, replacing any record
+// stored under to. Tags and upload information move with the record.
+func (c *Catalog) Rename(from, to string) error {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	rec, ok := c.Get(from)
+	if !ok {
+		return ErrNotFound
+	}
+	rec.Filename = to
+	c.touch(from)
+	c.touch(to)
+
+	if c.db != nil {
+		data, err := json.Marshal(&rec)
+		if err != nil {
+			return err
+		}
+		err = c.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(imagesBucket)
+			if err != nil {
+				return err
+			}
+			if err := bucket.Delete([]byte(from)); err != nil {
+				return err
+			}
+			return bucket.Put([]byte(to), data)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.remove(from)
+	c.insert(&rec)
+	c.mu.Unlock()
+	return nil
+}
+
+// UpdateAll applies fn to a copy of every record and stores, in a single
+// transaction, those for which fn returns true. It returns how many
+// records changed.
+func (c *Catalog) UpdateAll(fn func(rec *Record) bool) (int, error) {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	var changed []*Record
+	for _, rec := range c.All() {
+		rec := rec
+		if fn(&rec) {
+			changed = append(changed, &rec)
+		}
+	}
+	if len(changed) == 0 {
+		return 0, nil
+	}
+	for _, rec := range changed {
+		c.touch(rec.Filename)
+	}
+
+	if c.db != nil {
+		err := c.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(imagesBucket)
+			if err != nil {
+				return err
+			}
+			for _, rec := range changed {
+				data, err := json.Marshal(rec)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(rec.Filename), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	c.mu.Lock()
+	for _, rec := range changed {
+		c.insert(rec)
+	}
+	c.mu.Unlock()
+	return len(changed), nil
+}
+
+// All returns copies of all records sorted by filename
+func (c *Catalog) All() []Record {
+	return c.Find(nil)
+}
+
+// Find returns copies of the records matching filter, sorted by filename.
+// A nil filter matches everything.
+func (c *Catalog) Find(filter func(*Record) bool) []Record {
+	c.mu.Lock()
+	if c.sorted == nil {
+		c.sorted = append(make([]string, 0, len(c.names)), c.names...)
+		sort.Strings(c.sorted)
+	}
+	sorted := c.sorted
+	c.mu.Unlock()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	result := make([]Record, 0)
+	for _, name := range sorted {
+		rec, ok := c.records[name]
+		if !ok {
+			continue
+		}
+		if filter == nil || filter(rec) {
+			result = append(result, *rec)
+		}
+	}
+	return result
+}
+
+// Random returns up to count randomly picked records (with repetition,
+// matching the historical behaviour of the random endpoints)
+func (c *Catalog) Random(count int) []Record {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.names) == 0 {
+		return nil
+	}
+	if count > len(c.names) {
+		count = len(c.names)
+	}
+
+	result := make([]Record, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, *c.records[c.names[rand.Intn(len(c.names))]])
+	}
+	return result
+}
+
+// RandomMatching returns up to count random records among those matching filter
+func (c *Catalog) RandomMatching(count int, filter func(*Record) bool) []Record {
+	if filter == nil {
+		return c.Random(count)
+	}
+
+	candidates := c.Find(filter)
+	if len(candidates) == 0 {
+		return nil
+	}
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+
+	result := make([]Record, 0, count)
+	for i := 0; i < count; i++ {
+		result = append(result, candidates[rand.Intn(len(candidates))])
+	}
+	return result
+}
+
+// put stores rec; callers hold c.write
+func (c *Catalog) put(rec Record) error {
+	if err := c.persist(rec.Filename, &rec); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.insert(&rec)
+	c.mu.Unlock()
+	return nil
+}
+
+// delete removes the record for filename; callers hold c.write
+func (c *Catalog) delete(filename string) error {
+	if err := c.persist(filename, nil); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.remove(filename)
+	c.mu.Unlock()
+	return nil
+}
+
+// touch notes that filename was modified during a reconciliation pass;
+// callers hold c.write
+func (c *Catalog) touch(filename string) {
+	if c.changed != nil {
+		c.changed[filename] = true
+	}
+}
+
+// persist writes rec (or deletes the key when rec is nil) to the database
+func (c *Catalog) persist(filename string, rec *Record) error {
+	if c.db == nil {
+		return nil
+	}
+
+	return c.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(imagesBucket)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			return bucket.Delete([]byte(filename))
+		}
+
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(filename), data)
+	})
+}
+
+// insert adds rec to the in-memory indexes; callers hold c.mu
+func (c *Catalog) insert(rec *Record) {
+	if _, exists := c.records[rec.Filename]; !exists {
+		c.pos[rec.Filename] = len(c.names)
+		c.names = append(c.names, rec.Filename)
+		c.sorted = nil
+	}
+	c.records[rec.Filename] = rec
+}
+
+// remove drops filename from the in-memory indexes; callers hold c.mu
+func (c *Catalog) remove(filename string) {
+	idx, exists := c.pos[filename]
+	if !exists {
+		return
+	}
+
+	last := len(c.names) - 1
+	c.names[idx] = c.names[last]
+	c.pos[c.names[idx]] = idx
+	c.names = c.names[:last]
+
+	delete(c.pos, filename)
+	delete(c.records, filename)
+	c.sorted = nil
+}
@@ -0,0 +1,95 @@
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"image"
+	_ "image/gif"  // register GIF for DecodeConfig
+	_ "image/jpeg" // register JPEG for DecodeConfig
+	_ "image/png"  // register PNG for DecodeConfig
+	"io"
+
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+)
+
+// probeHeaderSize is how much of the content is kept to read image headers.
+// JPEG headers can follow large EXIF segments, so keep a generous amount.
+const probeHeaderSize = 512 * 1024
+
+// Probe collects the checksum and image header of content written to it.
+// It is used with io.TeeReader so uploads are inspected while being stored.
+type Probe struct {
+	hash   hash.Hash
+	header bytes.Buffer
+	size   int64
+}
+
+// NewProbe creates an empty probe
+func NewProbe() *Probe {
+	return &Probe{hash: sha256.New()}
+}
+
+// Write implements io.Writer
+func (p *Probe) Write(b []byte) (int, error) {
+	p.hash.Write(b)
+	p.size += int64(len(b))
+
+	if remaining := probeHeaderSize - p.header.Len(); remaining > 0 {
+		if len(b) > remaining {
+			p.header.Write(b[:remaining])
+		} else {
+			p.header.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+// Checksum returns the hex encoded SHA-256 of everything written so far
+func (p *Probe) Checksum() string {
+	return hex.EncodeToString(p.hash.Sum(nil))
+}
+
+// Header returns the first bytes of the content
+func (p *Probe) Header() []byte {
+	return p.header.Bytes()
+}
+
+// Fill sets checksum, size, dimensions, MIME type and embedded metadata on
+// rec. Dimensions are those of the upright image, so JPEGs whose EXIF
+// orientation turns them sideways report width and height swapped.
+func (p *Probe) Fill(rec *Record) {
+	header := p.header.Bytes()
+
+	rec.Checksum = p.Checksum()
+	rec.Size = p.size
+	rec.MimeType = utils.GetMimeType(rec.Filename)
+	rec.Meta = imagemeta.Extract(header)
+
+	if cfg, format, err := image.DecodeConfig(bytes.NewReader(header)); err == nil {
+		rec.Width = cfg.Width
+		rec.Height = cfg.Height
+		rec.MimeType = "image/" + format
+
+		// orientations 5-8 are rotated by 90 or 270 degrees
+		if format == "jpeg" && imagemeta.Orientation(header) >= 5 {
+			rec.Width, rec.Height = rec.Height, rec.Width
+		}
+	} else if w, h, format, ok := imagemeta.Dimensions(header); ok {
+		rec.Width = w
+		rec.Height = h
+		rec.MimeType = "image/" + format
+	}
+}
+
+// ProbeReader reads r to the end and fills rec from its content
+func ProbeReader(r io.Reader, rec *Record) error {
+	p := NewProbe()
+	if _, err := io.Copy(p, r); err != nil {
+		return err
+	}
+	p.Fill(rec)
+	return nil
+}
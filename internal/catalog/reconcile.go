@@ -0,0 +1,158 @@
+package catalog
+
+import (
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// ReconcileResult summarizes a reconciliation pass
+type ReconcileResult struct {
+	Scanned int      `json:"scanned"`
+	Added   int      `json:"added"`
+	Updated int      `json:"updated"`
+	Removed int      `json:"removed"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// Reconcile brings the catalog in sync with the storage content. Files
+// whose size and modification time match their record are not re-read;
+// new or changed files, and records lacking embedded metadata, are probed
+// for checksum, dimensions and metadata, and records
+// of files that no longer exist are dropped. include selects which storage
+// objects belong in the catalog.
+//
+// The pass may run while images are uploaded, renamed and deleted. Records
+// modified after it started are newer than its storage listing and left
+// as they are.
+func (c *Catalog) Reconcile(store storage.Storage, include func(name string) bool) (*ReconcileResult, error) {
+	c.write.Lock()
+	c.changed = make(map[string]bool)
+	c.write.Unlock()
+	defer func() {
+		c.write.Lock()
+		c.changed = nil
+		c.write.Unlock()
+	}()
+
+	files, err := store.List("", true)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ReconcileResult{}
+	seen := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		if include != nil && !include(file.Name) {
+			continue
+		}
+		// Empty objects are names reserved by uploads in progress, not images
+		if file.Size == 0 {
+			continue
+		}
+		seen[file.Name] = true
+		result.Scanned++
+
+		existing, ok := c.Get(file.Name)
+		if ok && existing.Checksum != "" && existing.Meta != nil && !missingDimensions(existing) &&
+			existing.Size == file.Size && sameTime(existing.ModTime, file.ModTime) {
+			continue
+		}
+
+		rec := Record{
+			Filename:   file.Name,
+			ModTime:    file.ModTime,
+			UploadedAt: file.ModTime,
+		}
+		if ok {
+			rec.UploadedAt = existing.UploadedAt
+			rec.Uploader = existing.Uploader
+			rec.OriginalName = existing.OriginalName
+			rec.Aliases = existing.Aliases
+			rec.Tags = existing.Tags
+		}
+
+		if err := c.probeObject(store, &rec); err != nil {
+			result.Errors = append(result.Errors, file.Name+": "+err.Error())
+			continue
+		}
+		stored, err := c.putUnchanged(rec)
+		if err != nil {
+			result.Errors = append(result.Errors, file.Name+": "+err.Error())
+			continue
+		}
+		if !stored {
+			continue
+		}
+
+		if ok {
+			result.Updated++
+		} else {
+			result.Added++
+		}
+	}
+
+	for _, rec := range c.All() {
+		if seen[rec.Filename] {
+			continue
+		}
+		removed, err := c.deleteUnchanged(rec.Filename)
+		if err != nil {
+			result.Errors = append(result.Errors, rec.Filename+": "+err.Error())
+			continue
+		}
+		if removed {
+			result.Removed++
+		}
+	}
+
+	return result, nil
+}
+
+// putUnchanged stores rec unless its record was modified since the pass
+// started, reporting whether it did
+func (c *Catalog) putUnchanged(rec Record) (bool, error) {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	if c.changed[rec.Filename] {
+		return false, nil
+	}
+	return true, c.put(rec)
+}
+
+// deleteUnchanged removes the record for filename unless it was modified
+// since the pass started, reporting whether it did
+func (c *Catalog) deleteUnchanged(filename string) (bool, error) {
+	c.write.Lock()
+	defer c.write.Unlock()
+
+	if c.changed[filename] {
+		return false, nil
+	}
+	return true, c.delete(filename)
+}
+
+// probeObject reads an object from storage and fills rec from its content
+func (c *Catalog) probeObject(store storage.Storage, rec *Record) error {
+	r, err := store.Get(rec.Filename)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return ProbeReader(r, rec)
+}
+
+// sameTime compares modification times at second precision, which is all
+// some backends (S3 Last-Modified) report
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// missingDimensions reports whether a record was probed before dimensions
+// of formats outside the standard library were read
+func missingDimensions(rec Record) bool {
+	return rec.Width == 0 && (rec.MimeType == "image/webp" || rec.MimeType == "image/bmp")
+}
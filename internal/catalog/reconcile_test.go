@@ -0,0 +1,138 @@
+package catalog
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+func TestReconcileKeepsUserFields(t *testing.T) {
+	c, err := Open(nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	putPNG(t, store, "a.png", 2, 2)
+
+	if _, err := c.Reconcile(store, nil); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	uploaded := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	aliases := []Alias{{Name: "copy.png", Uploader: "bob", UploadedAt: uploaded}}
+	err = c.Update("a.png", func(rec *Record) error {
+		rec.UploadedAt = uploaded
+		rec.Uploader = "alice"
+		rec.OriginalName = "holiday.png"
+		rec.Aliases = aliases
+		rec.Tags = []string{"sea"}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(t *testing.T)
+	}{
+		{
+			name:   "content changed",
+			modify: func(t *testing.T) { putPNG(t, store, "a.png", 3, 1) },
+		},
+		{
+			name: "metadata missing",
+			modify: func(t *testing.T) {
+				err := c.Update("a.png", func(rec *Record) error {
+					rec.Meta = nil
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Update: %v", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		tt.modify(t)
+
+		result, err := c.Reconcile(store, nil)
+		if err != nil {
+			t.Fatalf("%s: Reconcile: %v", tt.name, err)
+		}
+		if result.Updated != 1 {
+			t.Errorf("%s: Reconcile = %+v, want one update", tt.name, result)
+		}
+
+		rec, ok := c.Get("a.png")
+		if !ok {
+			t.Fatalf("%s: record dropped", tt.name)
+		}
+		if !rec.UploadedAt.Equal(uploaded) || rec.Uploader != "alice" || rec.OriginalName != "holiday.png" {
+			t.Errorf("%s: upload fields = %v %q %q", tt.name, rec.UploadedAt, rec.Uploader, rec.OriginalName)
+		}
+		if !rec.HasAlias("copy.png") || len(rec.Aliases) != 1 {
+			t.Errorf("%s: aliases = %+v, want %+v", tt.name, rec.Aliases, aliases)
+		}
+		if !rec.HasTag("sea") {
+			t.Errorf("%s: tags = %v", tt.name, rec.Tags)
+		}
+	}
+
+	if rec, _ := c.Get("a.png"); rec.Width != 3 || rec.Height != 1 {
+		t.Errorf("dimensions = %dx%d, want 3x1", rec.Width, rec.Height)
+	}
+}
+
+func TestReconcileAddsAndRemoves(t *testing.T) {
+	c, err := Open(nil)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	putPNG(t, store, "a.png", 1, 1)
+	putPNG(t, store, "skip/b.png", 1, 1)
+	if err := store.Reserve("pending.png"); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := c.Put(Record{Filename: "gone.png"}); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	include := func(name string) bool { return name != "skip/b.png" }
+	result, err := c.Reconcile(store, include)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.Scanned != 1 || result.Added != 1 || result.Removed != 1 || len(result.Errors) != 0 {
+		t.Errorf("Reconcile = %+v", result)
+	}
+
+	for name, want := range map[string]bool{"a.png": true, "skip/b.png": false, "pending.png": false, "gone.png": false} {
+		if _, ok := c.Get(name); ok != want {
+			t.Errorf("record of %s present = %v, want %v", name, ok, want)
+		}
+	}
+
+	rec, _ := c.Get("a.png")
+	if rec.Checksum == "" || rec.MimeType != "image/png" || rec.Width != 1 {
+		t.Errorf("probed record = %+v", rec)
+	}
+}
+
+// putPNG stores a w x h PNG under name
+func putPNG(t *testing.T, store storage.Storage, name string, w, h int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatalf("encoding PNG: %v", err)
+	}
+	if _, err := store.Put(name, &buf); err != nil {
+		t.Fatalf("Put(%q): %v", name, err)
+	}
+}
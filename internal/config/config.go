@@ -3,9 +3,12 @@ package config
 import "time"
 
 type Config struct {
-	Server ServerConfig
-	File   FileConfig
-	Auth   AuthConfig
+	Server    ServerConfig
+	File      FileConfig
+	Auth      AuthConfig
+	Database  DatabaseConfig
+	Transform TransformConfig
+	Jobs      JobsConfig
 }
 
 type ServerConfig struct {
@@ -14,17 +17,114 @@ type ServerConfig struct {
 	Timeout int
 }
 
+type DatabaseConfig struct {
+	// Path of the embedded bbolt database (image catalog etc.); empty keeps everything in memory
+	Path string
+}
+
+type TransformConfig struct {
+	// CacheDir holds transformed images on local disk, whatever the storage backend
+	CacheDir string
+	// MaxWidth and MaxHeight bound the requested output size
+	MaxWidth  int
+	MaxHeight int
+	// MaxBlur bounds the blur sigma, large values are expensive
+	MaxBlur float64
+	// Presets are named transformations served at /p/:preset/:filename
+	Presets map[string]PresetConfig
+}
+
+type PresetConfig struct {
+	Width   int
+	Height  int
+	Fit     string // "inside" (default), "contain", "cover" or "fill"
+	Filter  string // "lanczos" (default), "catmullrom", "bilinear" or "nearest"
+	Quality int    // JPEG only
+	Format  string // "jpeg", "png" or "gif"; empty keeps the original format
+	Eager   bool   // generate right after upload instead of on first request
+}
+
+type JobsConfig struct {
+	Workers     int           // background jobs running at the same time
+	QueueSize   int           // pending jobs accepted before new submissions are refused
+	MaxAttempts int           // attempts per job before it is marked failed
+	RetryDelay  time.Duration // delay before the first retry, doubled for each further attempt
+	Retention   time.Duration // finished jobs are kept this long, 0 keeps them forever
+}
+
 type AuthConfig struct {
 	JWTSecret string
 	JWTExpire time.Duration
 }
 
 type FileConfig struct {
-	UploadDir  string
-	MaxSize    int64 // MB
+	UploadDir string
+	MaxSize   int64 // MB
+	// MaxFiles bounds the files of one multipart upload request, which may
+	// be up to MaxFiles * MaxSize large
+	MaxFiles int
+	// AllowTypes are the MIME types uploads may have, detected from their content
 	AllowTypes []string
-	// DuplicateStrategy controls how to handle filename conflicts: "overwrite", "rename", "reject"
+	// DuplicateStrategy controls how to handle filename conflicts: "overwrite", "rename", "reject",
+	// or avoids them by naming files after the SHA-256 of their content ("hash")
+	// or a random UUID ("uuid"), keeping the uploaded name as metadata
 	DuplicateStrategy string
+	// AutoOrient rotates JPEG uploads upright according to their EXIF
+	// orientation. Derived images (thumbnails, transforms) are always upright.
+	AutoOrient bool
+	// Scrub removes privacy sensitive metadata from uploads
+	Scrub ScrubConfig
+	// Trash keeps deleted images restorable for a while
+	Trash TrashConfig
+	// Versions keeps earlier contents of overwritten images
+	Versions VersionsConfig
+	// Resumable configures resumable (tus) uploads
+	Resumable ResumableConfig
+	// ExportDir receives the ZIP files of exports on local disk, whatever the
+	// storage backend. It must lie outside UploadDir, where the files would
+	// be taken for images.
+	ExportDir string
+	// Dedup stores identical content once, addressed by its SHA-256. It
+	// needs the database and is off when Database.Path is empty.
+	Dedup bool
+	// Storage selects the storage backend: "local" (UploadDir on disk), "memory" or "s3"
+	Storage string
+	// S3 configures the S3-compatible backend used when Storage is "s3"
+	S3 S3Config
+}
+
+type ScrubConfig struct {
+	Enabled         bool // strip EXIF (including GPS), XMP, IPTC and PNG text on upload
+	KeepOrientation bool // keep the EXIF orientation of images stored sideways
+}
+
+type TrashConfig struct {
+	Enabled   bool          // move deleted images to the trash instead of removing them
+	Retention time.Duration // trashed images are purged after this long, 0 keeps them until purged manually
+}
+
+type VersionsConfig struct {
+	Enabled  bool          // save the previous content when an image is overwritten
+	MaxCount int           // versions kept per image by the cleanup, 0 keeps all
+	MaxAge   time.Duration // versions older than this are removed by the cleanup, 0 keeps them
+}
+
+type ResumableConfig struct {
+	// Dir holds the content of unfinished uploads on local disk, whatever the storage backend
+	Dir string
+	// Expiration discards uploads receiving no content for this long
+	Expiration time.Duration
+}
+
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.amazonaws.com" or "http://127.0.0.1:9000" for MinIO
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // optional key prefix inside the bucket
+	PathStyle bool   // required by MinIO and most self-hosted S3 servers
+	PartSize  int64  // MB, files larger than this use multipart upload
 }
 
 var AppConfig *Config
@@ -39,13 +139,61 @@ func Init() *Config {
 		File: FileConfig{
 			UploadDir:         "./files",
 			MaxSize:           100, // 100MB
-			AllowTypes:        []string{"image/jpeg", "image/png", "image/gif", "image/webp"},
+			MaxFiles:          20,
+			AllowTypes:        []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/bmp", "image/x-icon", "image/svg+xml"},
 			DuplicateStrategy: "rename",
+			AutoOrient:        true,
+			Scrub: ScrubConfig{
+				Enabled:         true,
+				KeepOrientation: true,
+			},
+			Trash: TrashConfig{
+				Enabled:   true,
+				Retention: 30 * 24 * time.Hour,
+			},
+			Versions: VersionsConfig{
+				Enabled:  true,
+				MaxCount: 10,
+				MaxAge:   90 * 24 * time.Hour,
+			},
+			Resumable: ResumableConfig{
+				Dir:        "./data/uploads",
+				Expiration: 24 * time.Hour,
+			},
+			ExportDir: "./data/exports",
+			Dedup:     true,
+			Storage:   "local",
+			S3: S3Config{
+				Region:    "us-east-1",
+				PathStyle: true,
+				PartSize:  8, // 8MB
+			},
 		},
 		Auth: AuthConfig{
 			JWTSecret: "your-secret-key-change-this-in-production", // Change this in production!
 			JWTExpire: 24 * time.Hour,
 		},
+		Database: DatabaseConfig{
+			Path: "./data/img-sys.db",
+		},
+		Transform: TransformConfig{
+			CacheDir:  "./data/cache",
+			MaxWidth:  4096,
+			MaxHeight: 4096,
+			MaxBlur:   20,
+			Presets: map[string]PresetConfig{
+				"thumb": {Width: 200, Height: 200, Fit: "cover", Quality: 80, Eager: true},
+				"card":  {Width: 400, Height: 300, Fit: "cover", Quality: 85},
+				"hero":  {Width: 1920, Height: 1080, Fit: "inside", Quality: 85, Format: "jpeg"},
+			},
+		},
+		Jobs: JobsConfig{
+			Workers:     2,
+			QueueSize:   1000,
+			MaxAttempts: 3,
+			RetryDelay:  5 * time.Second,
+			Retention:   7 * 24 * time.Hour,
+		},
 	}
 	return AppConfig
 }
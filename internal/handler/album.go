@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// albumUser 返回当前访问相册的用户，匿名访问时为空
+func albumUser(ctx *gin.Context) service.AlbumUser {
+	return service.AlbumUser{
+		Name:  currentUser(ctx),
+		Admin: currentRole(ctx) == "admin",
+	}
+}
+
+// ListAlbums 列出相册；匿名访问只返回公开相册
+func (h *ImageHandler) ListAlbums(ctx *gin.Context) {
+	albums := service.NewAlbumService().List(ctx.Request.Host, albumUser(ctx))
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"total": len(albums),
+		"data":  albums,
+	})
+}
+
+// GetAlbum 获取相册详情
+func (h *ImageHandler) GetAlbum(ctx *gin.Context) {
+	album, err := service.NewAlbumService().Get(ctx.Param("id"), ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, album)
+}
+
+// CreateAlbum 创建相册
+// Body: {"name": "Wallpapers", "description": "...", "visibility": "public", "cover": "a.jpg", "images": ["a.jpg", "b.png"]}
+func (h *ImageHandler) CreateAlbum(ctx *gin.Context) {
+	var req service.AlbumParams
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	album, err := service.NewAlbumService().Create(req, ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.CustomResponse(ctx, http.StatusCreated, "album created", album)
+}
+
+// UpdateAlbum 修改相册的名称、描述、封面或可见性，未提供的字段保持不变
+func (h *ImageHandler) UpdateAlbum(ctx *gin.Context) {
+	var req service.AlbumParams
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+	if req.Images != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "use PUT /albums/:id/images to change the images", nil)
+		return
+	}
+
+	album, err := service.NewAlbumService().Update(ctx.Param("id"), req, ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, album)
+}
+
+// DeleteAlbum 删除相册，图片文件保留
+func (h *ImageHandler) DeleteAlbum(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := service.NewAlbumService().Delete(id, albumUser(ctx)); err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// ListAlbumImages 分页列出相册中的图片，默认按相册顺序
+func (h *ImageHandler) ListAlbumImages(ctx *gin.Context) {
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid page parameter", nil)
+		return
+	}
+
+	pageSize, err := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid page_size parameter", nil)
+		return
+	}
+
+	data, appErr := service.NewAlbumService().Images(ctx.Param("id"), ctx.Request.Host, albumUser(ctx), service.PageOptions{
+		Page:     page,
+		PageSize: pageSize,
+		Cursor:   ctx.Query("cursor"),
+		Sort:     ctx.Query("sort"),
+	})
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	utils.SuccessResponse(ctx, data)
+}
+
+// AddAlbumImages 向相册添加图片，position 为插入位置，省略时追加到末尾
+// Body: {"filenames": ["a.jpg", "b.png"], "position": 0}
+func (h *ImageHandler) AddAlbumImages(ctx *gin.Context) {
+	var req struct {
+		Filenames []string `json:"filenames" binding:"required"`
+		Position  *int     `json:"position"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	result, err := service.NewAlbumService().AddImages(ctx.Param("id"), req.Filenames, req.Position, ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, result)
+}
+
+// SetAlbumImages 按给定顺序替换相册中的图片
+// Body: {"filenames": ["b.png", "a.jpg"]}
+func (h *ImageHandler) SetAlbumImages(ctx *gin.Context) {
+	var req struct {
+		Filenames []string `json:"filenames" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	album, err := service.NewAlbumService().SetImages(ctx.Param("id"), req.Filenames, ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, album)
+}
+
+// RemoveAlbumImage 从相册移除一张图片
+func (h *ImageHandler) RemoveAlbumImage(ctx *gin.Context) {
+	album, err := service.NewAlbumService().RemoveImage(ctx.Param("id"), ctx.Param("filename"), ctx.Request.Host, albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, album)
+}
+
+// GetAlbumRandomImage 随机返回相册中的一张图片文件名
+func (h *ImageHandler) GetAlbumRandomImage(ctx *gin.Context) {
+	filename, err := service.NewAlbumService().RandomImage(ctx.Param("id"), albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	ctx.String(http.StatusOK, filename)
+}
+
+// ExportAlbum 按相册顺序将相册中的图片导出为ZIP
+func (h *ImageHandler) ExportAlbum(ctx *gin.Context) {
+	result, err := service.NewAlbumService().Export(ctx.Param("id"), albumUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, result)
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListFolder 列出文件夹中的子文件夹和图片，/api/v1/folders/ 为根目录。
+// recursive=true 时包括所有层级；图片支持 page、page_size、cursor、sort。
+func (h *ImageHandler) ListFolder(ctx *gin.Context) {
+	recursive, err := strconv.ParseBool(ctx.DefaultQuery("recursive", "false"))
+	if err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid recursive parameter", nil)
+		return
+	}
+
+	page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid page parameter", nil)
+		return
+	}
+
+	pageSize, err := strconv.Atoi(ctx.DefaultQuery("page_size", "20"))
+	if err != nil || pageSize < 1 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid page_size parameter", nil)
+		return
+	}
+
+	listing, appErr := service.NewFolderService().List(pathParam(ctx), ctx.Request.Host, recursive, service.PageOptions{
+		Page:     page,
+		PageSize: pageSize,
+		Cursor:   ctx.Query("cursor"),
+		Sort:     ctx.Query("sort"),
+	})
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	utils.SuccessResponse(ctx, listing)
+}
+
+// CreateFolder 创建文件夹，不存在的上级文件夹一并创建
+// Body: {"path": "wallpapers/2026"}
+func (h *ImageHandler) CreateFolder(ctx *gin.Context) {
+	var req struct {
+		Path string `json:"path" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	folder, err := service.NewFolderService().Create(req.Path)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.CustomResponse(ctx, http.StatusCreated, "folder created", folder)
+}
+
+// MoveFolder 重命名或移动文件夹
+// Body: {"destination": "archive/wallpapers"}
+func (h *ImageHandler) MoveFolder(ctx *gin.Context) {
+	var req struct {
+		Destination string `json:"destination" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	folder, err := service.NewFolderService().Move(pathParam(ctx), req.Destination)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, folder)
+}
+
+// DeleteFolder 删除文件夹；非空文件夹需要 recursive=true
+func (h *ImageHandler) DeleteFolder(ctx *gin.Context) {
+	recursive, err := strconv.ParseBool(ctx.DefaultQuery("recursive", "false"))
+	if err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid recursive parameter", nil)
+		return
+	}
+
+	result, appErr := service.NewFolderService().Delete(pathParam(ctx), recursive, currentUser(ctx))
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	utils.SuccessResponse(ctx, result)
+}
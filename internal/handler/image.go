@@ -1,42 +1,197 @@
 package handler
 
 import (
+	stderrors "errors"
+	"io"
+	"mime"
 	"net/http"
+	"os"
+	"path"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/catalog"
 	"github.com/gantoho/go-img-sys/internal/service"
 	"github.com/gantoho/go-img-sys/pkg/auth"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/imageutil"
 	"github.com/gantoho/go-img-sys/pkg/logger"
 	"github.com/gantoho/go-img-sys/pkg/utils"
 	"github.com/gin-gonic/gin"
 )
 
 type ImageHandler struct {
-	service *service.ImageService
-	logger  *logger.Logger
+	service   *service.ImageService
+	transform *service.TransformService
+	logger    *logger.Logger
 }
 
 func NewImageHandler() *ImageHandler {
 	return &ImageHandler{
-		service: service.NewImageService(),
-		logger:  logger.GetLogger(),
+		service:   service.NewImageService(),
+		transform: service.NewTransformService(),
+		logger:    logger.GetLogger(),
 	}
 }
 
-// GetImage retrieves a single image by filename
+// currentUser returns the username of the authenticated caller, if any
+func currentUser(ctx *gin.Context) string {
+	if identity, ok := ctx.Get("identity"); ok {
+		if claims, ok := identity.(*auth.Claims); ok {
+			return claims.Username
+		}
+	}
+	return ctx.GetString("username")
+}
+
+// currentRole returns the role of the authenticated caller, if any
+func currentRole(ctx *gin.Context) string {
+	if identity, ok := ctx.Get("identity"); ok {
+		if claims, ok := identity.(*auth.Claims); ok {
+			return claims.Role
+		}
+	}
+	return ctx.GetString("role")
+}
+
+// GetImage retrieves a single image by its path below the upload
+// directory (/f/folder/photo.jpg). Query parameters w, h, fit, filter, q,
+// fmt, rotate and blur request a transformed version.
 func (h *ImageHandler) GetImage(ctx *gin.Context) {
-	filename := ctx.Param("filename")
+	filename := pathParam(ctx)
+
+	opts, transform, appErr := parseTransformOptions(ctx)
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	if transform {
+		h.serveTransformed(ctx, filename, opts)
+		return
+	}
+
+	file, info, err := h.service.OpenImage(filename)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+	defer file.Close()
+
+	ctx.Header("Content-Type", utils.GetMimeType(info.Name))
+	// Images stored under a hash or UUID are saved under their uploaded name
+	if original := h.service.OriginalName(info.Name); original != "" {
+		ctx.Header("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": original}))
+	}
+	http.ServeContent(ctx.Writer, ctx.Request, info.BaseName(), info.ModTime, file)
+}
+
+// GetPresetImage serves an image rendered with a named preset
+func (h *ImageHandler) GetPresetImage(ctx *gin.Context) {
+	result, err := h.transform.TransformPreset(ctx.Param("preset"), pathParam(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
 
-	filepath, err := h.service.GetImageByFilename(filename)
+	serveCached(ctx, result)
+}
+
+// pathParam returns the image path matched by a catch-all route. Names are
+// resolved with storage.CleanName by the services, which rejects paths
+// escaping the upload directory.
+func pathParam(ctx *gin.Context) string {
+	return strings.TrimPrefix(ctx.Param("path"), "/")
+}
+
+// serveTransformed serves a transformed image from the transform cache
+func (h *ImageHandler) serveTransformed(ctx *gin.Context, filename string, opts imageutil.TransformOptions) {
+	result, err := h.transform.Transform(filename, opts)
 	if err != nil {
 		utils.ErrorResponse(ctx, err)
 		return
 	}
 
-	ctx.File(filepath)
+	serveCached(ctx, result)
+}
+
+// serveCached writes a cached transform result
+func serveCached(ctx *gin.Context, result *service.TransformedImage) {
+	file, openErr := os.Open(result.Path)
+	if openErr != nil {
+		utils.ErrorResponse(ctx, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to open transformed image", openErr))
+		return
+	}
+	defer file.Close()
+
+	ctx.Header("Content-Type", result.MimeType)
+	http.ServeContent(ctx.Writer, ctx.Request, filepath.Base(result.Path), result.ModTime, file)
+}
+
+// parseTransformOptions reads transform query parameters. The second result
+// reports whether any transform was requested.
+func parseTransformOptions(ctx *gin.Context) (imageutil.TransformOptions, bool, *errors.AppError) {
+	var opts imageutil.TransformOptions
+	requested := false
+
+	intParam := func(key string, dst *int) *errors.AppError {
+		value, ok := ctx.GetQuery(key)
+		if !ok {
+			return nil
+		}
+		requested = true
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.NewError(http.StatusBadRequest, "invalid "+key+" parameter")
+		}
+		*dst = n
+		return nil
+	}
+
+	for key, dst := range map[string]*int{"w": &opts.Width, "h": &opts.Height, "q": &opts.Quality, "rotate": &opts.Rotate} {
+		if err := intParam(key, dst); err != nil {
+			return opts, false, err
+		}
+	}
+
+	if value, ok := ctx.GetQuery("fit"); ok {
+		requested = true
+		fit, err := imageutil.ParseFitMode(value)
+		if err != nil {
+			return opts, false, errors.NewError(http.StatusBadRequest, "invalid fit parameter")
+		}
+		opts.Fit = fit
+	}
+
+	if value, ok := ctx.GetQuery("filter"); ok {
+		requested = true
+		filter, err := imageutil.ParseFilter(value)
+		if err != nil {
+			return opts, false, errors.NewError(http.StatusBadRequest, "invalid filter parameter")
+		}
+		opts.Filter = filter
+	}
+
+	if value, ok := ctx.GetQuery("fmt"); ok {
+		requested = true
+		format, err := imageutil.ParseFormat(value)
+		if err != nil {
+			return opts, false, errors.NewError(http.StatusBadRequest, "invalid fmt parameter")
+		}
+		opts.Format = format
+	}
+
+	if value, ok := ctx.GetQuery("blur"); ok {
+		requested = true
+		blur, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return opts, false, errors.NewError(http.StatusBadRequest, "invalid blur parameter")
+		}
+		opts.Blur = blur
+	}
+
+	return opts, requested, nil
 }
 
 // ListAllImages returns all available images
@@ -52,11 +207,13 @@ func (h *ImageHandler) ListAllImages(ctx *gin.Context) {
 	utils.SuccessResponse(ctx, data)
 }
 
-// ListAllImagesWithMetadata returns all images with metadata
+// ListAllImagesWithMetadata returns all images with metadata. exif=true
+// adds the embedded EXIF/XMP/IPTC metadata.
 func (h *ImageHandler) ListAllImagesWithMetadata(ctx *gin.Context) {
 	hostURL := ctx.Request.Host
+	withExif, _ := strconv.ParseBool(ctx.DefaultQuery("exif", "false"))
 
-	data, err := h.service.GetAllImagesWithMetadata(hostURL)
+	data, err := h.service.GetAllImagesWithMetadata(hostURL, withExif)
 	if err != nil {
 		utils.ErrorResponse(ctx, err)
 		return
@@ -68,7 +225,8 @@ func (h *ImageHandler) ListAllImagesWithMetadata(ctx *gin.Context) {
 	})
 }
 
-// ListAllImagesPaginated returns paginated images with metadata
+// ListAllImagesPaginated returns paginated images with metadata. Pages are
+// selected by the cursor of a previous response, or by page number.
 func (h *ImageHandler) ListAllImagesPaginated(ctx *gin.Context) {
 	hostURL := ctx.Request.Host
 	pageStr := ctx.DefaultQuery("page", "1")
@@ -86,7 +244,12 @@ func (h *ImageHandler) ListAllImagesPaginated(ctx *gin.Context) {
 		return
 	}
 
-	data, appErr := h.service.GetAllImagesPaginated(hostURL, page, pageSize)
+	data, appErr := h.service.GetAllImagesPaginated(hostURL, queryList(ctx, "tag"), service.PageOptions{
+		Page:     page,
+		PageSize: pageSize,
+		Cursor:   ctx.Query("cursor"),
+		Sort:     ctx.Query("sort"),
+	})
 	if appErr != nil {
 		utils.ErrorResponse(ctx, appErr)
 		return
@@ -97,7 +260,7 @@ func (h *ImageHandler) ListAllImagesPaginated(ctx *gin.Context) {
 
 // GetRandomImage returns a random image filename
 func (h *ImageHandler) GetRandomImage(ctx *gin.Context) {
-	filename, err := h.service.GetRandomImage()
+	filename, err := h.service.GetRandomImage(queryList(ctx, "tag"))
 	if err != nil {
 		utils.ErrorResponse(ctx, err)
 		return
@@ -121,7 +284,7 @@ func (h *ImageHandler) GetRandomImages(ctx *gin.Context) {
 		count = 100 // Limit to 100 images per request
 	}
 
-	images, appErr := h.service.GetRandomImages(hostURL, count)
+	images, appErr := h.service.GetRandomImages(hostURL, count, queryList(ctx, "tag"))
 	if appErr != nil {
 		utils.ErrorResponse(ctx, appErr)
 		return
@@ -133,94 +296,119 @@ func (h *ImageHandler) GetRandomImages(ctx *gin.Context) {
 	})
 }
 
-// UploadImage handles file uploads
+// Upload form limits besides the files themselves
+const (
+	maxFormValueSize = 64 * 1024 // a single non-file field
+	maxFormOverhead  = 1 << 20   // part headers and non-file fields of a request
+)
+
+// UploadImage handles file uploads. The multipart body is streamed: every
+// file goes to storage while it is received and is cut off at File.MaxSize,
+// the request at File.MaxFiles such files. The folder and scrub fields
+// apply to the files after them; they may also be given as query parameters.
 func (h *ImageHandler) UploadImage(ctx *gin.Context) {
 	hostURL := ctx.Request.Host
+	maxSize := h.service.MaxUploadSize()
+	maxFiles := h.service.MaxUploadFiles()
 
-	form, err := ctx.MultipartForm()
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize*int64(maxFiles)+maxFormOverhead)
+	reader, err := ctx.Request.MultipartReader()
 	if err != nil {
 		utils.CustomResponse(ctx, http.StatusBadRequest, "failed to parse form data", nil)
 		return
 	}
 
-	files := form.File["files"]
-	if len(files) == 0 {
-		utils.CustomResponse(ctx, http.StatusBadRequest, "no files provided", nil)
-		return
-	}
-
 	// Save files
+	values := make(map[string][]string)
 	uploadedFiles := make([]map[string]interface{}, 0)
 	failedFiles := make([]map[string]string, 0)
+	totalFiles := 0
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			code, message := http.StatusBadRequest, "failed to parse form data"
+			var tooLarge *http.MaxBytesError
+			if stderrors.As(err, &tooLarge) {
+				code, message = http.StatusRequestEntityTooLarge, "request too large"
+			}
+			if totalFiles == 0 {
+				utils.CustomResponse(ctx, code, message, nil)
+				return
+			}
+			// Files received so far are kept, the rest of the request is lost
+			failedFiles = append(failedFiles, map[string]string{"error": message})
+			break
+		}
 
-	cfg := config.GetConfig()
-	uploadDir := cfg.File.UploadDir
-	dupStrategy := cfg.File.DuplicateStrategy
-
-	for idx, file := range files {
-		origName := file.Filename
-		dstName := origName
-		dstPath := utils.GetUploadPath(uploadDir, dstName)
-
-		// Handle duplicates according to strategy
-		if utils.FileExists(dstPath) {
-			switch dupStrategy {
-			case "overwrite":
-				// do nothing, will overwrite
-			case "reject":
-				failedFiles = append(failedFiles, map[string]string{
-					"filename": origName,
-					"error":    "file already exists",
-				})
-				h.logger.Warn("Upload rejected for existing file %s", origName)
-				continue
-			default: // rename
-				// generate unique name: name_1.ext, name_2.ext ...
-				ext := filepath.Ext(origName)
-				nameOnly := origName[:len(origName)-len(ext)]
-				i := 1
-				for {
-					dstName = nameOnly + "_" + strconv.Itoa(i) + ext
-					dstPath = utils.GetUploadPath(uploadDir, dstName)
-					if !utils.FileExists(dstPath) {
-						break
-					}
-					i++
-				}
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormValueSize))
+			part.Close()
+			if err == nil {
+				values[part.FormName()] = append(values[part.FormName()], string(value))
 			}
+			continue
+		}
+		if part.FormName() != "files" {
+			part.Close()
+			continue
 		}
 
-		// Ensure upload dir exists
-		if err := utils.EnsureDir(uploadDir); err != nil {
-			h.logger.Error("Failed to ensure upload dir: %v", err)
+		totalFiles++
+		origName := part.FileName()
+		if totalFiles > maxFiles {
+			part.Close()
 			failedFiles = append(failedFiles, map[string]string{
 				"filename": origName,
-				"error":    "server error: cannot create upload dir",
+				"error":    "too many files",
 			})
 			continue
 		}
 
-		if err := ctx.SaveUploadedFile(file, dstPath); err != nil {
-			h.logger.Error("Failed to save file %s -> %s: %v", origName, dstPath, err)
+		scrub, appErr := scrubOverride(ctx, values)
+		if appErr != nil {
+			part.Close()
+			utils.ErrorResponse(ctx, appErr)
+			return
+		}
+		opts := service.SaveOptions{Uploader: currentUser(ctx), Scrub: scrub, Folder: formValue(ctx, values, "folder")}
+
+		rec, appErr := h.service.SaveUpload(origName, http.MaxBytesReader(ctx.Writer, part, maxSize), opts)
+		part.Close()
+		if appErr != nil {
 			failedFiles = append(failedFiles, map[string]string{
 				"filename": origName,
-				"error":    err.Error(),
+				"error":    appErr.Message,
 			})
 			continue
 		}
+		go h.transform.GenerateEagerPresets(rec.Filename)
+
+		uploaded := map[string]interface{}{
+			"index":        totalFiles,
+			"filename":     rec.Filename,
+			"size":         rec.Size,
+			"url":          hostURL + "/f/" + rec.Filename,
+			"progress":     100,
+			"deduplicated": rec.Deduplicated,
+		}
+		if rec.OriginalName != "" {
+			uploaded["original_name"] = rec.OriginalName
+		}
+		uploadedFiles = append(uploadedFiles, uploaded)
+	}
 
-		uploadedFiles = append(uploadedFiles, map[string]interface{}{
-			"index":    idx + 1,
-			"filename": dstName,
-			"size":     file.Size,
-			"url":      hostURL + "/f/" + dstName,
-			"progress": 100,
-		})
+	if totalFiles == 0 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "no files provided", nil)
+		return
 	}
 
 	result := map[string]interface{}{
 		"message":        "Upload completed",
-		"total_files":    len(files),
+		"total_files":    totalFiles,
 		"total_uploaded": len(uploadedFiles),
 		"uploaded":       uploadedFiles,
 	}
@@ -233,13 +421,48 @@ func (h *ImageHandler) UploadImage(ctx *gin.Context) {
 	utils.SuccessResponse(ctx, result)
 }
 
-// SearchImages searches and filters images
+// scrubOverride parses the scrub=true|false query or form value admins may
+// use to override metadata scrubbing of an upload
+func scrubOverride(ctx *gin.Context, values map[string][]string) (*bool, *errors.AppError) {
+	return parseScrub(ctx, formValue(ctx, values, "scrub"))
+}
+
+// parseScrub parses a scrub override, which only admins may give. An empty
+// value keeps the configured behavior.
+func parseScrub(ctx *gin.Context, value string) (*bool, *errors.AppError) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if currentRole(ctx) != "admin" {
+		return nil, errors.NewError(http.StatusForbidden, "only admins can override metadata scrubbing")
+	}
+	scrub, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.NewError(http.StatusBadRequest, "invalid scrub value")
+	}
+	return &scrub, nil
+}
+
+// formValue returns a parameter of an upload from the query string or,
+// failing that, from the multipart form values read so far
+func formValue(ctx *gin.Context, form map[string][]string, key string) string {
+	if value, ok := ctx.GetQuery(key); ok {
+		return value
+	}
+	if values := form[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// SearchImages searches and filters images. Besides the simple filters it
+// accepts a query language expression in q, a sort order in sort
+// (-size,name), a cursor and a list of fields to return in fields.
 func (h *ImageHandler) SearchImages(ctx *gin.Context) {
 	hostURL := ctx.Request.Host
-	filename := ctx.DefaultQuery("filename", "")
 	minSizeStr := ctx.DefaultQuery("min_size", "0")
 	maxSizeStr := ctx.DefaultQuery("max_size", "0")
-	fileType := ctx.DefaultQuery("type", "")
 	pageStr := ctx.DefaultQuery("page", "1")
 	pageSizeStr := ctx.DefaultQuery("page_size", "20")
 
@@ -248,12 +471,76 @@ func (h *ImageHandler) SearchImages(ctx *gin.Context) {
 	page, _ := strconv.Atoi(pageStr)
 	pageSize, _ := strconv.Atoi(pageSizeStr)
 
-	data, appErr := h.service.SearchImages(hostURL, filename, minSize, maxSize, fileType, page, pageSize)
+	params := service.SearchParams{
+		Filename: ctx.DefaultQuery("filename", ""),
+		MinSize:  minSize,
+		MaxSize:  maxSize,
+		FileType: ctx.DefaultQuery("type", ""),
+		Query:    ctx.Query("q"),
+		Tags:     queryList(ctx, "tag"),
+	}
+
+	// Dimension filters are strict, a typo would otherwise silently match everything
+	for _, f := range []struct {
+		key string
+		dst *int
+	}{
+		{"min_width", &params.MinWidth},
+		{"max_width", &params.MaxWidth},
+		{"min_height", &params.MinHeight},
+		{"max_height", &params.MaxHeight},
+	} {
+		key, dst := f.key, f.dst
+		value := ctx.Query(key)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			utils.CustomResponse(ctx, http.StatusBadRequest, "invalid "+key+": must be a non-negative integer", nil)
+			return
+		}
+		*dst = n
+	}
+
+	switch orientation := ctx.Query("orientation"); orientation {
+	case "", catalog.OrientationLandscape, catalog.OrientationPortrait, catalog.OrientationSquare:
+		params.Orientation = orientation
+	default:
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid orientation: must be landscape, portrait or square", nil)
+		return
+	}
+
+	if aspect := ctx.Query("aspect"); aspect != "" {
+		ratio, err := service.ParseAspect(aspect)
+		if err != nil {
+			utils.CustomResponse(ctx, http.StatusBadRequest, "invalid aspect: use a ratio such as 16:9 or 1.5", nil)
+			return
+		}
+		params.Aspect = ratio
+	}
+
+	data, appErr := h.service.SearchImages(hostURL, params, service.PageOptions{
+		Page:     page,
+		PageSize: pageSize,
+		Cursor:   ctx.Query("cursor"),
+		Sort:     ctx.Query("sort"),
+	})
 	if appErr != nil {
 		utils.ErrorResponse(ctx, appErr)
 		return
 	}
 
+	if fields := queryList(ctx, "fields"); len(fields) > 0 {
+		selected, appErr := service.SelectFields(data, fields)
+		if appErr != nil {
+			utils.ErrorResponse(ctx, appErr)
+			return
+		}
+		utils.SuccessResponse(ctx, selected)
+		return
+	}
+
 	utils.SuccessResponse(ctx, data)
 }
 
@@ -261,7 +548,7 @@ func (h *ImageHandler) SearchImages(ctx *gin.Context) {
 func (h *ImageHandler) DeleteImage(ctx *gin.Context) {
 	filename := ctx.Param("filename")
 
-	if err := h.service.DeleteImage(filename); err != nil {
+	if err := h.service.DeleteImage(filename, currentUser(ctx)); err != nil {
 		utils.ErrorResponse(ctx, err)
 		return
 	}
@@ -271,6 +558,102 @@ func (h *ImageHandler) DeleteImage(ctx *gin.Context) {
 	})
 }
 
+// GetImageEXIF returns the EXIF, XMP and IPTC metadata of an image
+func (h *ImageHandler) GetImageEXIF(ctx *gin.Context) {
+	data, err := h.service.GetImageEXIF(ctx.Param("filename"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, data)
+}
+
+// RenameImage renames or moves an image.
+// Body: {"filename": "archive/new.jpg"} gives the new name, including its
+// folder; {"folder": "archive"} moves the image keeping its name. When both
+// are given, filename only provides the name.
+func (h *ImageHandler) RenameImage(ctx *gin.Context) {
+	var req struct {
+		Filename string  `json:"filename"`
+		Folder   *string `json:"folder"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+	if req.Filename == "" && req.Folder == nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "filename or folder required", nil)
+		return
+	}
+
+	filename := ctx.Param("filename")
+	destination := req.Filename
+	if req.Folder != nil {
+		name := path.Base(filename)
+		if req.Filename != "" {
+			name = path.Base(req.Filename)
+		}
+		destination = strings.Trim(*req.Folder, "/") + "/" + name
+	}
+
+	rec, appErr := h.service.RenameImage(filename, destination, currentUser(ctx))
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message":  "image renamed",
+		"from":     filename,
+		"filename": rec.Filename,
+		"url":      ctx.Request.Host + "/f/" + rec.Filename,
+	})
+}
+
+// RotateImage rotates, flips or transposes a stored image in place.
+// Body: {"degrees": 90, "flip": "horizontal", "transpose": false}; the
+// operations are applied in that order.
+func (h *ImageHandler) RotateImage(ctx *gin.Context) {
+	var req struct {
+		Degrees   int    `json:"degrees"`
+		Flip      string `json:"flip"`
+		Transpose bool   `json:"transpose"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	flip, err := imageutil.ParseFlip(req.Flip)
+	if err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid flip, use horizontal or vertical", nil)
+		return
+	}
+
+	rec, appErr := h.service.OrientImage(ctx.Param("filename"), imageutil.Orientation{
+		Rotate:    req.Degrees,
+		Flip:      flip,
+		Transpose: req.Transpose,
+	})
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	go h.transform.GenerateEagerPresets(rec.Filename)
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message":  "image rotated",
+		"filename": rec.Filename,
+		"width":    rec.Width,
+		"height":   rec.Height,
+		"size":     rec.Size,
+		"url":      ctx.Request.Host + "/f/" + rec.Filename,
+	})
+}
+
 // DeleteImages deletes multiple images
 func (h *ImageHandler) DeleteImages(ctx *gin.Context) {
 	var req struct {
@@ -287,7 +670,7 @@ func (h *ImageHandler) DeleteImages(ctx *gin.Context) {
 		return
 	}
 
-	result := h.service.DeleteImages(req.Filenames)
+	result := h.service.DeleteImages(req.Filenames, currentUser(ctx))
 	utils.SuccessResponse(ctx, result)
 }
 
@@ -376,82 +759,71 @@ func (h *ImageHandler) GetDiskUsage(ctx *gin.Context) {
 	utils.SuccessResponse(ctx, usage)
 }
 
-// ExportFiles 导出多个文件为ZIP
+// ExportFiles 提交导出指定文件为ZIP的后台任务
 func (h *ImageHandler) ExportFiles(ctx *gin.Context) {
 	var req struct {
 		Filenames []string `json:"filenames" binding:"required"`
 	}
 
-	if err := ctx.BindJSON(&req); err != nil {
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
 		return
 	}
 
-	exportService := service.NewExportService()
-	result, err := exportService.ExportMultipleFiles(req.Filenames, "./files")
-	if err != nil {
-		utils.CustomResponse(ctx, http.StatusInternalServerError, "export failed", nil)
-		return
-	}
-
-	utils.SuccessResponse(ctx, result)
+	submitJob(ctx, service.JobExport, req)
 }
 
-// ExportAllFiles 导出所有文件
+// ExportAllFiles 提交导出所有文件的后台任务
 func (h *ImageHandler) ExportAllFiles(ctx *gin.Context) {
-	exportService := service.NewExportService()
-	result, err := exportService.ExportAllFiles("./files")
-	if err != nil {
-		utils.CustomResponse(ctx, http.StatusInternalServerError, "export failed", nil)
-		return
-	}
-
-	utils.SuccessResponse(ctx, result)
+	submitJob(ctx, service.JobExportAll, nil)
 }
 
-// Cleanup 执行清理操作
+// Cleanup 提交清理后台任务，仅管理员可用
 func (h *ImageHandler) Cleanup(ctx *gin.Context) {
-	var req struct {
-		RemoveOrphanThumbnails bool `json:"remove_orphan_thumbnails"`
-		RemoveOldFiles         bool `json:"remove_old_files"`
-		MaxFileAgeDays         int  `json:"max_file_age_days"`
-		RemoveEmptyDirs        bool `json:"remove_empty_dirs"`
-	}
+	var req service.CleanupParams
 
-	if err := ctx.BindJSON(&req); err != nil {
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
 		return
 	}
 
-	maintService := service.NewMaintenanceService()
-	maxAge := time.Duration(req.MaxFileAgeDays) * 24 * time.Hour
-	if maxAge == 0 {
-		maxAge = 24 * time.Hour * 30 // 默认30天
-	}
-
-	result := maintService.Cleanup(service.CleanupConfig{
-		RemoveOrphanThumbnails: req.RemoveOrphanThumbnails,
-		RemoveOldFiles:         req.RemoveOldFiles,
-		MaxFileAge:             maxAge,
-		RemoveEmptyDirs:        req.RemoveEmptyDirs,
-	})
-
-	utils.SuccessResponse(ctx, result)
+	submitJob(ctx, service.JobCleanup, req)
 }
 
-// StartThumbnailGeneration 为现有图片生成缩略图
+// StartThumbnailGeneration 为现有图片生成缩略图（后台任务）
+// filenames 为逗号分隔的文件名列表，留空则处理所有图片
 func (h *ImageHandler) StartThumbnailGeneration(ctx *gin.Context) {
-	filenames := ctx.Query("filenames")
+	job, err := service.NewThumbnailService().StartJob(queryList(ctx, "filenames"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.CustomResponse(ctx, http.StatusAccepted, "thumbnail generation started", job)
+}
 
-	if filenames == "" {
-		utils.CustomResponse(ctx, http.StatusBadRequest, "filenames parameter required", nil)
+// StartScrub starts a background job removing privacy sensitive metadata
+// from stored images. The optional filenames query parameter takes a comma
+// separated list; without it the whole library is scrubbed.
+func (h *ImageHandler) StartScrub(ctx *gin.Context) {
+	job, err := service.NewScrubService().StartJob(queryList(ctx, "filenames"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
 		return
 	}
 
-	h.logger.Info("Thumbnail generation started for: %s", filenames)
-	utils.SuccessResponse(ctx, map[string]string{
-		"message": "Thumbnail generation started (background task)",
-	})
+	utils.CustomResponse(ctx, http.StatusAccepted, "metadata scrubbing started", job)
+}
+
+// queryList splits a comma separated query parameter, dropping empty items
+func queryList(ctx *gin.Context, key string) []string {
+	var list []string
+	for _, item := range strings.Split(ctx.Query(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
 }
 
 // Login handles user login and returns JWT token
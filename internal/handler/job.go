@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListJobs 列出后台任务，可按 status、type 过滤
+func (h *ImageHandler) ListJobs(ctx *gin.Context) {
+	list := service.NewJobService().List(ctx.Query("status"), ctx.Query("type"))
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"total": len(list),
+		"data":  list,
+	})
+}
+
+// SubmitJob 提交后台任务
+func (h *ImageHandler) SubmitJob(ctx *gin.Context) {
+	var req struct {
+		Type   string          `json:"type" binding:"required"`
+		Params json.RawMessage `json:"params"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	var params interface{}
+	if len(req.Params) > 0 {
+		params = req.Params
+	}
+
+	submitJob(ctx, req.Type, params)
+}
+
+// submitJob 提交后台任务并返回 202 与任务信息
+func submitJob(ctx *gin.Context, jobType string, params interface{}) {
+	if !allowJob(ctx, jobType, "submit") {
+		return
+	}
+
+	job, err := service.NewJobService().Submit(jobType, params)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.CustomResponse(ctx, http.StatusAccepted, "job submitted", job)
+}
+
+// allowJob 检查当前用户能否对该类型的任务执行 action（submit、cancel、delete、retry），
+// cleanup、scrub 等任务仅管理员可以操作，否则返回 403
+func allowJob(ctx *gin.Context, jobType, action string) bool {
+	if service.AdminJob(jobType) && currentRole(ctx) != "admin" {
+		utils.CustomResponse(ctx, http.StatusForbidden, "only admins can "+action+" "+jobType+" jobs", nil)
+		return false
+	}
+	return true
+}
+
+// GetJob 查询后台任务状态
+func (h *ImageHandler) GetJob(ctx *gin.Context) {
+	job, err := service.NewJobService().Get(ctx.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, job)
+}
+
+// DeleteJob 取消等待中或运行中的任务；已结束的任务则删除记录
+func (h *ImageHandler) DeleteJob(ctx *gin.Context) {
+	jobService := service.NewJobService()
+	id := ctx.Param("id")
+
+	job, err := jobService.Get(id)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	if !job.Status.Finished() {
+		if !allowJob(ctx, job.Type, "cancel") {
+			return
+		}
+		job, err = jobService.Cancel(id)
+		if err != nil {
+			utils.ErrorResponse(ctx, err)
+			return
+		}
+		utils.CustomResponse(ctx, http.StatusOK, "job canceled", job)
+		return
+	}
+
+	if !allowJob(ctx, job.Type, "delete") {
+		return
+	}
+	if err := jobService.Delete(id); err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]string{
+		"message": "job deleted",
+	})
+}
+
+// PurgeJobs 删除所有已结束的任务记录
+func (h *ImageHandler) PurgeJobs(ctx *gin.Context) {
+	removed := service.NewJobService().Purge()
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message": "finished jobs deleted",
+		"removed": removed,
+	})
+}
+
+// RetryJob 重新执行失败或已取消的任务
+func (h *ImageHandler) RetryJob(ctx *gin.Context) {
+	jobService := service.NewJobService()
+	id := ctx.Param("id")
+
+	job, err := jobService.Get(id)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+	if !allowJob(ctx, job.Type, "retry") {
+		return
+	}
+
+	job, err = jobService.Retry(id)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.CustomResponse(ctx, http.StatusAccepted, "job queued for retry", job)
+}
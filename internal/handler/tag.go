@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListTags 列出所有标签及其图片数量
+func (h *ImageHandler) ListTags(ctx *gin.Context) {
+	tags := service.NewTagService().List()
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"total": len(tags),
+		"data":  tags,
+	})
+}
+
+// GetImageTags 返回单张图片的标签
+func (h *ImageHandler) GetImageTags(ctx *gin.Context) {
+	filename := ctx.Param("filename")
+
+	tags, err := service.NewTagService().ImageTags(filename)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"filename": filename,
+		"tags":     tags,
+	})
+}
+
+// AddImageTags 为单张图片添加标签
+// Body: {"tags": ["wallpaper", "nature"]}
+func (h *ImageHandler) AddImageTags(ctx *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	h.updateImageTags(ctx, req.Tags, nil)
+}
+
+// RemoveImageTag 移除单张图片的一个标签
+func (h *ImageHandler) RemoveImageTag(ctx *gin.Context) {
+	h.updateImageTags(ctx, nil, []string{ctx.Param("tag")})
+}
+
+// updateImageTags 修改路径中图片的标签并返回修改后的标签
+func (h *ImageHandler) updateImageTags(ctx *gin.Context, add, remove []string) {
+	tagService := service.NewTagService()
+	filename := ctx.Param("filename")
+
+	if _, err := tagService.Update([]string{filename}, add, remove); err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	tags, err := tagService.ImageTags(filename)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"filename": filename,
+		"tags":     tags,
+	})
+}
+
+// UpdateTags 批量为多张图片添加和移除标签
+// Body: {"filenames": ["a.jpg", "b.png"], "add": ["wallpaper"], "remove": ["draft"]}
+func (h *ImageHandler) UpdateTags(ctx *gin.Context) {
+	var req struct {
+		Filenames []string `json:"filenames" binding:"required"`
+		Add       []string `json:"add"`
+		Remove    []string `json:"remove"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	result, err := service.NewTagService().Update(req.Filenames, req.Add, req.Remove)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, result)
+}
+
+// RenameTag 重命名标签；新名称已存在时两个标签合并
+// Body: {"name": "new-name"}
+func (h *ImageHandler) RenameTag(ctx *gin.Context) {
+	var req struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	changed, err := service.NewTagService().Merge([]string{ctx.Param("tag")}, req.Name)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message": "tag renamed",
+		"name":    req.Name,
+		"images":  changed,
+	})
+}
+
+// MergeTags 将多个标签合并为一个
+// Body: {"tags": ["wallpapers", "wall-paper"], "into": "wallpaper"}
+func (h *ImageHandler) MergeTags(ctx *gin.Context) {
+	var req struct {
+		Tags []string `json:"tags" binding:"required"`
+		Into string   `json:"into" binding:"required"`
+	}
+
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid request body", nil)
+		return
+	}
+
+	changed, err := service.NewTagService().Merge(req.Tags, req.Into)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message": "tags merged",
+		"name":    req.Into,
+		"images":  changed,
+	})
+}
+
+// DeleteTag 从所有图片移除标签
+func (h *ImageHandler) DeleteTag(ctx *gin.Context) {
+	changed, err := service.NewTagService().Delete(ctx.Param("tag"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message": "tag deleted",
+		"images":  changed,
+	})
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash 列出回收站中的图片，最近删除的在前
+func (h *ImageHandler) ListTrash(ctx *gin.Context) {
+	items := service.NewTrashService().List()
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"total": len(items),
+		"data":  items,
+	})
+}
+
+// RestoreTrash 将回收站中的图片恢复到原来的位置
+func (h *ImageHandler) RestoreTrash(ctx *gin.Context) {
+	rec, err := service.NewTrashService().Restore(ctx.Param("id"), currentUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message":  "image restored",
+		"filename": rec.Filename,
+		"url":      ctx.Request.Host + "/f/" + rec.Filename,
+	})
+}
+
+// PurgeTrash 彻底删除回收站中的一张图片
+func (h *ImageHandler) PurgeTrash(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := service.NewTrashService().Purge(id); err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"id": id,
+	})
+}
+
+// EmptyTrash 清空回收站
+func (h *ImageHandler) EmptyTrash(ctx *gin.Context) {
+	purged := service.NewTrashService().PurgeAll()
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"total_purged": purged,
+	})
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/internal/uploads"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// tusContentType PATCH 请求体的内容类型
+const tusContentType = "application/offset+octet-stream"
+
+// uploadUser 返回当前访问上传的用户
+func uploadUser(ctx *gin.Context) service.UploadUser {
+	return service.UploadUser{
+		Name:  currentUser(ctx),
+		Admin: currentRole(ctx) == "admin",
+	}
+}
+
+// tusRequest 检查客户端使用的 tus 版本，不支持时返回 412
+func tusRequest(ctx *gin.Context) bool {
+	ctx.Header("Tus-Resumable", service.TusVersion)
+	if ctx.GetHeader("Tus-Resumable") != service.TusVersion {
+		ctx.Header("Tus-Version", service.TusVersion)
+		utils.ErrorResponse(ctx, errors.NewError(http.StatusPreconditionFailed, "unsupported tus version"))
+		return false
+	}
+	return true
+}
+
+// TusOptions 返回服务器支持的 tus 版本、扩展和最大上传大小
+func (h *ImageHandler) TusOptions(ctx *gin.Context) {
+	ctx.Header("Tus-Resumable", service.TusVersion)
+	ctx.Header("Tus-Version", service.TusVersion)
+	ctx.Header("Tus-Extension", service.TusExtensions)
+	ctx.Header("Tus-Max-Size", strconv.FormatInt(service.NewUploadService().MaxSize(), 10))
+	ctx.Status(http.StatusNoContent)
+}
+
+// CreateUpload 创建可恢复上传（tus creation）。
+// Upload-Length 为总字节数；Upload-Metadata 中 filename 为图片名称，
+// 可选 folder（已存在的文件夹）和 scrub（仅管理员）。请求体为
+// application/offset+octet-stream 时作为第一块内容写入（creation-with-upload）
+func (h *ImageHandler) CreateUpload(ctx *gin.Context) {
+	if !tusRequest(ctx) {
+		return
+	}
+	svc := service.NewUploadService()
+
+	if ctx.GetHeader("Upload-Defer-Length") != "" {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "Upload-Defer-Length is not supported", nil)
+		return
+	}
+	length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid Upload-Length", nil)
+		return
+	}
+	if length > svc.MaxSize() {
+		utils.CustomResponse(ctx, http.StatusRequestEntityTooLarge, "upload exceeds the maximum size", nil)
+		return
+	}
+	metadata, ok := parseUploadMetadata(ctx.GetHeader("Upload-Metadata"))
+	if !ok {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid Upload-Metadata", nil)
+		return
+	}
+	scrub, appErr := parseScrub(ctx, metadata["scrub"])
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	opts := service.SaveOptions{Uploader: currentUser(ctx), Folder: metadata["folder"], Scrub: scrub}
+	up, appErr := svc.Create(length, metadata, opts)
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	info := svc.Info(up, ctx.Request.Host)
+	ctx.Header("Location", info.URL)
+
+	if ctx.ContentType() == tusContentType && ctx.Request.ContentLength != 0 {
+		up, appErr = svc.Write(up.ID, 0, ctx.Request.Body, uploadUser(ctx))
+		if up != nil {
+			uploadHeaders(ctx, up)
+			info = svc.Info(up, ctx.Request.Host)
+		}
+		if appErr != nil {
+			utils.ErrorResponse(ctx, appErr)
+			return
+		}
+	} else {
+		uploadHeaders(ctx, up)
+	}
+
+	utils.CustomResponse(ctx, http.StatusCreated, "upload created", info)
+}
+
+// HeadUpload 返回上传已接收的字节数，客户端据此继续上传
+func (h *ImageHandler) HeadUpload(ctx *gin.Context) {
+	if !tusRequest(ctx) {
+		return
+	}
+
+	up, appErr := service.NewUploadService().Get(ctx.Param("id"), uploadUser(ctx))
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	uploadHeaders(ctx, up)
+	ctx.Header("Upload-Length", strconv.FormatInt(up.Length, 10))
+	if len(up.Metadata) > 0 {
+		ctx.Header("Upload-Metadata", formatUploadMetadata(up.Metadata))
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+}
+
+// PatchUpload 从 Upload-Offset 处追加一块内容。全部接收后图片按普通上传保存，
+// 保存失败时返回对应的错误，结果可通过 GET /api/v1/uploads/:id 查询
+func (h *ImageHandler) PatchUpload(ctx *gin.Context) {
+	if !tusRequest(ctx) {
+		return
+	}
+	if ctx.ContentType() != tusContentType {
+		utils.CustomResponse(ctx, http.StatusUnsupportedMediaType, "Content-Type must be "+tusContentType, nil)
+		return
+	}
+	offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		utils.CustomResponse(ctx, http.StatusBadRequest, "invalid Upload-Offset", nil)
+		return
+	}
+
+	svc := service.NewUploadService()
+	up, appErr := svc.Get(ctx.Param("id"), uploadUser(ctx))
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	if ctx.Request.ContentLength > up.Length-offset {
+		utils.CustomResponse(ctx, http.StatusRequestEntityTooLarge, "chunk exceeds the upload length", nil)
+		return
+	}
+
+	up, appErr = svc.Write(up.ID, offset, ctx.Request.Body, uploadUser(ctx))
+	if up != nil {
+		uploadHeaders(ctx, up)
+	}
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// GetUpload 查询上传的状态，完成后包含保存的图片名称和地址
+func (h *ImageHandler) GetUpload(ctx *gin.Context) {
+	svc := service.NewUploadService()
+	up, appErr := svc.Get(ctx.Param("id"), uploadUser(ctx))
+	if appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+
+	utils.SuccessResponse(ctx, svc.Info(up, ctx.Request.Host))
+}
+
+// DeleteUpload 终止上传并删除已接收的内容（tus termination）
+func (h *ImageHandler) DeleteUpload(ctx *gin.Context) {
+	if !tusRequest(ctx) {
+		return
+	}
+
+	if appErr := service.NewUploadService().Terminate(ctx.Param("id"), uploadUser(ctx)); appErr != nil {
+		utils.ErrorResponse(ctx, appErr)
+		return
+	}
+	ctx.Status(http.StatusNoContent)
+}
+
+// uploadHeaders 设置上传的偏移和过期时间
+func uploadHeaders(ctx *gin.Context, up *uploads.Upload) {
+	ctx.Header("Upload-Offset", strconv.FormatInt(up.Offset, 10))
+	if !up.ExpiresAt.IsZero() {
+		ctx.Header("Upload-Expires", up.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseUploadMetadata 解析 Upload-Metadata：逗号分隔的 "键 base64值"，值可以省略
+func parseUploadMetadata(header string) (map[string]string, bool) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, true
+	}
+
+	for _, pair := range strings.Split(header, ",") {
+		fields := strings.Fields(pair)
+		if len(fields) == 0 || len(fields) > 2 {
+			return nil, false
+		}
+		value := ""
+		if len(fields) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, false
+			}
+			value = string(decoded)
+		}
+		metadata[fields[0]] = value
+	}
+	return metadata, true
+}
+
+// formatUploadMetadata 按键排序编码为 Upload-Metadata
+func formatUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if metadata[key] == "" {
+			pairs = append(pairs, key)
+			continue
+		}
+		pairs = append(pairs, key+" "+base64.StdEncoding.EncodeToString([]byte(metadata[key])))
+	}
+	return strings.Join(pairs, ",")
+}
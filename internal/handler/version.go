@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+	"path"
+
+	"github.com/gantoho/go-img-sys/internal/service"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListImageVersions 列出图片的历史版本，最新的在前
+func (h *ImageHandler) ListImageVersions(ctx *gin.Context) {
+	list, err := service.NewVersionService().List(ctx.Param("filename"), ctx.Request.Host)
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"filename": ctx.Param("filename"),
+		"total":    len(list),
+		"data":     list,
+	})
+}
+
+// GetImageVersion 下载图片的一个历史版本
+func (h *ImageHandler) GetImageVersion(ctx *gin.Context) {
+	file, ver, err := service.NewVersionService().Open(ctx.Param("filename"), ctx.Param("id"))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+	defer file.Close()
+
+	ctx.Header("Content-Type", utils.GetMimeType(ver.Filename))
+	http.ServeContent(ctx.Writer, ctx.Request, path.Base(ver.Filename), ver.Record.ModTime, file)
+}
+
+// RevertImageVersion 将图片恢复为指定的历史版本，当前内容保存为新的历史版本
+func (h *ImageHandler) RevertImageVersion(ctx *gin.Context) {
+	rec, err := service.NewVersionService().Revert(ctx.Param("filename"), ctx.Param("id"), currentUser(ctx))
+	if err != nil {
+		utils.ErrorResponse(ctx, err)
+		return
+	}
+	go h.transform.GenerateEagerPresets(rec.Filename)
+
+	utils.SuccessResponse(ctx, map[string]interface{}{
+		"message":  "image reverted",
+		"filename": rec.Filename,
+		"size":     rec.Size,
+		"width":    rec.Width,
+		"height":   rec.Height,
+		"url":      ctx.Request.Host + "/f/" + rec.Filename,
+	})
+}
@@ -0,0 +1,134 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Common errors
+var (
+	ErrNotFound    = errors.New("jobs: job not found")
+	ErrUnknownType = errors.New("jobs: unknown job type")
+	ErrQueueFull   = errors.New("jobs: queue is full")
+	ErrFinished    = errors.New("jobs: job already finished")
+	ErrNotFinished = errors.New("jobs: job is still pending or running")
+)
+
+// Status is the lifecycle state of a job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Finished reports whether the job reached a final state
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCanceled
+}
+
+// Progress is reported by running jobs
+type Progress struct {
+	Total   int     `json:"total"`
+	Done    int     `json:"done"`
+	Percent float64 `json:"percent"`
+	Message string  `json:"message,omitempty"`
+}
+
+// Job is a unit of background work and its persisted state
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Status      Status          `json:"status"`
+	Params      json.RawMessage `json:"params,omitempty"`
+	Progress    Progress        `json:"progress"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	CreatedAt   time.Time       `json:"created_at"`
+	StartedAt   *time.Time      `json:"started_at,omitempty"`
+	FinishedAt  *time.Time      `json:"finished_at,omitempty"`
+	NextRunAt   *time.Time      `json:"next_run_at,omitempty"` // set while waiting for a retry
+
+	cancelRequested bool      // canceled by a user, as opposed to a shutdown
+	savedAt         time.Time // last time progress was persisted
+}
+
+// Handler executes one job type. It reports progress through task and must
+// return promptly once ctx is canceled. The returned value is stored as the
+// job result.
+type Handler func(ctx context.Context, task *Task) (interface{}, error)
+
+// permanentError marks failures that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails without further attempts, e.g. for
+// invalid parameters
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+func isPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// Task gives a running handler access to its job
+type Task struct {
+	m       *Manager
+	id      string
+	params  json.RawMessage
+	attempt int
+}
+
+// ID returns the job ID
+func (t *Task) ID() string { return t.id }
+
+// Attempt returns the current attempt, starting at 1
+func (t *Task) Attempt() int { return t.attempt }
+
+// Decode unmarshals the job parameters into v; missing parameters leave v untouched
+func (t *Task) Decode(v interface{}) error {
+	if len(t.params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(t.params, v); err != nil {
+		return Permanent(err)
+	}
+	return nil
+}
+
+// SetTotal sets the number of steps the job will take
+func (t *Task) SetTotal(total int) {
+	t.m.updateProgress(t.id, func(p *Progress) {
+		p.Total = total
+	})
+}
+
+// Advance marks n more steps as done
+func (t *Task) Advance(n int) {
+	t.m.updateProgress(t.id, func(p *Progress) {
+		p.Done += n
+	})
+}
+
+// SetMessage sets a human readable description of the current step
+func (t *Task) SetMessage(msg string) {
+	t.m.updateProgress(t.id, func(p *Progress) {
+		p.Message = msg
+	})
+}
@@ -0,0 +1,568 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	bolt "go.etcd.io/bbolt"
+)
+
+// jobsBucket is the bbolt bucket holding one JSON document per job
+var jobsBucket = []byte("jobs")
+
+// progressSaveInterval throttles how often progress updates hit the database
+const progressSaveInterval = time.Second
+
+// Options configures a Manager
+type Options struct {
+	Workers     int           // concurrently running jobs
+	QueueSize   int           // pending jobs accepted before Submit fails
+	MaxAttempts int           // attempts per job before it is marked failed
+	RetryDelay  time.Duration // delay before the first retry, doubled for each further attempt
+	Retention   time.Duration // finished jobs older than this are pruned; 0 keeps them
+}
+
+// Manager runs jobs on a bounded worker pool and persists their state, so
+// finished jobs stay queryable and interrupted ones resume after a restart
+type Manager struct {
+	opts     Options
+	db       *bolt.DB // nil when jobs are not persisted
+	logger   *logger.Logger
+	queue    chan string
+	handlers map[string]Handler
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	cancels map[string]context.CancelFunc
+
+	ctx     context.Context
+	stop    context.CancelFunc
+	wg      sync.WaitGroup
+	started bool
+}
+
+// NewManager loads persisted jobs from db. A nil db keeps jobs in memory.
+// Jobs that were pending or running when the process stopped are queued
+// again once Start is called.
+func NewManager(db *bolt.DB, opts Options) (*Manager, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		opts:     opts,
+		db:       db,
+		logger:   logger.GetLogger(),
+		handlers: make(map[string]Handler),
+		jobs:     make(map[string]*Job),
+		cancels:  make(map[string]context.CancelFunc),
+		ctx:      ctx,
+		stop:     stop,
+	}
+
+	if db != nil {
+		err := db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(jobsBucket)
+			if err != nil {
+				return err
+			}
+
+			return bucket.ForEach(func(k, v []byte) error {
+				var job Job
+				if err := json.Unmarshal(v, &job); err != nil {
+					return nil // skip corrupt entries
+				}
+				if job.Status == StatusRunning {
+					// Interrupted by a shutdown, run it again from the start
+					job.Status = StatusPending
+					job.Progress = Progress{}
+				}
+				job.NextRunAt = nil
+				m.jobs[job.ID] = &job
+				return nil
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pending := 0
+	for _, job := range m.jobs {
+		if job.Status == StatusPending {
+			pending++
+		}
+	}
+	m.queue = make(chan string, opts.QueueSize+pending)
+
+	return m, nil
+}
+
+// Register installs the handler for a job type. Call it before Start.
+func (m *Manager) Register(jobType string, handler Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[jobType] = handler
+}
+
+// Start launches the workers and queues the jobs restored from the database
+func (m *Manager) Start() {
+	m.mu.Lock()
+	if m.started {
+		m.mu.Unlock()
+		return
+	}
+	m.started = true
+
+	pending := make([]*Job, 0)
+	for _, job := range m.jobs {
+		if job.Status == StatusPending {
+			pending = append(pending, job)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+	for _, job := range pending {
+		m.queue <- job.ID // capacity covers restored jobs
+	}
+	m.mu.Unlock()
+
+	if len(pending) > 0 {
+		m.logger.Info("Resuming %d pending jobs", len(pending))
+	}
+
+	for i := 0; i < m.opts.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	if m.opts.Retention > 0 {
+		m.wg.Add(1)
+		go m.pruneLoop()
+	}
+}
+
+// Stop cancels running jobs and waits for the workers to exit. Jobs
+// interrupted this way stay pending and are resumed on the next start.
+func (m *Manager) Stop() {
+	m.stop()
+	m.wg.Wait()
+}
+
+// Submit queues a new job of the given type. params is stored as JSON and
+// handed to the handler through Task.Decode.
+func (m *Manager) Submit(jobType string, params interface{}) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.handlers[jobType]; !ok {
+		return Job{}, ErrUnknownType
+	}
+
+	var raw json.RawMessage
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return Job{}, err
+		}
+		raw = data
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := &Job{
+		ID:          id,
+		Type:        jobType,
+		Status:      StatusPending,
+		Params:      raw,
+		MaxAttempts: m.opts.MaxAttempts,
+		CreatedAt:   time.Now(),
+	}
+
+	select {
+	case m.queue <- id:
+	default:
+		return Job{}, ErrQueueFull
+	}
+
+	m.jobs[id] = job
+	if err := m.save(job); err != nil {
+		m.logger.Error("Failed to persist job %s: %v", id, err)
+	}
+
+	return *job, nil
+}
+
+// Get returns a snapshot of a job
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// List returns snapshots of the jobs matching status and type (empty
+// values match everything), newest first
+func (m *Manager) List(status Status, jobType string) []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := make([]Job, 0)
+	for _, job := range m.jobs {
+		if status != "" && job.Status != status {
+			continue
+		}
+		if jobType != "" && job.Type != jobType {
+			continue
+		}
+		result = append(result, *job)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// Cancel stops a pending or running job
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.Status.Finished() {
+		return *job, ErrFinished
+	}
+
+	job.cancelRequested = true
+	if cancel, running := m.cancels[id]; running {
+		// The worker records the final state once the handler returns
+		cancel()
+		return *job, nil
+	}
+
+	m.finish(job, StatusCanceled)
+	return *job, nil
+}
+
+// Retry queues a failed or canceled job again with a fresh set of attempts
+func (m *Manager) Retry(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.Status != StatusFailed && job.Status != StatusCanceled {
+		return *job, ErrNotFinished
+	}
+
+	select {
+	case m.queue <- id:
+	default:
+		return *job, ErrQueueFull
+	}
+
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.Error = ""
+	job.Result = nil
+	job.Progress = Progress{}
+	job.StartedAt = nil
+	job.FinishedAt = nil
+	job.cancelRequested = false
+	if err := m.save(job); err != nil {
+		m.logger.Error("Failed to persist job %s: %v", id, err)
+	}
+
+	return *job, nil
+}
+
+// Delete removes a finished job
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if !job.Status.Finished() {
+		return ErrNotFinished
+	}
+	return m.remove(id)
+}
+
+// Purge removes all finished jobs that finished before cutoff (all of them
+// for a zero cutoff) and returns how many were removed
+func (m *Manager) Purge(cutoff time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for id, job := range m.jobs {
+		if !job.Status.Finished() {
+			continue
+		}
+		if !cutoff.IsZero() && job.FinishedAt != nil && job.FinishedAt.After(cutoff) {
+			continue
+		}
+		if err := m.remove(id); err != nil {
+			m.logger.Error("Failed to remove job %s: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
+
+// worker runs queued jobs until the manager stops
+func (m *Manager) worker() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case id := <-m.queue:
+			m.run(id)
+		}
+	}
+}
+
+// run executes one attempt of a job and records the outcome
+func (m *Manager) run(id string) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok || job.Status != StatusPending || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+
+	handler, ok := m.handlers[job.Type]
+	if !ok {
+		job.Error = ErrUnknownType.Error()
+		m.finish(job, StatusFailed)
+		m.mu.Unlock()
+		return
+	}
+
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancels[id] = cancel
+
+	now := time.Now()
+	job.Status = StatusRunning
+	job.Attempts++
+	job.StartedAt = &now
+	job.NextRunAt = nil
+	job.Error = ""
+	job.Progress = Progress{}
+	if err := m.save(job); err != nil {
+		m.logger.Error("Failed to persist job %s: %v", id, err)
+	}
+
+	task := &Task{m: m, id: id, params: job.Params, attempt: job.Attempts}
+	m.mu.Unlock()
+
+	result, err := invoke(ctx, handler, task)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.cancels, id)
+	cancel()
+
+	switch {
+	case job.cancelRequested:
+		m.finish(job, StatusCanceled)
+	case err == nil:
+		if data, marshalErr := json.Marshal(result); marshalErr == nil && result != nil {
+			job.Result = data
+		}
+		if job.Progress.Total > 0 {
+			job.Progress.Done = job.Progress.Total
+		}
+		job.Progress.Percent = 100
+		m.finish(job, StatusCompleted)
+	case m.ctx.Err() != nil:
+		// Shutdown: keep it pending so it runs again after a restart
+		job.Status = StatusPending
+		job.Attempts--
+		job.Progress = Progress{}
+		if saveErr := m.save(job); saveErr != nil {
+			m.logger.Error("Failed to persist job %s: %v", id, saveErr)
+		}
+	case !isPermanent(err) && job.Attempts < job.MaxAttempts:
+		delay := m.opts.RetryDelay << uint(job.Attempts-1)
+		next := time.Now().Add(delay)
+		job.Status = StatusPending
+		job.Error = err.Error()
+		job.NextRunAt = &next
+		if saveErr := m.save(job); saveErr != nil {
+			m.logger.Error("Failed to persist job %s: %v", id, saveErr)
+		}
+		m.logger.Warn("Job %s (%s) attempt %d failed, retrying in %v: %v", id, job.Type, job.Attempts, delay, err)
+		m.requeueAfter(id, delay)
+	default:
+		job.Error = err.Error()
+		m.finish(job, StatusFailed)
+		m.logger.Error("Job %s (%s) failed: %v", id, job.Type, err)
+	}
+}
+
+// invoke calls handler, turning a panic into a permanent failure
+func invoke(ctx context.Context, handler Handler, task *Task) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Permanent(fmt.Errorf("job panicked: %v", r))
+		}
+	}()
+	return handler(ctx, task)
+}
+
+// requeueAfter queues id again once delay has passed
+func (m *Manager) requeueAfter(id string, delay time.Duration) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		select {
+		case <-m.ctx.Done():
+		case <-timer.C:
+			select {
+			case m.queue <- id:
+			case <-m.ctx.Done():
+			}
+		}
+	}()
+}
+
+// updateProgress applies fn to the progress of a running job
+func (m *Manager) updateProgress(id string, fn func(*Progress)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return
+	}
+
+	fn(&job.Progress)
+	if job.Progress.Total > 0 {
+		job.Progress.Percent = float64(job.Progress.Done) * 100 / float64(job.Progress.Total)
+	}
+
+	if time.Since(job.savedAt) >= progressSaveInterval {
+		if err := m.save(job); err != nil {
+			m.logger.Error("Failed to persist job %s: %v", id, err)
+		}
+	}
+}
+
+// finish moves a job into a final state; callers hold m.mu
+func (m *Manager) finish(job *Job, status Status) {
+	now := time.Now()
+	job.Status = status
+	job.FinishedAt = &now
+	job.NextRunAt = nil
+	if err := m.save(job); err != nil {
+		m.logger.Error("Failed to persist job %s: %v", job.ID, err)
+	}
+}
+
+// pruneLoop periodically removes finished jobs older than the retention
+func (m *Manager) pruneLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if n := m.Purge(time.Now().Add(-m.opts.Retention)); n > 0 {
+			m.logger.Info("Pruned %d finished jobs", n)
+		}
+
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// save writes a job to the database; callers hold m.mu
+func (m *Manager) save(job *Job) error {
+	job.savedAt = time.Now()
+	if m.db == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	return m.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(jobsBucket)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(job.ID), data)
+	})
+}
+
+// remove deletes a job from memory and the database; callers hold m.mu
+func (m *Manager) remove(id string) error {
+	if m.db != nil {
+		err := m.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(jobsBucket)
+			if err != nil {
+				return err
+			}
+			return bucket.Delete([]byte(id))
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(m.jobs, id)
+	return nil
+}
+
+// newID generates a random job ID
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
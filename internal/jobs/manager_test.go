@@ -0,0 +1,303 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestMain runs the tests from a scratch directory, as the logger creates
+// ./logs on first use
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "jobs-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestSubmitCompletes(t *testing.T) {
+	m := start(t, nil, Options{}, map[string]Handler{
+		"count": func(ctx context.Context, task *Task) (interface{}, error) {
+			var params struct{ N int }
+			if err := task.Decode(&params); err != nil {
+				return nil, err
+			}
+			task.SetTotal(params.N)
+			task.Advance(1)
+			return map[string]int{"counted": params.N}, nil
+		},
+	})
+
+	if _, err := m.Submit("missing", nil); err != ErrUnknownType {
+		t.Errorf("Submit of unknown type: %v, want ErrUnknownType", err)
+	}
+
+	job, err := m.Submit("count", map[string]int{"N": 4})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	job = wait(t, m, job.ID)
+	if job.Status != StatusCompleted || job.Attempts != 1 {
+		t.Errorf("job = %s after %d attempts, want completed after 1", job.Status, job.Attempts)
+	}
+	if string(job.Result) != `{"counted":4}` {
+		t.Errorf("Result = %s", job.Result)
+	}
+	if job.Progress != (Progress{Total: 4, Done: 4, Percent: 100}) {
+		t.Errorf("Progress = %+v", job.Progress)
+	}
+	if job.FinishedAt == nil {
+		t.Errorf("FinishedAt not set")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	errFlaky := errors.New("flaky")
+	m := start(t, nil, Options{MaxAttempts: 3, RetryDelay: time.Millisecond}, map[string]Handler{
+		"flaky": func(ctx context.Context, task *Task) (interface{}, error) {
+			if task.Attempt() < 3 {
+				return nil, errFlaky
+			}
+			return nil, nil
+		},
+		"broken": func(ctx context.Context, task *Task) (interface{}, error) {
+			return nil, errFlaky
+		},
+		"invalid": func(ctx context.Context, task *Task) (interface{}, error) {
+			return nil, Permanent(errors.New("invalid params"))
+		},
+		"panics": func(ctx context.Context, task *Task) (interface{}, error) {
+			panic("boom")
+		},
+	})
+
+	tests := []struct {
+		jobType  string
+		status   Status
+		attempts int
+		err      string
+	}{
+		{"flaky", StatusCompleted, 3, ""},
+		{"broken", StatusFailed, 3, "flaky"},
+		{"invalid", StatusFailed, 1, "invalid params"},
+		{"panics", StatusFailed, 1, "job panicked: boom"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.jobType, func(t *testing.T) {
+			job, err := m.Submit(tt.jobType, nil)
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			job = wait(t, m, job.ID)
+			if job.Status != tt.status || job.Attempts != tt.attempts || job.Error != tt.err {
+				t.Errorf("job = %s after %d attempts (%q), want %s after %d (%q)",
+					job.Status, job.Attempts, job.Error, tt.status, tt.attempts, tt.err)
+			}
+		})
+	}
+}
+
+func TestCancelAndRetry(t *testing.T) {
+	started := make(chan int, 1)
+	m := start(t, nil, Options{}, map[string]Handler{
+		"block": func(ctx context.Context, task *Task) (interface{}, error) {
+			started <- task.Attempt()
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	job, err := m.Submit("block", nil)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+
+	if _, err := m.Retry(job.ID); err != ErrNotFinished {
+		t.Errorf("Retry of running job: %v, want ErrNotFinished", err)
+	}
+	if err := m.Delete(job.ID); err != ErrNotFinished {
+		t.Errorf("Delete of running job: %v, want ErrNotFinished", err)
+	}
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	job = wait(t, m, job.ID)
+	if job.Status != StatusCanceled {
+		t.Fatalf("job = %s after Cancel, want canceled", job.Status)
+	}
+	if _, err := m.Cancel(job.ID); err != ErrFinished {
+		t.Errorf("second Cancel: %v, want ErrFinished", err)
+	}
+
+	// A retried job starts over with a fresh set of attempts
+	job, err = m.Retry(job.ID)
+	if err != nil || job.Status != StatusPending || job.FinishedAt != nil {
+		t.Fatalf("Retry = %s, %v; want pending", job.Status, err)
+	}
+	if attempt := <-started; attempt != 1 {
+		t.Errorf("retried job runs attempt %d, want 1", attempt)
+	}
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	wait(t, m, job.ID)
+
+	if err := m.Delete(job.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := m.Get(job.ID); err != ErrNotFound {
+		t.Errorf("Get after Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := m.Retry("missing"); err != ErrNotFound {
+		t.Errorf("Retry of unknown job: %v, want ErrNotFound", err)
+	}
+}
+
+func TestCancelPending(t *testing.T) {
+	// Without Start nothing runs, so the job stays queued
+	m, err := NewManager(nil, Options{})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	m.Register("noop", func(ctx context.Context, task *Task) (interface{}, error) {
+		return nil, nil
+	})
+
+	job, err := m.Submit("noop", nil)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	job, err = m.Cancel(job.ID)
+	if err != nil || job.Status != StatusCanceled || job.Attempts != 0 {
+		t.Errorf("Cancel = %s after %d attempts, %v; want canceled without running", job.Status, job.Attempts, err)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	db := openDB(t, path)
+
+	started := make(chan struct{}, 1)
+	m := start(t, db, Options{}, map[string]Handler{
+		"quick": func(ctx context.Context, task *Task) (interface{}, error) {
+			return "done", nil
+		},
+		"block": func(ctx context.Context, task *Task) (interface{}, error) {
+			task.SetTotal(10)
+			task.Advance(5)
+			started <- struct{}{}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+
+	quick, err := m.Submit("quick", nil)
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	wait(t, m, quick.ID)
+	interrupted, err := m.Submit("block", map[string]string{"dir": "a"})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	<-started
+
+	// Shutting down leaves the running job pending rather than failed
+	m.Stop()
+	if job, _ := m.Get(interrupted.ID); job.Status != StatusPending || job.Attempts != 0 {
+		t.Errorf("interrupted job = %s after %d attempts, want pending after 0", job.Status, job.Attempts)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	db = openDB(t, path)
+	m, err = NewManager(db, Options{})
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+
+	job, err := m.Get(quick.ID)
+	if err != nil || job.Status != StatusCompleted || string(job.Result) != `"done"` {
+		t.Errorf("finished job after restart = %+v, %v", job, err)
+	}
+	job, err = m.Get(interrupted.ID)
+	if err != nil || job.Status != StatusPending || job.Progress != (Progress{}) {
+		t.Errorf("interrupted job after restart = %+v, %v; want pending with progress reset", job, err)
+	}
+
+	var params map[string]string
+	m.Register("block", func(ctx context.Context, task *Task) (interface{}, error) {
+		return nil, task.Decode(&params)
+	})
+	m.Start()
+	defer m.Stop()
+
+	job = wait(t, m, interrupted.ID)
+	if job.Status != StatusCompleted || job.Attempts != 1 {
+		t.Errorf("resumed job = %s after %d attempts, want completed after 1", job.Status, job.Attempts)
+	}
+	if params["dir"] != "a" {
+		t.Errorf("resumed job params = %v", params)
+	}
+	if jobs := m.List(StatusCompleted, ""); len(jobs) != 2 || jobs[0].ID != interrupted.ID {
+		t.Errorf("List(completed) = %d jobs, want both, newest first", len(jobs))
+	}
+}
+
+// start creates a manager with the given handlers and stops it when the test ends
+func start(t *testing.T, db *bolt.DB, opts Options, handlers map[string]Handler) *Manager {
+	t.Helper()
+	m, err := NewManager(db, opts)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	for jobType, handler := range handlers {
+		m.Register(jobType, handler)
+	}
+	m.Start()
+	t.Cleanup(m.Stop)
+	return m
+}
+
+// wait polls until the job reaches a final state
+func wait(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", id, err)
+		}
+		if job.Status.Finished() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func openDB(t *testing.T, path string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
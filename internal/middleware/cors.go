@@ -15,10 +15,14 @@ func CORSMiddleware() gin.HandlerFunc {
 		ctx.Header("Access-Control-Allow-Credentials", "true")
 		ctx.Header("Access-Control-Allow-Headers", "*")
 		ctx.Header("Access-Control-Allow-Methods", "GET,HEAD,POST,PUT,DELETE,OPTIONS,PATCH")
-		ctx.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type")
+		ctx.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Content-Type, "+
+			"Content-Disposition, Location, Upload-Offset, Upload-Length, Upload-Metadata, Upload-Expires, "+
+			"Tus-Resumable, Tus-Version, Tus-Extension, Tus-Max-Size")
 		ctx.Header("Content-Type", "application/json")
 
-		if method == "OPTIONS" {
+		// Answer CORS preflight requests; other OPTIONS requests such as tus
+		// discovery reach their route
+		if method == "OPTIONS" && ctx.GetHeader("Access-Control-Request-Method") != "" {
 			ctx.AbortWithStatus(http.StatusNoContent)
 			return
 		}
@@ -122,11 +122,18 @@ func OptionalJWTMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	}
 }
 
-// RequireRole middleware checks if user has required role
+// RequireRole middleware checks if user has required role. The role is
+// taken from the identity set by the JWT middleware, or from the claims set
+// by OptionalJWTMiddleware.
 func RequireRole(role string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userRole, exists := c.Get("role")
-		if !exists || userRole != role {
+		userRole := c.GetString("role")
+		if identity, ok := c.Get("identity"); ok {
+			if claims, ok := identity.(*auth.Claims); ok {
+				userRole = claims.Role
+			}
+		}
+		if userRole != role {
 			utils.CustomResponse(c, http.StatusForbidden, "insufficient permissions", nil)
 			c.Abort()
 			return
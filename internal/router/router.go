@@ -9,6 +9,11 @@ import (
 )
 
 func RegisterRoutes(router *gin.Engine) {
+	// Match on the escaped path so images in folders can be addressed as
+	// /images/<folder>%2F<name>; parameters are unescaped before use
+	router.UseRawPath = true
+	router.UnescapePathValues = true
+
 	// Apply global middleware
 	router.Use(middleware.RequestTimingMiddleware())
 	router.Use(middleware.RateLimitMiddleware())
@@ -47,6 +52,21 @@ func RegisterRoutes(router *gin.Engine) {
 		v1.GET("/images/search", imageHandler.SearchImages)
 		v1.GET("/images/random", imageHandler.GetRandomImage)
 		v1.GET("/images/random/:number", imageHandler.GetRandomImages)
+		v1.GET("/images/:filename/exif", imageHandler.GetImageEXIF)
+		v1.GET("/images/:filename/tags", imageHandler.GetImageTags)
+		v1.GET("/tags", imageHandler.ListTags)
+		v1.GET("/folders/*path", imageHandler.ListFolder)
+
+		// Albums (private albums are visible with a JWT of their owner or an admin)
+		optionalJWT := middleware.OptionalJWTMiddleware(jwtManager)
+		v1.GET("/albums", optionalJWT, imageHandler.ListAlbums)
+		v1.GET("/albums/:id", optionalJWT, imageHandler.GetAlbum)
+		v1.GET("/albums/:id/images", optionalJWT, imageHandler.ListAlbumImages)
+		v1.GET("/albums/:id/random", optionalJWT, imageHandler.GetAlbumRandomImage)
+
+		// tus discovery, the other resumable upload requests require a JWT
+		v1.OPTIONS("/uploads", imageHandler.TusOptions)
+		v1.OPTIONS("/uploads/:id", imageHandler.TusOptions)
 	}
 
 	// v1 protected routes - write operations require JWT
@@ -58,7 +78,55 @@ func RegisterRoutes(router *gin.Engine) {
 	{
 		v1Protected.POST("/images/upload", imageHandler.UploadImage)
 		v1Protected.DELETE("/images/:filename", imageHandler.DeleteImage)
+		v1Protected.PATCH("/images/:filename", imageHandler.RenameImage)
+		v1Protected.GET("/images/:filename/versions", imageHandler.ListImageVersions)
+		v1Protected.GET("/images/:filename/versions/:id", imageHandler.GetImageVersion)
+		v1Protected.POST("/images/:filename/versions/:id/revert", imageHandler.RevertImageVersion)
+		v1Protected.POST("/images/:filename/rotate", imageHandler.RotateImage)
 		v1Protected.POST("/images/delete", imageHandler.DeleteImages)
+
+		// Tags
+		v1Protected.POST("/images/tags", imageHandler.UpdateTags)
+		v1Protected.POST("/images/:filename/tags", imageHandler.AddImageTags)
+		v1Protected.DELETE("/images/:filename/tags/:tag", imageHandler.RemoveImageTag)
+		v1Protected.PATCH("/tags/:tag", imageHandler.RenameTag)
+		v1Protected.DELETE("/tags/:tag", imageHandler.DeleteTag)
+		v1Protected.POST("/tags/merge", imageHandler.MergeTags)
+
+		// Folders
+		v1Protected.POST("/folders", imageHandler.CreateFolder)
+		v1Protected.PATCH("/folders/*path", imageHandler.MoveFolder)
+		v1Protected.DELETE("/folders/*path", imageHandler.DeleteFolder)
+
+		// Resumable uploads (tus 1.0)
+		v1Protected.POST("/uploads", imageHandler.CreateUpload)
+		v1Protected.HEAD("/uploads/:id", imageHandler.HeadUpload)
+		v1Protected.PATCH("/uploads/:id", imageHandler.PatchUpload)
+		v1Protected.GET("/uploads/:id", imageHandler.GetUpload)
+		v1Protected.DELETE("/uploads/:id", imageHandler.DeleteUpload)
+
+		// Trash
+		v1Protected.GET("/trash", imageHandler.ListTrash)
+		v1Protected.POST("/trash/:id/restore", imageHandler.RestoreTrash)
+		v1Protected.DELETE("/trash/:id", imageHandler.PurgeTrash)
+		v1Protected.DELETE("/trash", imageHandler.EmptyTrash)
+
+		// Albums
+		v1Protected.POST("/albums", imageHandler.CreateAlbum)
+		v1Protected.PATCH("/albums/:id", imageHandler.UpdateAlbum)
+		v1Protected.DELETE("/albums/:id", imageHandler.DeleteAlbum)
+		v1Protected.POST("/albums/:id/images", imageHandler.AddAlbumImages)
+		v1Protected.PUT("/albums/:id/images", imageHandler.SetAlbumImages)
+		v1Protected.DELETE("/albums/:id/images/:filename", imageHandler.RemoveAlbumImage)
+		v1Protected.POST("/albums/:id/export", imageHandler.ExportAlbum)
+
+		// Background jobs
+		v1Protected.GET("/jobs", imageHandler.ListJobs)
+		v1Protected.POST("/jobs", imageHandler.SubmitJob)
+		v1Protected.DELETE("/jobs", imageHandler.PurgeJobs)
+		v1Protected.GET("/jobs/:id", imageHandler.GetJob)
+		v1Protected.DELETE("/jobs/:id", imageHandler.DeleteJob)
+		v1Protected.POST("/jobs/:id/retry", imageHandler.RetryJob)
 	}
 
 	// v1 admin routes - requires JWT with admin role
@@ -66,10 +134,12 @@ func RegisterRoutes(router *gin.Engine) {
 	if err == nil {
 		v1Admin.Use(jwtMiddleware.MiddlewareFunc())
 	}
+	v1Admin.Use(middleware.RequireRole("admin"))
 	{
 		v1Admin.POST("/api-keys", imageHandler.CreateAPIKey)
 		v1Admin.GET("/api-keys", imageHandler.ListAPIKeys)
 		v1Admin.DELETE("/api-keys", imageHandler.RevokeAPIKey)
+		v1Admin.POST("/scrub", imageHandler.StartScrub)
 	}
 
 	// v1 utility routes - statistics, export, cleanup (public read, protected write)
@@ -90,10 +160,12 @@ func RegisterRoutes(router *gin.Engine) {
 		v1UtilProtected.POST("/export-all", imageHandler.ExportAllFiles)
 		v1UtilProtected.POST("/cleanup", imageHandler.Cleanup)
 		v1UtilProtected.POST("/generate-thumbnails", imageHandler.StartThumbnailGeneration)
+		v1UtilProtected.GET("/jobs/:id", imageHandler.GetJob)
 	}
 
 	// Direct file access
-	router.GET("/f/:filename", imageHandler.GetImage)
+	router.GET("/f/*path", imageHandler.GetImage)
+	router.GET("/p/:preset/*path", imageHandler.GetPresetImage)
 
 	router.GET("/bgimg", imageHandler.GetRandomImage)
 
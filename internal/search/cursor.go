@@ -0,0 +1,119 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+)
+
+// ErrCursorSort is returned for a cursor issued for another sort order
+var ErrCursorSort = errors.New("cursor was issued for a different sort order")
+
+// Cursor marks a position between records of a sorted listing. It holds
+// the sort values of the record at the edge of a page, so the next page
+// starts at the right place even after records were added or removed.
+type Cursor struct {
+	order  Order
+	before bool // the page ends before the edge record instead of starting after it
+	edge   catalog.Record
+}
+
+// cursorToken is the encoded form of a Cursor; times are Unix nanoseconds
+type cursorToken struct {
+	Sort     string `json:"s"`
+	Before   bool   `json:"b,omitempty"`
+	Filename string `json:"f"`
+	Size     int64  `json:"z,omitempty"`
+	Width    int    `json:"w,omitempty"`
+	Height   int    `json:"h,omitempty"`
+	ModTime  int64  `json:"m,omitempty"`
+	Uploaded int64  `json:"u,omitempty"`
+	Taken    int64  `json:"t,omitempty"`
+}
+
+// NewCursor returns the token of the position after rec, or before it
+func NewCursor(o Order, rec *catalog.Record, before bool) string {
+	token := cursorToken{
+		Sort:     o.String(),
+		Before:   before,
+		Filename: rec.Filename,
+		Size:     rec.Size,
+		Width:    rec.Width,
+		Height:   rec.Height,
+		ModTime:  unixNano(rec.ModTime),
+		Uploaded: unixNano(rec.UploadedAt),
+		Taken:    unixNano(takenAt(rec)),
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParseCursor decodes a token returned by NewCursor for the same order
+func ParseCursor(token string, o Order) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var t cursorToken
+	if err := json.Unmarshal(data, &t); err != nil || t.Filename == "" {
+		return nil, errors.New("malformed cursor")
+	}
+	if t.Sort != o.String() {
+		return nil, ErrCursorSort
+	}
+
+	c := &Cursor{
+		order:  o,
+		before: t.Before,
+		edge: catalog.Record{
+			Filename:   t.Filename,
+			Size:       t.Size,
+			Width:      t.Width,
+			Height:     t.Height,
+			ModTime:    fromUnixNano(t.ModTime),
+			UploadedAt: fromUnixNano(t.Uploaded),
+		},
+	}
+	if t.Taken != 0 {
+		taken := fromUnixNano(t.Taken)
+		c.edge.Meta = &imagemeta.Metadata{TakenAt: &taken}
+	}
+	return c, nil
+}
+
+// Window returns the index range [start, end) of the page of up to limit
+// records next to the cursor. records must be sorted by the cursor's order.
+func (c *Cursor) Window(records []catalog.Record, limit int) (int, int) {
+	// first record sorting after the edge, or at or after it for a
+	// backward cursor
+	i := sort.Search(len(records), func(i int) bool {
+		cmp := c.order.Compare(&records[i], &c.edge)
+		return cmp > 0 || (c.before && cmp == 0)
+	})
+
+	if c.before {
+		return max(0, i-limit), i
+	}
+	return i, min(len(records), i+limit)
+}
+
+// unixNano converts t to Unix nanoseconds, 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the inverse of unixNano
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
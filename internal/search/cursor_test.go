@@ -0,0 +1,123 @@
+package search
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+)
+
+func TestParseSort(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    string
+		invalid bool
+	}{
+		{spec: "", want: "name"},
+		{spec: "-size", want: "-size,name"},
+		{spec: " +Width , -mtime ", want: "width,-modified,name"},
+		{spec: "-filename,size", want: "-name,size"},
+		{spec: "uploaded_at,taken", want: "uploaded,taken,name"},
+		{spec: "color", invalid: true},
+		{spec: "-", invalid: true},
+	}
+
+	for _, tt := range tests {
+		order, err := ParseSort(tt.spec)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ParseSort(%q) = %s, want error", tt.spec, order)
+			}
+			continue
+		}
+		if err != nil || order.String() != tt.want {
+			t.Errorf("ParseSort(%q) = %s, %v; want %s", tt.spec, order, err, tt.want)
+		}
+	}
+}
+
+func TestCursorWindow(t *testing.T) {
+	order, err := ParseSort("-size")
+	if err != nil {
+		t.Fatalf("ParseSort: %v", err)
+	}
+	// Sizes repeat, so the name decides within a size
+	var records []catalog.Record
+	for i := 0; i < 10; i++ {
+		records = append(records, catalog.Record{Filename: fmt.Sprintf("%d.jpg", i), Size: int64(i / 2)})
+	}
+	order.Sort(records)
+	if got := filenames(records); got != "8 9 6 7 4 5 2 3 0 1" {
+		t.Fatalf("sorted = %s", got)
+	}
+
+	tests := []struct {
+		name   string
+		edge   int // index of the edge record in records
+		before bool
+		limit  int
+		want   string
+	}{
+		{name: "after first", edge: 0, limit: 3, want: "9 6 7"},
+		{name: "after middle", edge: 4, limit: 3, want: "5 2 3"},
+		{name: "after near end", edge: 8, limit: 3, want: "1"},
+		{name: "after last", edge: 9, limit: 3, want: ""},
+		{name: "before middle", edge: 4, before: true, limit: 3, want: "9 6 7"},
+		{name: "before near start", edge: 2, before: true, limit: 3, want: "8 9"},
+		{name: "before first", edge: 0, before: true, limit: 3, want: ""},
+	}
+
+	for _, tt := range tests {
+		token := NewCursor(order, &records[tt.edge], tt.before)
+		c, err := ParseCursor(token, order)
+		if err != nil {
+			t.Fatalf("%s: ParseCursor: %v", tt.name, err)
+		}
+		start, end := c.Window(records, tt.limit)
+		if got := filenames(records[start:end]); got != tt.want {
+			t.Errorf("%s: window = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCursorSurvivesChanges(t *testing.T) {
+	order, _ := ParseSort("name")
+	records := []catalog.Record{{Filename: "a"}, {Filename: "b"}, {Filename: "c"}, {Filename: "d"}}
+	token := NewCursor(order, &records[1], false)
+
+	// The edge record is deleted and a record is added before it
+	changed := []catalog.Record{{Filename: "a"}, {Filename: "aa"}, {Filename: "c"}, {Filename: "d"}}
+	c, err := ParseCursor(token, order)
+	if err != nil {
+		t.Fatalf("ParseCursor: %v", err)
+	}
+	start, end := c.Window(changed, 10)
+	if got := filenames(changed[start:end]); got != "c d" {
+		t.Errorf("window after changes = %s, want c d", got)
+	}
+}
+
+func TestParseCursorErrors(t *testing.T) {
+	bySize, _ := ParseSort("size")
+	byName, _ := ParseSort("name")
+	token := NewCursor(bySize, &catalog.Record{Filename: "a.jpg", Size: 1}, false)
+
+	if _, err := ParseCursor(token, byName); err != ErrCursorSort {
+		t.Errorf("ParseCursor with another order: %v, want ErrCursorSort", err)
+	}
+	for _, bad := range []string{"not base64!", "bm90IGpzb24", "e30"} { // "not json", "{}"
+		if _, err := ParseCursor(bad, bySize); err == nil || !strings.Contains(err.Error(), "malformed") {
+			t.Errorf("ParseCursor(%q): %v, want malformed cursor", bad, err)
+		}
+	}
+}
+
+// filenames joins the filenames of records without their extension
+func filenames(records []catalog.Record) string {
+	names := make([]string, 0, len(records))
+	for _, r := range records {
+		names = append(names, strings.TrimSuffix(r.Filename, ".jpg"))
+	}
+	return strings.Join(names, " ")
+}
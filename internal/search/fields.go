@@ -0,0 +1,302 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+)
+
+// defaultField is searched by bare words
+const defaultField = "name"
+
+// matcher evaluates a compiled term against a record
+type matcher func(rec *catalog.Record) bool
+
+// fieldCompiler turns an operator and value into a matcher
+type fieldCompiler func(op Operator, value string) (matcher, error)
+
+// fields maps query field names (and aliases) to their compilers
+var fields = map[string]fieldCompiler{
+	"name":        textField(func(r *catalog.Record) string { return r.Filename }),
+	"filename":    textField(func(r *catalog.Record) string { return r.Filename }),
+	"type":        compileType,
+	"ext":         compileType,
+	"mime":        textField(func(r *catalog.Record) string { return r.MimeType }),
+	"uploader":    textField(func(r *catalog.Record) string { return r.Uploader }),
+	"camera":      textField(camera),
+	"size":        numberField(parseSize, func(r *catalog.Record) int64 { return r.Size }),
+	"width":       numberField(parseCount, func(r *catalog.Record) int64 { return int64(r.Width) }),
+	"height":      numberField(parseCount, func(r *catalog.Record) int64 { return int64(r.Height) }),
+	"orientation": compileOrientation,
+	"uploaded":    timeField(func(r *catalog.Record) time.Time { return r.UploadedAt }),
+	"modified":    timeField(func(r *catalog.Record) time.Time { return r.ModTime }),
+	"taken":       timeField(takenAt),
+	"tag":         compileTag,
+}
+
+// FieldNames returns the names accepted in queries, sorted
+func FieldNames() []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// compileTerm looks up the field and compiles the comparison
+func compileTerm(field string, op Operator, value string) (matcher, error) {
+	compile, ok := fields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q (supported: %s)", field, strings.Join(FieldNames(), ", "))
+	}
+	match, err := compile(op, value)
+	if errors.Is(err, errUnsupported) {
+		return nil, fmt.Errorf("operator %q is not supported for field %q", op, field)
+	}
+	return match, err
+}
+
+// errUnsupported is returned by compilers for operators the field cannot use
+var errUnsupported = errors.New("unsupported operator")
+
+// textField compares case insensitively: ":" matches a substring, or a
+// glob pattern when the value holds * or ?; "=" and "!=" match the whole text
+func textField(get func(*catalog.Record) string) fieldCompiler {
+	return func(op Operator, value string) (matcher, error) {
+		want := strings.ToLower(value)
+
+		var match matcher
+		switch {
+		case strings.ContainsAny(want, "*?["):
+			if _, err := path.Match(want, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q", value)
+			}
+			match = func(r *catalog.Record) bool {
+				ok, _ := path.Match(want, strings.ToLower(get(r)))
+				return ok
+			}
+		case op == OpMatch:
+			match = func(r *catalog.Record) bool { return strings.Contains(strings.ToLower(get(r)), want) }
+		default:
+			match = func(r *catalog.Record) bool { return strings.EqualFold(get(r), value) }
+		}
+
+		switch op {
+		case OpMatch, OpEqual:
+			return match, nil
+		case OpNotEqual:
+			return func(r *catalog.Record) bool { return !match(r) }, nil
+		default:
+			return nil, errUnsupported
+		}
+	}
+}
+
+// compileType matches the file extension, with or without the dot;
+// jpg and jpeg are the same type
+func compileType(op Operator, value string) (matcher, error) {
+	want := normalizeExt(value)
+	if want == "" {
+		return nil, fmt.Errorf("missing file type")
+	}
+	match := func(r *catalog.Record) bool { return normalizeExt(path.Ext(r.Filename)) == want }
+
+	switch op {
+	case OpMatch, OpEqual:
+		return match, nil
+	case OpNotEqual:
+		return func(r *catalog.Record) bool { return !match(r) }, nil
+	default:
+		return nil, errUnsupported
+	}
+}
+
+// normalizeExt lowercases an extension and strips the dot
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+	if ext == "jpeg" {
+		return "jpg"
+	}
+	return ext
+}
+
+// compileOrientation matches landscape, portrait or square images
+func compileOrientation(op Operator, value string) (matcher, error) {
+	want := strings.ToLower(value)
+	switch want {
+	case catalog.OrientationLandscape, catalog.OrientationPortrait, catalog.OrientationSquare:
+	default:
+		return nil, fmt.Errorf("invalid orientation %q, use landscape, portrait or square", value)
+	}
+
+	switch op {
+	case OpMatch, OpEqual:
+		return func(r *catalog.Record) bool { return r.Orientation() == want }, nil
+	case OpNotEqual:
+		return func(r *catalog.Record) bool { return r.Orientation() != want }, nil
+	default:
+		return nil, errUnsupported
+	}
+}
+
+// compileTag matches user tags and the keywords embedded in the image
+func compileTag(op Operator, value string) (matcher, error) {
+	match := func(r *catalog.Record) bool { return r.HasTag(value) }
+
+	switch op {
+	case OpMatch, OpEqual:
+		return match, nil
+	case OpNotEqual:
+		return func(r *catalog.Record) bool { return !match(r) }, nil
+	default:
+		return nil, errUnsupported
+	}
+}
+
+// numberField compares integers; ":" is the same as "="
+func numberField(parse func(string) (int64, error), get func(*catalog.Record) int64) fieldCompiler {
+	return func(op Operator, value string) (matcher, error) {
+		want, err := parse(value)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case OpMatch, OpEqual:
+			return func(r *catalog.Record) bool { return get(r) == want }, nil
+		case OpNotEqual:
+			return func(r *catalog.Record) bool { return get(r) != want }, nil
+		case OpGreater:
+			return func(r *catalog.Record) bool { return get(r) > want }, nil
+		case OpGreaterEqual:
+			return func(r *catalog.Record) bool { return get(r) >= want }, nil
+		case OpLess:
+			return func(r *catalog.Record) bool { return get(r) < want }, nil
+		case OpLessEqual:
+			return func(r *catalog.Record) bool { return get(r) <= want }, nil
+		default:
+			return nil, errUnsupported
+		}
+	}
+}
+
+// parseCount parses a non-negative integer
+func parseCount(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number %q", value)
+	}
+	return n, nil
+}
+
+// sizeUnits are the accepted size suffixes, 1024 based like the size_str
+// of listings
+var sizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// parseSize parses a byte count with an optional unit: 500, 200KB, 2MB, 1.5G
+func parseSize(value string) (int64, error) {
+	number, factor := strings.ToLower(value), 1.0
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, factor = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, fmt.Errorf("invalid size %q, use a number with an optional KB, MB or GB unit", value)
+	}
+	return int64(n * factor), nil
+}
+
+// timeLayouts are the accepted time formats with the span each denotes.
+// Times without a zone are UTC.
+var timeLayouts = []struct {
+	layout string
+	span   func(time.Time) time.Time
+}{
+	{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+	{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+	{"2006-01-02T15:04", func(t time.Time) time.Time { return t.Add(time.Minute) }},
+	{"2006-01-02T15:04:05", func(t time.Time) time.Time { return t.Add(time.Second) }},
+	{time.RFC3339, func(t time.Time) time.Time { return t.Add(time.Second) }},
+}
+
+// parseTimeRange parses a date or time into the half open range it covers,
+// so uploaded:2026-01-01 is the whole day
+func parseTimeRange(value string) (time.Time, time.Time, error) {
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l.layout, value); err == nil {
+			return t, l.span(t), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD or RFC 3339", value)
+}
+
+// timeField compares times against the range of the value: ">" is after
+// the range, "<" before it and ":" or "=" within it. Unknown (zero) times
+// never match.
+func timeField(get func(*catalog.Record) time.Time) fieldCompiler {
+	return func(op Operator, value string) (matcher, error) {
+		start, end, err := parseTimeRange(value)
+		if err != nil {
+			return nil, err
+		}
+
+		var cmp func(t time.Time) bool
+		switch op {
+		case OpMatch, OpEqual:
+			cmp = func(t time.Time) bool { return !t.Before(start) && t.Before(end) }
+		case OpNotEqual:
+			cmp = func(t time.Time) bool { return t.Before(start) || !t.Before(end) }
+		case OpGreater:
+			cmp = func(t time.Time) bool { return !t.Before(end) }
+		case OpGreaterEqual:
+			cmp = func(t time.Time) bool { return !t.Before(start) }
+		case OpLess:
+			cmp = func(t time.Time) bool { return t.Before(start) }
+		case OpLessEqual:
+			cmp = func(t time.Time) bool { return t.Before(end) }
+		default:
+			return nil, errUnsupported
+		}
+
+		return func(r *catalog.Record) bool {
+			t := get(r)
+			return !t.IsZero() && cmp(t)
+		}, nil
+	}
+}
+
+// camera returns the make and model of the camera that took the image
+func camera(r *catalog.Record) string {
+	if r.Meta == nil {
+		return ""
+	}
+	return strings.TrimSpace(r.Meta.Make + " " + r.Meta.Model)
+}
+
+// takenAt returns the capture time from the embedded metadata
+func takenAt(r *catalog.Record) time.Time {
+	if r.Meta == nil || r.Meta.TakenAt == nil {
+		return time.Time{}
+	}
+	return *r.Meta.TakenAt
+}
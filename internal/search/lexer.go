@@ -0,0 +1,167 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind identifies the lexical class of a token
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+// token is a lexical unit of a query; pos is the 1-based byte offset
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// describe names the token for error messages
+func (t token) describe() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// SyntaxError describes a malformed query
+type SyntaxError struct {
+	Pos int // 1-based byte offset in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// isOpChar reports whether c starts a comparison operator
+func isOpChar(c byte) bool {
+	return c == ':' || c == '=' || c == '!' || c == '<' || c == '>'
+}
+
+// isSpace reports whether c separates tokens
+func isSpace(c byte) bool {
+	return c < 0x80 && unicode.IsSpace(rune(c))
+}
+
+// lex splits a query into tokens. The value after an operator is read raw
+// up to the next space or closing parenthesis, so values may contain
+// colons, dashes and keywords (uploaded>2026-01-01T10:00, name:AND).
+func lex(input string) ([]token, error) {
+	var tokens []token
+	afterOp := false
+	startOfTerm := true // a dash here negates the following term
+
+	for i := 0; i < len(input); {
+		c := input[i]
+		pos := i + 1
+
+		switch {
+		case isSpace(c):
+			i++
+			startOfTerm = true
+			continue
+
+		case c == '"':
+			text, n, err := readString(input[i:])
+			if err != nil {
+				return nil, &SyntaxError{Pos: pos, Msg: err.Error()}
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: pos})
+			i += n
+
+		case c == '(' && !afterOp:
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: pos})
+			i++
+			afterOp, startOfTerm = false, true
+			continue
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: pos})
+			i++
+
+		case afterOp:
+			end := i
+			for end < len(input) && !isSpace(input[end]) && input[end] != ')' {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: input[i:end], pos: pos})
+			i = end
+
+		case isOpChar(c):
+			op := string(c)
+			if i+1 < len(input) && input[i+1] == '=' && c != ':' && c != '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &SyntaxError{Pos: pos, Msg: `unexpected "!", use != or NOT`}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+			i += len(op)
+			afterOp, startOfTerm = true, false
+			continue
+
+		case c == '-' && startOfTerm && i+1 < len(input) && !isSpace(input[i+1]):
+			tokens = append(tokens, token{kind: tokNot, text: "-", pos: pos})
+			i++
+			startOfTerm = false
+			continue
+
+		default:
+			end := i
+			for end < len(input) && !isSpace(input[end]) && !isOpChar(input[end]) &&
+				input[end] != '(' && input[end] != ')' && input[end] != '"' {
+				end++
+			}
+			word := input[i:end]
+			kind := tokWord
+			switch word {
+			case "AND":
+				kind = tokAnd
+			case "OR":
+				kind = tokOr
+			case "NOT":
+				kind = tokNot
+			}
+			tokens = append(tokens, token{kind: kind, text: word, pos: pos})
+			i = end
+		}
+
+		afterOp, startOfTerm = false, false
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(input) + 1}), nil
+}
+
+// readString reads a double quoted string at the start of s, returning the
+// unquoted text and the number of bytes consumed. \" and \\ are escapes.
+func readString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+			b.WriteByte(s[i])
+		case '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
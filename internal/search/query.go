@@ -0,0 +1,237 @@
+// Package search implements the image search query language. A query is a
+// boolean expression over catalog fields:
+//
+//	name:potala AND type:jpg AND size>2MB AND uploaded>2026-01-01
+//	(tag:wallpaper OR tag:desktop) -orientation:portrait
+//
+// Terms are field comparisons or bare words, which match the filename.
+// Adjacent terms are joined with AND; NOT or a leading dash negates a term.
+package search
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+)
+
+// MaxQueryLength limits the size of a query
+const MaxQueryLength = 1024
+
+// Operator is a comparison operator of a term
+type Operator string
+
+// Comparison operators; ":" means contains for text fields and equals
+// for everything else
+const (
+	OpMatch        Operator = ":"
+	OpEqual        Operator = "="
+	OpNotEqual     Operator = "!="
+	OpGreater      Operator = ">"
+	OpGreaterEqual Operator = ">="
+	OpLess         Operator = "<"
+	OpLessEqual    Operator = "<="
+)
+
+// Node is a node of the query syntax tree
+type Node interface {
+	// Match reports whether the record satisfies the expression
+	Match(rec *catalog.Record) bool
+	String() string
+}
+
+// And matches records matching both operands
+type And struct {
+	Left, Right Node
+}
+
+func (n *And) Match(rec *catalog.Record) bool { return n.Left.Match(rec) && n.Right.Match(rec) }
+func (n *And) String() string                 { return "(" + n.Left.String() + " AND " + n.Right.String() + ")" }
+
+// Or matches records matching either operand
+type Or struct {
+	Left, Right Node
+}
+
+func (n *Or) Match(rec *catalog.Record) bool { return n.Left.Match(rec) || n.Right.Match(rec) }
+func (n *Or) String() string                 { return "(" + n.Left.String() + " OR " + n.Right.String() + ")" }
+
+// Not matches records not matching its operand
+type Not struct {
+	Operand Node
+}
+
+func (n *Not) Match(rec *catalog.Record) bool { return !n.Operand.Match(rec) }
+func (n *Not) String() string                 { return "NOT " + n.Operand.String() }
+
+// Term compares a field with a value
+type Term struct {
+	Field string
+	Op    Operator
+	Value string
+
+	match matcher
+}
+
+func (n *Term) Match(rec *catalog.Record) bool { return n.match(rec) }
+func (n *Term) String() string                 { return n.Field + string(n.Op) + fmt.Sprintf("%q", n.Value) }
+
+// Query is a parsed search query
+type Query struct {
+	Root Node // nil for an empty query
+}
+
+// Match reports whether the record satisfies the query. An empty query
+// matches every record.
+func (q *Query) Match(rec *catalog.Record) bool {
+	return q == nil || q.Root == nil || q.Root.Match(rec)
+}
+
+func (q *Query) String() string {
+	if q == nil || q.Root == nil {
+		return ""
+	}
+	return q.Root.String()
+}
+
+// Parse parses a query. Errors are *SyntaxError values locating the problem.
+//
+//	query   = or
+//	or      = and { "OR" and }
+//	and     = unary { [ "AND" ] unary }
+//	unary   = ( "NOT" | "-" ) unary | primary
+//	primary = "(" or ")" | field op value | value
+func Parse(input string) (*Query, error) {
+	if len(input) > MaxQueryLength {
+		return nil, &SyntaxError{Pos: MaxQueryLength + 1, Msg: fmt.Sprintf("query longer than %d bytes", MaxQueryLength)}
+	}
+
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return &Query{}, nil
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		if t.kind == tokRParen {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "unbalanced closing parenthesis"}
+		}
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + t.describe()}
+	}
+	return &Query{Root: root}, nil
+}
+
+// parser is a recursive descent parser over the token list
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Or{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokString, tokNot, tokLParen:
+			// implicit AND
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &And{Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{Operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, &SyntaxError{Pos: t.pos, Msg: "unclosed parenthesis"}
+		}
+		return node, nil
+	case tokString:
+		return p.term(t, defaultField, OpMatch, t.text)
+	case tokWord:
+		if p.peek().kind != tokOp {
+			return p.term(t, defaultField, OpMatch, t.text)
+		}
+		op := p.next()
+		value := p.next()
+		if value.kind != tokWord && value.kind != tokString {
+			return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("missing value after %s%s", t.text, op.text)}
+		}
+		return p.term(t, strings.ToLower(t.text), Operator(op.text), value.text)
+	case tokOp:
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("missing field name before %q", t.text)}
+	default:
+		return nil, &SyntaxError{Pos: t.pos, Msg: "unexpected " + t.describe()}
+	}
+}
+
+// term builds a field comparison, reporting errors at the field token
+func (p *parser) term(at token, field string, op Operator, value string) (Node, error) {
+	match, err := compileTerm(field, op, value)
+	if err != nil {
+		return nil, &SyntaxError{Pos: at.pos, Msg: err.Error()}
+	}
+	return &Term{Field: field, Op: op, Value: value, match: match}, nil
+}
@@ -0,0 +1,139 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "", want: ""},
+		{query: "potala", want: `name:"potala"`},
+		{query: `"summer trip"`, want: `name:"summer trip"`},
+		{query: "a b", want: `(name:"a" AND name:"b")`},
+		{query: "a OR b c", want: `(name:"a" OR (name:"b" AND name:"c"))`},
+		{query: "(a OR b) c", want: `((name:"a" OR name:"b") AND name:"c")`},
+		{query: "-type:png NOT NOT a", want: `(NOT type:"png" AND NOT NOT name:"a")`},
+		{query: "Size>=2MB", want: `size>="2MB"`},
+		{query: "uploaded>2026-01-01T10:00", want: `uploaded>"2026-01-01T10:00"`},
+		{query: "name:AND", want: `name:"AND"`},
+		{query: "(name:a)", want: `name:"a"`},
+		{query: `uploader:"bob \"b\""`, want: `uploader:"bob \"b\""`},
+		{query: "a-b", want: `name:"a-b"`},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+		msg   string
+	}{
+		{query: "(a OR b", pos: 1, msg: "unclosed parenthesis"},
+		{query: "a)", pos: 2, msg: "unbalanced closing parenthesis"},
+		{query: "a AND", pos: 6, msg: "unexpected end of query"},
+		{query: "OR a", pos: 1, msg: `unexpected "OR"`},
+		{query: ":x", pos: 1, msg: "missing field name"},
+		{query: "size>", pos: 6, msg: "missing value after size>"},
+		{query: "a !b", pos: 3, msg: "use != or NOT"},
+		{query: `name:"abc`, pos: 6, msg: "unterminated string"},
+		{query: "color:red", pos: 1, msg: `unknown field "color"`},
+		{query: "name:(a)", pos: 8, msg: "unbalanced closing parenthesis"},
+		{query: "x width>wide", pos: 3, msg: `invalid number "wide"`},
+		{query: "size>-1", pos: 1, msg: "invalid size"},
+		{query: "uploaded>yesterday", pos: 1, msg: "invalid date"},
+		{query: "orientation:round", pos: 1, msg: "invalid orientation"},
+		{query: "tag>a", pos: 1, msg: `operator ">" is not supported for field "tag"`},
+		{query: "name:[a", pos: 1, msg: "invalid pattern"},
+		{query: "type:.", pos: 1, msg: "missing file type"},
+		{query: strings.Repeat("a", MaxQueryLength+1), pos: MaxQueryLength + 1, msg: "query longer than"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.query)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q) error = %v, want *SyntaxError", tt.query, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos || !strings.Contains(syntaxErr.Msg, tt.msg) {
+			t.Errorf("Parse(%q) = %v, want %q at position %d", tt.query, err, tt.msg, tt.pos)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	taken := time.Date(2025, 7, 1, 12, 0, 0, 0, time.UTC)
+	rec := &catalog.Record{
+		Filename:   "trips/Potala.JPEG",
+		Size:       3 << 20,
+		MimeType:   "image/jpeg",
+		Width:      4000,
+		Height:     3000,
+		UploadedAt: time.Date(2026, 1, 15, 8, 30, 0, 0, time.UTC),
+		Uploader:   "alice",
+		Tags:       []string{"tibet"},
+		Meta:       &imagemeta.Metadata{Make: "Canon", Model: "EOS R5", TakenAt: &taken},
+	}
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{query: "", want: true},
+		{query: "potala", want: true},
+		{query: "name:*/potala.*", want: true},
+		{query: "name=potala", want: false},
+		{query: "type:jpg", want: true},
+		{query: "ext:.jpeg", want: true},
+		{query: "type!=png", want: true},
+		{query: "size>2MB", want: true},
+		{query: "size<=3m", want: true},
+		{query: "size>3MB", want: false},
+		{query: "width=4000 height:3000", want: true},
+		{query: "orientation:landscape", want: true},
+		{query: "-orientation:portrait", want: true},
+		{query: "uploaded:2026-01", want: true},
+		{query: "uploaded>2026-01-15", want: false},
+		{query: "uploaded>=2026-01-15", want: true},
+		{query: "uploaded<2026-01-15T08:30", want: false},
+		{query: "uploaded<=2026-01-15T08:30", want: true},
+		{query: "taken:2025", want: true},
+		{query: "modified>2000", want: false}, // zero times never match
+		{query: "camera:canon", want: true},
+		{query: "tag:tibet", want: true},
+		{query: "tag:nepal OR uploader=ALICE", want: true},
+		{query: "tag:nepal OR (uploader:bob AND potala)", want: false},
+		{query: "mime:png", want: false},
+	}
+
+	for _, tt := range tests {
+		q, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.query, err)
+			continue
+		}
+		if got := q.Match(rec); got != tt.want {
+			t.Errorf("%q matches = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+)
+
+// sortFields maps sortable field names to their comparison
+var sortFields = map[string]func(a, b *catalog.Record) int{
+	"name": func(a, b *catalog.Record) int { return strings.Compare(a.Filename, b.Filename) },
+	"type": func(a, b *catalog.Record) int {
+		return strings.Compare(normalizeExt(path.Ext(a.Filename)), normalizeExt(path.Ext(b.Filename)))
+	},
+	"size":     func(a, b *catalog.Record) int { return cmp.Compare(a.Size, b.Size) },
+	"width":    func(a, b *catalog.Record) int { return cmp.Compare(a.Width, b.Width) },
+	"height":   func(a, b *catalog.Record) int { return cmp.Compare(a.Height, b.Height) },
+	"uploaded": func(a, b *catalog.Record) int { return a.UploadedAt.Compare(b.UploadedAt) },
+	"modified": func(a, b *catalog.Record) int { return a.ModTime.Compare(b.ModTime) },
+	"taken":    func(a, b *catalog.Record) int { return takenAt(a).Compare(takenAt(b)) },
+}
+
+// sortAliases maps alternative names to sort fields
+var sortAliases = map[string]string{
+	"filename":    "name",
+	"mtime":       "modified",
+	"upload_time": "uploaded",
+	"uploaded_at": "uploaded",
+}
+
+// tiebreaker ends every order so records never compare equal
+const tiebreaker = "name"
+
+// SortKey orders records by one field
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Order is a list of sort keys, the first one deciding first
+type Order []SortKey
+
+// ParseSort parses a comma separated list of fields, each optionally
+// prefixed with - for descending order: "-size,name". The filename is
+// appended as the last key unless present, so the order is total and
+// stable across requests; an empty spec sorts by name.
+func ParseSort(spec string) (Order, error) {
+	var order Order
+
+	for _, part := range strings.Split(spec, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		key := SortKey{Field: strings.ToLower(strings.TrimSpace(part))}
+		if strings.HasPrefix(key.Field, "-") {
+			key.Field, key.Desc = key.Field[1:], true
+		} else {
+			key.Field = strings.TrimPrefix(key.Field, "+")
+		}
+		if field, ok := sortAliases[key.Field]; ok {
+			key.Field = field
+		}
+		if _, ok := sortFields[key.Field]; !ok {
+			return nil, fmt.Errorf("cannot sort by %q (supported: %s)", key.Field, strings.Join(sortFieldNames(), ", "))
+		}
+		order = append(order, key)
+	}
+
+	if !slices.ContainsFunc(order, func(k SortKey) bool { return k.Field == tiebreaker }) {
+		order = append(order, SortKey{Field: tiebreaker})
+	}
+	return order, nil
+}
+
+// String returns the canonical form of the order, as accepted by ParseSort
+func (o Order) String() string {
+	parts := make([]string, len(o))
+	for i, key := range o {
+		parts[i] = key.Field
+		if key.Desc {
+			parts[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// Compare returns -1, 0 or 1 as a sorts before, with or after b
+func (o Order) Compare(a, b *catalog.Record) int {
+	for _, key := range o {
+		c := sortFields[key.Field](a, b)
+		if key.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Sort orders records in place; records equal on every key keep their order
+func (o Order) Sort(records []catalog.Record) {
+	if len(o) == 0 {
+		return
+	}
+	slices.SortStableFunc(records, func(a, b catalog.Record) int {
+		return o.Compare(&a, &b)
+	})
+}
+
+// sortFieldNames returns the sortable field names, sorted
+func sortFieldNames() []string {
+	names := make([]string, 0, len(sortFields))
+	for name := range sortFields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,487 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gantoho/go-img-sys/internal/album"
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+)
+
+// 相册限制
+const (
+	MaxAlbumNameLength        = 100   // 相册名称的最大字符数
+	MaxAlbumDescriptionLength = 2000  // 相册描述的最大字符数
+	MaxAlbumImages            = 10000 // 单个相册的最大图片数
+)
+
+// AlbumUser 访问相册的用户，匿名访问时 Name 为空
+type AlbumUser struct {
+	Name  string
+	Admin bool
+}
+
+// canView 公开相册所有人可见，私有相册仅所有者和管理员可见
+func (u AlbumUser) canView(a *album.Album) bool {
+	return a.IsPublic() || u.canEdit(a)
+}
+
+// canEdit 只有所有者和管理员可以修改相册
+func (u AlbumUser) canEdit(a *album.Album) bool {
+	return u.Name != "" && (u.Admin || a.Owner == u.Name)
+}
+
+// AlbumParams 创建或修改相册的参数，修改时为 nil 的字段保持不变
+type AlbumParams struct {
+	Name        *string  `json:"name"`
+	Description *string  `json:"description"`
+	Cover       *string  `json:"cover"`
+	Visibility  *string  `json:"visibility"`
+	Images      []string `json:"images"` // 初始图片，仅创建时使用
+}
+
+// AlbumInfo 相册信息
+type AlbumInfo struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Visibility  string    `json:"visibility"`
+	Owner       string    `json:"owner,omitempty"`
+	Cover       string    `json:"cover,omitempty"`
+	CoverURL    string    `json:"cover_url,omitempty"`
+	ImageCount  int       `json:"image_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// AlbumDetail 相册详情，包括按顺序排列的图片文件名
+type AlbumDetail struct {
+	AlbumInfo
+	Images []string `json:"images"`
+}
+
+// AlbumImagesResult 向相册添加图片的结果
+type AlbumImagesResult struct {
+	Added    int          `json:"added"`
+	NotFound []string     `json:"not_found,omitempty"`
+	Album    *AlbumDetail `json:"album"`
+}
+
+// AlbumService 相册服务，相册按文件名引用图片
+type AlbumService struct {
+	logger  *logger.Logger
+	albums  *album.Store
+	catalog *catalog.Catalog
+	images  *ImageService
+}
+
+// NewAlbumService 创建相册服务
+func NewAlbumService() *AlbumService {
+	return &AlbumService{
+		logger:  logger.GetLogger(),
+		albums:  GetAlbums(),
+		catalog: GetCatalog(),
+		images:  NewImageService(),
+	}
+}
+
+// List 列出用户可见的相册，按名称排序
+func (s *AlbumService) List(hostURL string, user AlbumUser) []AlbumInfo {
+	result := make([]AlbumInfo, 0)
+	for _, a := range s.albums.All() {
+		if user.canView(&a) {
+			result = append(result, s.info(&a, hostURL))
+		}
+	}
+	return result
+}
+
+// Get 获取相册详情，包括按顺序排列的图片文件名
+func (s *AlbumService) Get(id, hostURL string, user AlbumUser) (*AlbumDetail, *errors.AppError) {
+	a, appErr := s.find(id, user)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	return s.detail(a, hostURL), nil
+}
+
+// Create 创建相册，创建者为所有者；可见性默认为公开
+func (s *AlbumService) Create(params AlbumParams, hostURL string, user AlbumUser) (*AlbumDetail, *errors.AppError) {
+	if params.Name == nil {
+		return nil, errors.NewError(http.StatusBadRequest, "album name is required")
+	}
+
+	a := album.Album{Owner: user.Name, Visibility: album.VisibilityPublic}
+	if appErr := s.apply(&a, params); appErr != nil {
+		return nil, appErr
+	}
+
+	names, notFound := s.resolveImages(params.Images)
+	if len(notFound) > 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "images not found: "+strings.Join(notFound, ", "))
+	}
+	if len(names) > MaxAlbumImages {
+		return nil, errors.NewError(http.StatusBadRequest, fmt.Sprintf("an album holds at most %d images", MaxAlbumImages))
+	}
+	a.Images = names
+
+	created, err := s.albums.Create(a)
+	if err != nil {
+		s.logger.Error("Failed to create album %s: %v", a.Name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to create album", err)
+	}
+
+	s.logger.Info("Album %s (%s) created by %s", created.ID, created.Name, user.Name)
+	return s.detail(&created, hostURL), nil
+}
+
+// Update 修改相册的名称、描述、封面或可见性
+func (s *AlbumService) Update(id string, params AlbumParams, hostURL string, user AlbumUser) (*AlbumDetail, *errors.AppError) {
+	return s.update(id, hostURL, user, func(a *album.Album) error {
+		if appErr := s.apply(a, params); appErr != nil {
+			return appErr
+		}
+		return nil
+	})
+}
+
+// Delete 删除相册，相册中的图片保留
+func (s *AlbumService) Delete(id string, user AlbumUser) *errors.AppError {
+	a, appErr := s.findEditable(id, user)
+	if appErr != nil {
+		return appErr
+	}
+
+	if err := s.albums.Delete(a.ID); err != nil {
+		if err == album.ErrNotFound {
+			return errors.ErrAlbumNotFound
+		}
+		s.logger.Error("Failed to delete album %s: %v", id, err)
+		return errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to delete album", err)
+	}
+
+	s.logger.Info("Album %s (%s) deleted by %s", a.ID, a.Name, user.Name)
+	return nil
+}
+
+// AddImages 向相册添加图片。position 为插入位置（从 0 开始），为 nil 时追加到末尾；
+// 指定位置时已在相册中的图片会被移动到该位置。不存在的图片记录在结果中。
+func (s *AlbumService) AddImages(id string, filenames []string, position *int, hostURL string, user AlbumUser) (*AlbumImagesResult, *errors.AppError) {
+	if len(filenames) == 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "no filenames provided")
+	}
+	if position != nil && *position < 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "position must not be negative")
+	}
+
+	names, notFound := s.resolveImages(filenames)
+	if len(names) == 0 {
+		return nil, errors.ErrFileNotFound
+	}
+
+	result := &AlbumImagesResult{NotFound: notFound}
+	info, appErr := s.update(id, hostURL, user, func(a *album.Album) error {
+		result.Added = 0
+		for _, name := range names {
+			if !a.Contains(name) {
+				result.Added++
+			}
+		}
+
+		if position == nil {
+			for _, name := range names {
+				if !a.Contains(name) {
+					a.Images = append(a.Images, name)
+				}
+			}
+		} else {
+			rest := slices.DeleteFunc(a.Images, func(name string) bool { return slices.Contains(names, name) })
+			a.Images = slices.Insert(rest, min(*position, len(rest)), names...)
+		}
+
+		if len(a.Images) > MaxAlbumImages {
+			return errors.NewError(http.StatusBadRequest, fmt.Sprintf("an album holds at most %d images", MaxAlbumImages))
+		}
+		return nil
+	})
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	result.Album = info
+	return result, nil
+}
+
+// RemoveImage 从相册移除图片，图片文件本身保留
+func (s *AlbumService) RemoveImage(id, filename, hostURL string, user AlbumUser) (*AlbumDetail, *errors.AppError) {
+	return s.update(id, hostURL, user, func(a *album.Album) error {
+		if !a.Contains(filename) {
+			return errors.NewError(http.StatusNotFound, "image is not in the album")
+		}
+		a.Images = slices.DeleteFunc(a.Images, func(name string) bool { return name == filename })
+		if a.Cover == filename {
+			a.Cover = ""
+		}
+		return nil
+	})
+}
+
+// SetImages 以给定顺序替换相册中的全部图片，用于手动排序
+func (s *AlbumService) SetImages(id string, filenames []string, hostURL string, user AlbumUser) (*AlbumDetail, *errors.AppError) {
+	names, notFound := s.resolveImages(filenames)
+	if len(notFound) > 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "images not found: "+strings.Join(notFound, ", "))
+	}
+	if len(names) > MaxAlbumImages {
+		return nil, errors.NewError(http.StatusBadRequest, fmt.Sprintf("an album holds at most %d images", MaxAlbumImages))
+	}
+
+	return s.update(id, hostURL, user, func(a *album.Album) error {
+		a.Images = names
+		return nil
+	})
+}
+
+// Images 分页列出相册中的图片。未指定排序时按相册中的手动顺序按页码分页；
+// 指定 sort 时与图片列表一样排序并支持游标。
+func (s *AlbumService) Images(id, hostURL string, user AlbumUser, opts PageOptions) (*PaginatedImageData, *errors.AppError) {
+	a, appErr := s.find(id, user)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	records := s.records(a)
+	if opts.Sort != "" {
+		return s.images.paginate(records, hostURL, opts)
+	}
+	if opts.Cursor != "" {
+		return nil, errors.NewError(http.StatusBadRequest, "cursor requires a sort order; album order pages by page number")
+	}
+
+	if opts.PageSize < 1 || opts.PageSize > 100 {
+		opts.PageSize = 20
+	}
+	total := len(records)
+	result := &PaginatedImageData{
+		Total:    total,
+		PageSize: opts.PageSize,
+		Pages:    (total + opts.PageSize - 1) / opts.PageSize,
+	}
+	result.Page = max(1, min(opts.Page, result.Pages))
+	start := min((result.Page-1)*opts.PageSize, total)
+	end := min(start+opts.PageSize, total)
+
+	result.Data = make([]ImageMetaData, 0, end-start)
+	for _, rec := range records[start:end] {
+		result.Data = append(result.Data, newImageMetaData(rec, hostURL))
+	}
+	return result, nil
+}
+
+// RandomImage 随机返回相册中的一张图片文件名
+func (s *AlbumService) RandomImage(id string, user AlbumUser) (string, *errors.AppError) {
+	a, appErr := s.find(id, user)
+	if appErr != nil {
+		return "", appErr
+	}
+
+	records := s.records(a)
+	if len(records) == 0 {
+		return "", errors.ErrNoFiles
+	}
+	return records[rand.Intn(len(records))].Filename, nil
+}
+
+// Export 按相册顺序将相册中的图片导出为ZIP，保存在 File.ExportDir 中
+func (s *AlbumService) Export(id string, user AlbumUser) (*ExportResult, *errors.AppError) {
+	a, appErr := s.find(id, user)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	records := s.records(a)
+	if len(records) == 0 {
+		return nil, errors.ErrNoFiles
+	}
+	filenames := make([]string, 0, len(records))
+	for _, rec := range records {
+		filenames = append(filenames, rec.Filename)
+	}
+
+	exportService := NewExportService()
+	result, err := exportService.ExportAlbum(a.ID, filenames, exportService.ExportDir())
+	if err != nil {
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "export failed", err)
+	}
+	return result, nil
+}
+
+// find 查找用户可见的相册；对无权查看的私有相册同样返回不存在
+func (s *AlbumService) find(id string, user AlbumUser) (*album.Album, *errors.AppError) {
+	a, ok := s.albums.Get(id)
+	if !ok || !user.canView(&a) {
+		return nil, errors.ErrAlbumNotFound
+	}
+	return &a, nil
+}
+
+// findEditable 查找用户可以修改的相册
+func (s *AlbumService) findEditable(id string, user AlbumUser) (*album.Album, *errors.AppError) {
+	a, appErr := s.find(id, user)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if !user.canEdit(a) {
+		return nil, errors.NewError(http.StatusForbidden, "only the owner can modify the album")
+	}
+	return a, nil
+}
+
+// update 检查权限后修改相册并返回修改后的相册详情
+func (s *AlbumService) update(id, hostURL string, user AlbumUser, fn func(a *album.Album) error) (*AlbumDetail, *errors.AppError) {
+	if _, appErr := s.findEditable(id, user); appErr != nil {
+		return nil, appErr
+	}
+
+	updated, err := s.albums.Update(id, fn)
+	switch e := err.(type) {
+	case nil:
+	case *errors.AppError:
+		return nil, e
+	default:
+		if err == album.ErrNotFound {
+			return nil, errors.ErrAlbumNotFound
+		}
+		s.logger.Error("Failed to update album %s: %v", id, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to update album", err)
+	}
+
+	return s.detail(&updated, hostURL), nil
+}
+
+// apply 校验参数并写入相册
+func (s *AlbumService) apply(a *album.Album, params AlbumParams) *errors.AppError {
+	if params.Name != nil {
+		name := strings.TrimSpace(*params.Name)
+		if name == "" {
+			return errors.NewError(http.StatusBadRequest, "album name must not be empty")
+		}
+		if utf8.RuneCountInString(name) > MaxAlbumNameLength {
+			return errors.NewError(http.StatusBadRequest, fmt.Sprintf("album name is longer than %d characters", MaxAlbumNameLength))
+		}
+		a.Name = name
+	}
+
+	if params.Description != nil {
+		description := strings.TrimSpace(*params.Description)
+		if utf8.RuneCountInString(description) > MaxAlbumDescriptionLength {
+			return errors.NewError(http.StatusBadRequest, fmt.Sprintf("album description is longer than %d characters", MaxAlbumDescriptionLength))
+		}
+		a.Description = description
+	}
+
+	if params.Visibility != nil {
+		switch visibility := strings.ToLower(strings.TrimSpace(*params.Visibility)); visibility {
+		case album.VisibilityPublic, album.VisibilityPrivate:
+			a.Visibility = visibility
+		default:
+			return errors.NewError(http.StatusBadRequest, "visibility must be public or private")
+		}
+	}
+
+	if params.Cover != nil {
+		a.Cover = ""
+		if *params.Cover != "" {
+			names, notFound := s.resolveImages([]string{*params.Cover})
+			if len(notFound) > 0 {
+				return errors.NewError(http.StatusBadRequest, "cover image not found")
+			}
+			a.Cover = names[0]
+		}
+	}
+
+	return nil
+}
+
+// resolveImages 校验文件名并去重，返回存在的图片名称及不存在的文件名
+func (s *AlbumService) resolveImages(filenames []string) (names, notFound []string) {
+	names = make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		name, appErr := imageName(filename)
+		if appErr == nil {
+			if _, ok := s.catalog.Get(name); !ok {
+				appErr = errors.ErrFileNotFound
+			}
+		}
+		if appErr != nil {
+			notFound = append(notFound, filename)
+			continue
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, notFound
+}
+
+// records 按相册顺序返回相册中仍然存在的图片记录
+func (s *AlbumService) records(a *album.Album) []catalog.Record {
+	records := make([]catalog.Record, 0, len(a.Images))
+	for _, name := range a.Images {
+		if rec, ok := s.catalog.Get(name); ok {
+			records = append(records, rec)
+		}
+	}
+	return records
+}
+
+// info 构建相册信息；未设置封面或封面已删除时使用第一张图片
+func (s *AlbumService) info(a *album.Album, hostURL string) AlbumInfo {
+	return s.newInfo(a, s.records(a), hostURL)
+}
+
+// detail 构建相册详情
+func (s *AlbumService) detail(a *album.Album, hostURL string) *AlbumDetail {
+	records := s.records(a)
+
+	detail := &AlbumDetail{
+		AlbumInfo: s.newInfo(a, records, hostURL),
+		Images:    make([]string, 0, len(records)),
+	}
+	for _, rec := range records {
+		detail.Images = append(detail.Images, rec.Filename)
+	}
+	return detail
+}
+
+// newInfo 由相册及其现有图片构建相册信息
+func (s *AlbumService) newInfo(a *album.Album, records []catalog.Record, hostURL string) AlbumInfo {
+	info := AlbumInfo{
+		ID:          a.ID,
+		Name:        a.Name,
+		Description: a.Description,
+		Visibility:  a.Visibility,
+		Owner:       a.Owner,
+		ImageCount:  len(records),
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+	}
+
+	if _, ok := s.catalog.Get(a.Cover); ok && a.Cover != "" {
+		info.Cover = a.Cover
+	} else if len(records) > 0 {
+		info.Cover = records[0].Filename
+	}
+	if info.Cover != "" {
+		info.CoverURL = hostURL + "/f/" + info.Cover
+	}
+	return info
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/album"
+	"github.com/gantoho/go-img-sys/internal/blobs"
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/trash"
+	"github.com/gantoho/go-img-sys/internal/uploads"
+	"github.com/gantoho/go-img-sys/internal/versions"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	databaseMu       sync.Mutex
+	databaseInstance *bolt.DB
+	catalogInstance  *catalog.Catalog
+	albumsInstance   *album.Store
+	trashInstance    *trash.Store
+	versionsInstance *versions.Store
+	blobsInstance    *blobs.Index
+	uploadsInstance  *uploads.Store
+)
+
+// InitDatabase opens the embedded database configured in DatabaseConfig and
+// loads the image catalog, albums, trash, versions, the blob index and the
+// resumable uploads from it. An empty path keeps everything in memory.
+func InitDatabase(cfg *config.Config) (*catalog.Catalog, error) {
+	var db *bolt.DB
+
+	if cfg.Database.Path != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.Database.Path), 0755); err != nil {
+			return nil, err
+		}
+
+		var err error
+		db, err = bolt.Open(cfg.Database.Path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	cat, err := catalog.Open(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	albums, err := album.Open(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	trashStore, err := trash.Open(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	versionStore, err := versions.Open(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	blobIndex, err := blobs.OpenIndex(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	uploadStore, err := uploads.Open(db)
+	if err != nil {
+		if db != nil {
+			db.Close()
+		}
+		return nil, err
+	}
+
+	databaseMu.Lock()
+	databaseInstance = db
+	catalogInstance = cat
+	albumsInstance = albums
+	trashInstance = trashStore
+	versionsInstance = versionStore
+	blobsInstance = blobIndex
+	uploadsInstance = uploadStore
+	databaseMu.Unlock()
+
+	return cat, nil
+}
+
+// GetDatabase returns the shared database, nil when running in memory
+func GetDatabase() *bolt.DB {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+	return databaseInstance
+}
+
+// GetCatalog returns the shared image catalog, falling back to an
+// in-memory catalog if InitDatabase was never called
+func GetCatalog() *catalog.Catalog {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if catalogInstance == nil {
+		catalogInstance, _ = catalog.Open(nil)
+	}
+	return catalogInstance
+}
+
+// GetAlbums returns the shared album store, falling back to an in-memory
+// store if InitDatabase was never called
+func GetAlbums() *album.Store {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if albumsInstance == nil {
+		albumsInstance, _ = album.Open(nil)
+	}
+	return albumsInstance
+}
+
+// GetTrash returns the shared trash store, falling back to an in-memory
+// store if InitDatabase was never called
+func GetTrash() *trash.Store {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if trashInstance == nil {
+		trashInstance, _ = trash.Open(nil)
+	}
+	return trashInstance
+}
+
+// GetVersions returns the shared version store, falling back to an
+// in-memory store if InitDatabase was never called
+func GetVersions() *versions.Store {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if versionsInstance == nil {
+		versionsInstance, _ = versions.Open(nil)
+	}
+	return versionsInstance
+}
+
+// GetBlobIndex returns the shared blob index, falling back to an in-memory
+// index if InitDatabase was never called
+func GetBlobIndex() *blobs.Index {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if blobsInstance == nil {
+		blobsInstance, _ = blobs.OpenIndex(nil)
+	}
+	return blobsInstance
+}
+
+// GetUploads returns the shared store of resumable uploads, falling back to
+// an in-memory store if InitDatabase was never called
+func GetUploads() *uploads.Store {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if uploadsInstance == nil {
+		uploadsInstance, _ = uploads.Open(nil)
+	}
+	return uploadsInstance
+}
+
+// CloseDatabase closes the shared database
+func CloseDatabase() error {
+	databaseMu.Lock()
+	defer databaseMu.Unlock()
+
+	if databaseInstance == nil {
+		return nil
+	}
+	err := databaseInstance.Close()
+	databaseInstance = nil
+	return err
+}
+
+// ReconcileCatalog synchronizes the catalog with the storage content
+func ReconcileCatalog() (*catalog.ReconcileResult, error) {
+	return GetCatalog().Reconcile(GetStorage(), isCatalogName)
+}
+
+// isCatalogName reports whether a storage object is an image tracked by the catalog
+func isCatalogName(name string) bool {
+	return !isHiddenName(name) && !isThumbnailName(name) && utils.IsValidImageFormat(name)
+}
@@ -2,28 +2,31 @@ package service
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	"github.com/gantoho/go-img-sys/internal/config"
 	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
 )
 
 // ExportService 导出服务
 type ExportService struct {
-	config *config.Config
-	logger *logger.Logger
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
 }
 
 // NewExportService 创建导出服务
 func NewExportService() *ExportService {
 	return &ExportService{
-		config: config.GetConfig(),
-		logger: logger.GetLogger(),
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
 	}
 }
 
@@ -36,15 +39,38 @@ type ExportResult struct {
 	Compressed bool   `json:"compressed"`
 }
 
+// ExportDir 返回导出的ZIP文件所在的本地目录（File.ExportDir）
+func (e *ExportService) ExportDir() string {
+	return e.config.File.ExportDir
+}
+
 // ExportMultipleFiles 导出多个文件为ZIP
 func (e *ExportService) ExportMultipleFiles(filenames []string, outputDir string) (*ExportResult, error) {
+	return e.ExportFilesContext(context.Background(), filenames, outputDir, nil)
+}
+
+// ExportFilesContext 导出多个文件为ZIP，ctx 取消时中止并删除未完成的ZIP；
+// 每处理完一个文件调用一次 progress（可为 nil）
+func (e *ExportService) ExportFilesContext(ctx context.Context, filenames []string, outputDir string, progress func()) (*ExportResult, error) {
+	return e.exportZip(ctx, "export_"+getCurrentTimestamp()+".zip", filenames, outputDir, progress)
+}
+
+// ExportAlbum 按给定顺序导出相册中的图片为ZIP，ZIP文件名包含相册ID
+func (e *ExportService) ExportAlbum(albumID string, filenames []string, outputDir string) (*ExportResult, error) {
+	return e.exportZip(context.Background(), "album_"+albumID+"_"+getCurrentTimestamp()+".zip", filenames, outputDir, nil)
+}
+
+// exportZip 将文件写入 outputDir 下名为 zipName 的ZIP
+func (e *ExportService) exportZip(ctx context.Context, zipName string, filenames []string, outputDir string, progress func()) (result *ExportResult, err error) {
 	if len(filenames) == 0 {
 		e.logger.Warn("No files to export")
 		return nil, fmt.Errorf("no files provided")
 	}
 
-	// 生成ZIP文件名
-	zipName := "export_" + getCurrentTimestamp() + ".zip"
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		e.logger.Error("Failed to create export directory: %v", err)
+		return nil, err
+	}
 	zipPath := filepath.Join(outputDir, zipName)
 
 	// 创建ZIP文件
@@ -58,93 +84,119 @@ func (e *ExportService) ExportMultipleFiles(filenames []string, outputDir string
 	zipWriter := zip.NewWriter(zipFile)
 	defer zipWriter.Close()
 
-	result := &ExportResult{
+	defer func() {
+		if err != nil {
+			zipWriter.Close()
+			zipFile.Close()
+			os.Remove(zipPath)
+		}
+	}()
+
+	result = &ExportResult{
 		ZipPath: zipPath,
 	}
 
-	uploadDir := e.config.File.UploadDir
-
 	for _, filename := range filenames {
-		filePath := filepath.Join(uploadDir, filename)
-
-		// 安全检查：防止路径遍历
-		absPath, _ := filepath.Abs(filePath)
-		absUploadDir, _ := filepath.Abs(uploadDir)
-		if !strings.HasPrefix(absPath, absUploadDir) {
-			e.logger.Warn("Invalid file path: %s", filePath)
-			continue
+		if err := ctx.Err(); err != nil {
+			e.logger.Warn("Export canceled: %s", zipPath)
+			return nil, err
 		}
-
-		// 检查文件是否存在
-		fileInfo, err := os.Stat(filePath)
-		if err != nil || fileInfo.IsDir() {
-			e.logger.Warn("File not found or is directory: %s", filePath)
-			continue
+		if size, ok := e.addToZip(zipWriter, filename); ok {
+			result.FileCount++
+			result.TotalSize += size
 		}
-
-		// 打开文件
-		file, err := os.Open(filePath)
-		if err != nil {
-			e.logger.Error("Failed to open file %s: %v", filePath, err)
-			continue
+		if progress != nil {
+			progress()
 		}
+	}
 
-		// 添加到ZIP
-		header, err := zip.FileInfoHeader(fileInfo)
-		if err != nil {
-			file.Close()
-			continue
-		}
+	result.SizeStr = getFileSizeStr(result.TotalSize)
+	result.Compressed = true
 
-		header.Name = filename
-		header.Method = zip.Deflate
+	e.logger.Info("Export completed: %s (files: %d, size: %s)", zipPath, result.FileCount, result.SizeStr)
 
-		writer, err := zipWriter.CreateHeader(header)
-		if err != nil {
-			file.Close()
-			continue
-		}
+	return result, nil
+}
 
-		_, err = io.Copy(writer, file)
-		file.Close()
+// addToZip 将单个文件写入ZIP，返回文件大小及是否成功
+func (e *ExportService) addToZip(zipWriter *zip.Writer, filename string) (int64, bool) {
+	// 安全检查：防止路径遍历
+	name, err := storage.CleanName(filename)
+	if err != nil {
+		e.logger.Warn("Invalid file path: %s", filename)
+		return 0, false
+	}
 
-		if err == nil {
-			result.FileCount++
-			result.TotalSize += fileInfo.Size()
-			e.logger.Info("File added to zip: %s", filename)
-		}
+	// 缩略图与内部文件（回收站、历史版本等）不可导出
+	if isHiddenName(name) || isThumbnailName(name) {
+		e.logger.Warn("File not exportable: %s", name)
+		return 0, false
 	}
 
-	result.SizeStr = getFileSizeStr(result.TotalSize)
-	result.Compressed = true
+	// 检查文件是否存在
+	fileInfo, err := e.storage.Stat(name)
+	if err != nil || fileInfo.IsDir {
+		e.logger.Warn("File not found or is directory: %s", name)
+		return 0, false
+	}
 
-	e.logger.Info("Export completed: %s (files: %d, size: %s)", zipPath, result.FileCount, result.SizeStr)
+	// 打开文件
+	file, err := e.storage.Get(name)
+	if err != nil {
+		e.logger.Error("Failed to open file %s: %v", name, err)
+		return 0, false
+	}
+	defer file.Close()
 
-	return result, nil
+	// 添加到ZIP
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: fileInfo.ModTime,
+	}
+
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return 0, false
+	}
+
+	if _, err := io.Copy(writer, file); err != nil {
+		return 0, false
+	}
+
+	e.logger.Info("File added to zip: %s", name)
+	return fileInfo.Size, true
 }
 
 // ExportAllFiles 导出所有文件
 func (e *ExportService) ExportAllFiles(outputDir string) (*ExportResult, error) {
-	uploadDir := e.config.File.UploadDir
+	filenames, err := e.exportableFiles()
+	if err != nil {
+		return nil, err
+	}
 
+	return e.ExportMultipleFiles(filenames, outputDir)
+}
+
+// exportableFiles 列出可导出的文件
+func (e *ExportService) exportableFiles() ([]string, error) {
 	// 获取所有文件
-	var filenames []string
-	filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
+	files, err := e.storage.List("", true)
+	if err != nil {
+		e.logger.Error("Failed to list files: %v", err)
+		return nil, err
+	}
 
-		// 忽略缩略图
-		if strings.Contains(path, "thumbs") {
-			return nil
+	var filenames []string
+	for _, file := range files {
+		// 忽略缩略图和内部文件
+		if isThumbnailName(file.Name) || isHiddenName(file.Name) {
+			continue
 		}
+		filenames = append(filenames, file.Name)
+	}
 
-		rel, _ := filepath.Rel(uploadDir, path)
-		filenames = append(filenames, rel)
-		return nil
-	})
-
-	return e.ExportMultipleFiles(filenames, outputDir)
+	return filenames, nil
 }
 
 // getCurrentTimestamp 获取当前时间戳格式字符串
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/trash"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// 文件夹限制
+const (
+	MaxFolderNameLength = 255 // 单级文件夹名称的最大字符数
+	MaxFolderDepth      = 32  // 文件夹的最大层级
+)
+
+// folderMarker 标记空文件夹的隐藏对象，使文件夹在所有存储后端（包括没有目录概念的 S3）中存在
+const folderMarker = ".folder"
+
+// FolderInfo 文件夹信息，ImageCount 包括所有子文件夹中的图片
+type FolderInfo struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	ImageCount int    `json:"image_count"`
+}
+
+// FolderListing 文件夹内容
+type FolderListing struct {
+	Path      string              `json:"path"` // 根目录为空
+	Recursive bool                `json:"recursive"`
+	Folders   []FolderInfo        `json:"folders"`
+	Images    *PaginatedImageData `json:"images"`
+}
+
+// FolderDeleteResult 删除文件夹的结果
+type FolderDeleteResult struct {
+	Path          string `json:"path"`
+	ImagesDeleted int    `json:"images_deleted"`
+	FilesDeleted  int    `json:"files_deleted"`
+}
+
+// FolderService 文件夹服务。文件夹即存储中的路径前缀，图片名称为相对上传目录的路径
+type FolderService struct {
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
+	catalog *catalog.Catalog
+}
+
+// NewFolderService 创建文件夹服务
+func NewFolderService() *FolderService {
+	return &FolderService{
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
+		catalog: GetCatalog(),
+	}
+}
+
+// CleanFolder 规范化文件夹路径，空字符串或 "/" 表示根目录。
+// 拒绝逃出上传目录的路径、隐藏名称以及缩略图目录。
+func CleanFolder(folder string) (string, *errors.AppError) {
+	folder = strings.Trim(strings.ReplaceAll(folder, "\\", "/"), "/")
+	if folder == "" {
+		return "", nil
+	}
+
+	name, err := storage.CleanName(folder)
+	if err != nil {
+		return "", errors.NewError(http.StatusBadRequest, "invalid folder path")
+	}
+
+	parts := strings.Split(name, "/")
+	if len(parts) > MaxFolderDepth {
+		return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("folders can be nested at most %d levels deep", MaxFolderDepth))
+	}
+	for _, part := range parts {
+		if strings.HasPrefix(part, ".") {
+			return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("folder name %q must not start with a dot", part))
+		}
+		if utf8.RuneCountInString(part) > MaxFolderNameLength {
+			return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("folder name is longer than %d characters", MaxFolderNameLength))
+		}
+		if strings.IndexFunc(part, unicode.IsControl) >= 0 {
+			return "", errors.NewError(http.StatusBadRequest, "folder name contains control characters")
+		}
+	}
+	if isThumbnailName(name) {
+		return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("%q is reserved for thumbnails", thumbnailDir))
+	}
+	return name, nil
+}
+
+// Resolve 校验文件夹路径并确认文件夹存在，用于上传到文件夹
+func (s *FolderService) Resolve(folder string) (string, *errors.AppError) {
+	name, appErr := CleanFolder(folder)
+	if appErr != nil {
+		return "", appErr
+	}
+	if name != "" && !s.exists(name) {
+		return "", errors.ErrFolderNotFound
+	}
+	return name, nil
+}
+
+// Create 创建文件夹（包括不存在的上级文件夹）
+func (s *FolderService) Create(folder string) (*FolderInfo, *errors.AppError) {
+	name, appErr := CleanFolder(folder)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if name == "" {
+		return nil, errors.NewError(http.StatusBadRequest, "folder path is required")
+	}
+	if s.exists(name) || s.isFile(name) {
+		return nil, errors.ErrFolderExists
+	}
+
+	if _, err := s.storage.Put(name+"/"+folderMarker, bytes.NewReader(nil)); err != nil {
+		s.logger.Error("Failed to create folder %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to create folder", err)
+	}
+
+	s.logger.Info("Folder created: %s", name)
+	return &FolderInfo{Path: name, Name: path.Base(name)}, nil
+}
+
+// List 列出文件夹中的子文件夹和图片。recursive 为 false 时只返回直接子项，
+// 为 true 时返回所有层级的子文件夹和图片；图片按 opts 分页。
+func (s *FolderService) List(folder, hostURL string, recursive bool, opts PageOptions) (*FolderListing, *errors.AppError) {
+	name, appErr := s.Resolve(folder)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	folders, err := s.subfolders(name)
+	if err != nil {
+		s.logger.Error("Failed to list folder %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to list folder", err)
+	}
+
+	// 统计每个子文件夹（含所有层级）中的图片数量
+	counts := make(map[string]int)
+	records := s.catalog.Find(func(rec *catalog.Record) bool {
+		if !inFolder(rec.Filename, name) {
+			return false
+		}
+		for dir := path.Dir(rec.Filename); dir != "." && dir != name; dir = path.Dir(dir) {
+			counts[dir]++
+		}
+		return recursive || parentFolder(rec.Filename) == name
+	})
+
+	result := &FolderListing{
+		Path:      name,
+		Recursive: recursive,
+		Folders:   make([]FolderInfo, 0),
+	}
+	for _, dir := range folders {
+		if recursive || parentFolder(dir) == name {
+			result.Folders = append(result.Folders, FolderInfo{Path: dir, Name: path.Base(dir), ImageCount: counts[dir]})
+		}
+	}
+
+	result.Images, appErr = NewImageService().paginate(records, hostURL, opts)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return result, nil
+}
+
+// Move 重命名或移动文件夹及其全部内容（包括缩略图），图片的标签、相册引用随之更新
+func (s *FolderService) Move(folder, destination string) (*FolderInfo, *errors.AppError) {
+	from, appErr := CleanFolder(folder)
+	if appErr != nil {
+		return nil, appErr
+	}
+	to, appErr := CleanFolder(destination)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if from == "" || to == "" {
+		return nil, errors.NewError(http.StatusBadRequest, "the root folder cannot be moved or replaced")
+	}
+	if from == to {
+		return nil, errors.NewError(http.StatusBadRequest, "destination is the same folder")
+	}
+	if inFolder(to, from) {
+		return nil, errors.NewError(http.StatusBadRequest, "a folder cannot be moved into itself")
+	}
+	if !s.exists(from) {
+		return nil, errors.ErrFolderNotFound
+	}
+	if s.exists(to) || s.isFile(to) {
+		return nil, errors.ErrFolderExists
+	}
+
+	objects, err := s.storage.List(from, true)
+	if err != nil {
+		s.logger.Error("Failed to list folder %s: %v", from, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to list folder", err)
+	}
+	for _, obj := range objects {
+		newName := to + strings.TrimPrefix(obj.Name, from)
+		if err := s.storage.Rename(obj.Name, newName); err != nil {
+			s.logger.Error("Failed to move %s to %s: %v", obj.Name, newName, err)
+			return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to move folder", err)
+		}
+		if isCatalogName(obj.Name) {
+			if err := renameImage(s.catalog, obj.Name, newName); err != nil {
+				s.logger.Error("Failed to rename %s in catalog: %v", obj.Name, err)
+			}
+		}
+	}
+
+	// 缩略图在 thumbs/ 下保持相同的目录结构
+	thumbs, _ := s.storage.List(thumbnailName(from), true)
+	for _, obj := range thumbs {
+		newName := thumbnailName(to) + strings.TrimPrefix(obj.Name, thumbnailName(from))
+		if err := s.storage.Rename(obj.Name, newName); err != nil {
+			s.logger.Warn("Failed to move thumbnail %s: %v", obj.Name, err)
+		}
+	}
+
+	s.removeDirs(from, objects)
+	s.removeDirs(thumbnailName(from), thumbs)
+
+	s.logger.Info("Folder moved: %s -> %s (%d objects)", from, to, len(objects))
+	return &FolderInfo{Path: to, Name: path.Base(to), ImageCount: s.countImages(to)}, nil
+}
+
+// Delete 删除文件夹。非空文件夹需要 recursive 为 true，此时删除其中的全部图片、
+// 缩略图和子文件夹，图片从目录和相册中移除。
+func (s *FolderService) Delete(folder string, recursive bool, user string) (*FolderDeleteResult, *errors.AppError) {
+	name, appErr := CleanFolder(folder)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if name == "" {
+		return nil, errors.NewError(http.StatusBadRequest, "the root folder cannot be deleted")
+	}
+	if !s.exists(name) {
+		return nil, errors.ErrFolderNotFound
+	}
+
+	objects, err := s.storage.List(name, true)
+	if err != nil {
+		s.logger.Error("Failed to list folder %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to list folder", err)
+	}
+	if !recursive {
+		for _, obj := range objects {
+			if path.Base(obj.Name) != folderMarker {
+				return nil, errors.NewError(http.StatusConflict, "folder is not empty, use recursive=true to delete its content")
+			}
+		}
+	}
+
+	result := &FolderDeleteResult{Path: name}
+	trashService := NewTrashService()
+	for _, obj := range objects {
+		if isCatalogName(obj.Name) {
+			if err := trashService.Discard(obj.Name, user, trash.ReasonFolder); err != nil {
+				s.logger.Error("Failed to delete %s: %v", obj.Name, err)
+				return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to delete folder", err)
+			}
+			result.ImagesDeleted++
+			continue
+		}
+		if err := s.storage.Delete(obj.Name); err != nil && !storage.IsNotExist(err) {
+			s.logger.Error("Failed to delete %s: %v", obj.Name, err)
+			return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to delete folder", err)
+		}
+		result.FilesDeleted++
+	}
+
+	thumbs, _ := s.storage.List(thumbnailName(name), true)
+	for _, obj := range thumbs {
+		if err := s.storage.Delete(obj.Name); err != nil && !storage.IsNotExist(err) {
+			s.logger.Warn("Failed to delete thumbnail %s: %v", obj.Name, err)
+		}
+	}
+
+	s.removeDirs(name, objects)
+	s.removeDirs(thumbnailName(name), thumbs)
+
+	s.logger.Info("Folder deleted: %s (%d images)", name, result.ImagesDeleted)
+	return result, nil
+}
+
+// exists 判断文件夹是否存在：文件夹中有任何对象（包括空文件夹标记）
+func (s *FolderService) exists(folder string) bool {
+	if s.isFile(folder) {
+		return false
+	}
+	objects, err := s.storage.List(folder, true)
+	return err == nil && len(objects) > 0
+}
+
+// isFile 判断路径是否为已存在的文件
+func (s *FolderService) isFile(name string) bool {
+	info, err := s.storage.Stat(name)
+	return err == nil && !info.IsDir
+}
+
+// subfolders 返回文件夹下所有层级的子文件夹，按路径排序。
+// 子文件夹由其中的对象推导，忽略隐藏目录和缩略图目录。
+func (s *FolderService) subfolders(folder string) ([]string, error) {
+	objects, err := s.storage.List(folder, true)
+	if err != nil {
+		if folder == "" || storage.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		if isThumbnailName(obj.Name) {
+			continue
+		}
+		for dir := path.Dir(obj.Name); dir != "." && dir != folder; dir = path.Dir(dir) {
+			if isHiddenName(dir) {
+				break
+			}
+			seen[dir] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs, nil
+}
+
+// countImages 统计文件夹下所有层级的图片数量
+func (s *FolderService) countImages(folder string) int {
+	return len(s.catalog.Find(func(rec *catalog.Record) bool { return inFolder(rec.Filename, folder) }))
+}
+
+// removeDirs 删除移动或删除对象后留下的空目录（仅对本地存储有效，其他后端没有目录）
+func (s *FolderService) removeDirs(folder string, objects []storage.FileInfo) {
+	seen := map[string]bool{folder: true}
+	for _, obj := range objects {
+		for dir := path.Dir(obj.Name); dir != "." && inFolder(dir, folder); dir = path.Dir(dir) {
+			seen[dir] = true
+		}
+	}
+
+	dirs := make([]string, 0, len(seen))
+	for dir := range seen {
+		dirs = append(dirs, dir)
+	}
+	// 先删除最深的目录，上级目录才会为空
+	sort.Slice(dirs, func(i, j int) bool { return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/") })
+	for _, dir := range dirs {
+		s.storage.Delete(dir)
+	}
+}
+
+// inFolder 判断名称是否位于文件夹内（任意层级），根目录包含所有名称
+func inFolder(name, folder string) bool {
+	return folder == "" || strings.HasPrefix(name, folder+"/")
+}
+
+// parentFolder 返回名称所在的文件夹，根目录为空
+func parentFolder(name string) string {
+	if dir := path.Dir(name); dir != "." {
+		return dir
+	}
+	return ""
+}
@@ -1,16 +1,34 @@
 package service
 
 import (
-	"math/rand"
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
 	"mime/multipart"
+	"net/http"
 	"os"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/gantoho/go-img-sys/internal/catalog"
 	"github.com/gantoho/go-img-sys/internal/config"
-	"github.com/gantoho/go-img-sys/pkg/cache"
+	"github.com/gantoho/go-img-sys/internal/search"
+	"github.com/gantoho/go-img-sys/internal/trash"
 	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+	"github.com/gantoho/go-img-sys/pkg/imageutil"
 	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
 	"github.com/gantoho/go-img-sys/pkg/utils"
 )
 
@@ -20,235 +38,307 @@ type ImageData struct {
 }
 
 type ImageMetaData struct {
+	Filename    string   `json:"filename"`
+	URL         string   `json:"url"`
+	Size        int64    `json:"size"`
+	SizeStr     string   `json:"size_str"`
+	MimeType    string   `json:"mime_type"`
+	ModTime     int64    `json:"mod_time"`
+	Width       int      `json:"width"`
+	Height      int      `json:"height"`
+	AspectRatio float64  `json:"aspect_ratio,omitempty"`
+	Orientation string   `json:"orientation,omitempty"` // landscape, portrait or square
+	Tags        []string `json:"tags,omitempty"`
+	// OriginalName is the uploaded name of an image stored under another one
+	OriginalName string `json:"original_name,omitempty"`
+	// Aliases are later uploads of the same content, see catalog.Alias
+	Aliases []catalog.Alias `json:"aliases,omitempty"`
+	// Exif is only included on request
+	Exif *imagemeta.Metadata `json:"exif,omitempty"`
+}
+
+// selectableFields are the ImageMetaData fields search results can be
+// narrowed to
+var selectableFields = []string{
+	"filename", "url", "size", "size_str", "mime_type", "mod_time",
+	"width", "height", "aspect_ratio", "orientation", "tags", "original_name",
+	"aliases",
+}
+
+// SelectedImageData is a page of images holding only selected fields
+type SelectedImageData struct {
+	Total      int                      `json:"total"`
+	Page       int                      `json:"page"`
+	PageSize   int                      `json:"page_size"`
+	Pages      int                      `json:"pages"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	PrevCursor string                   `json:"prev_cursor,omitempty"`
+	Data       []map[string]interface{} `json:"data"`
+}
+
+// ImageEXIF is the embedded EXIF, XMP and IPTC metadata of an image
+type ImageEXIF struct {
 	Filename string `json:"filename"`
-	URL      string `json:"url"`
-	Size     int64  `json:"size"`
-	SizeStr  string `json:"size_str"`
-	MimeType string `json:"mime_type"`
-	ModTime  int64  `json:"mod_time"`
+	*imagemeta.Metadata
 }
 
 type PaginatedImageData struct {
-	Total    int             `json:"total"`
-	Page     int             `json:"page"`
-	PageSize int             `json:"page_size"`
-	Pages    int             `json:"pages"`
-	Data     []ImageMetaData `json:"data"`
+	Total      int             `json:"total"`
+	Page       int             `json:"page"` // 0 when paging with a cursor
+	PageSize   int             `json:"page_size"`
+	Pages      int             `json:"pages"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+	PrevCursor string          `json:"prev_cursor,omitempty"`
+	Data       []ImageMetaData `json:"data"`
+}
+
+// PageOptions selects a page of a sorted listing. A cursor from a previous
+// response takes precedence over the page number, which is kept for
+// compatibility but shifts when images are added or removed.
+type PageOptions struct {
+	Page     int
+	PageSize int
+	Cursor   string
+	Sort     string // comma separated sort fields, - for descending
 }
 
 type ImageService struct {
-	config *config.Config
-	logger *logger.Logger
-	cache  *cache.Cache
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
+	catalog *catalog.Catalog
 }
 
 func NewImageService() *ImageService {
 	return &ImageService{
-		config: config.GetConfig(),
-		logger: logger.GetLogger(),
-		cache:  cache.NewCache(),
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
+		catalog: GetCatalog(),
 	}
 }
 
-// GetImageByFilename retrieves a single image by filename
-func (s *ImageService) GetImageByFilename(filename string) (string, *errors.AppError) {
-	filepath := utils.GetUploadPath(s.config.File.UploadDir, filename)
+// OpenImage opens a single image by filename for reading
+func (s *ImageService) OpenImage(filename string) (io.ReadSeekCloser, *storage.FileInfo, *errors.AppError) {
+	name, err := storage.CleanName(filename)
+	if err != nil || isHiddenName(name) {
+		return nil, nil, errors.ErrFileNotFound
+	}
 
-	if !utils.FileExists(filepath) {
+	info, err := s.storage.Stat(name)
+	if err != nil || info.IsDir {
 		s.logger.Warn("File not found: %s", filename)
-		return "", errors.ErrFileNotFound
+		return nil, nil, errors.ErrFileNotFound
 	}
 
-	return filepath, nil
-}
-
-// GetAllImages returns all image files with their URLs
-func (s *ImageService) GetAllImages(hostURL string) (*ImageData, *errors.AppError) {
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
+	file, err := s.storage.Open(name)
 	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to list images", err)
+		s.logger.Error("Failed to open file %s: %v", filename, err)
+		return nil, nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to open file", err)
 	}
 
-	if len(fileInfos) == 0 {
-		return &ImageData{Total: 0, Data: []string{}}, nil
+	return file, info, nil
+}
+
+// OriginalName returns the name an image was uploaded under when it is
+// stored under another one, or "" otherwise
+func (s *ImageService) OriginalName(name string) string {
+	rec, ok := s.catalog.Get(name)
+	if !ok {
+		return ""
 	}
+	return rec.OriginalName
+}
+
+// listImages returns the catalog records of the top level images matching
+// filter (nil matches all), sorted by filename
+func (s *ImageService) listImages(filter func(*catalog.Record) bool) []catalog.Record {
+	return s.catalog.Find(func(rec *catalog.Record) bool {
+		if strings.Contains(rec.Filename, "/") {
+			return false
+		}
+		return filter == nil || filter(rec)
+	})
+}
+
+// GetAllImages returns all image files with their URLs
+func (s *ImageService) GetAllImages(hostURL string) (*ImageData, *errors.AppError) {
+	records := s.listImages(nil)
 
 	data := &ImageData{
-		Total: len(fileInfos),
-		Data:  make([]string, 0, len(fileInfos)),
+		Total: len(records),
+		Data:  make([]string, 0, len(records)),
 	}
 
-	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			data.Data = append(data.Data, hostURL+"/f/"+fileInfo.Name())
-		}
+	for _, rec := range records {
+		data.Data = append(data.Data, hostURL+"/f/"+rec.Filename)
 	}
 
 	return data, nil
 }
 
-// GetAllImagesWithMetadata returns all image files with detailed metadata
-func (s *ImageService) GetAllImagesWithMetadata(hostURL string) ([]ImageMetaData, *errors.AppError) {
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
-	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to list images", err)
-	}
-
-	result := make([]ImageMetaData, 0)
-
-	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			filePath := utils.GetUploadPath(s.config.File.UploadDir, fileInfo.Name())
-			size, _ := utils.GetFileInfo(filePath)
-			metadata := ImageMetaData{
-				Filename: fileInfo.Name(),
-				URL:      hostURL + "/f/" + fileInfo.Name(),
-				Size:     size,
-				SizeStr:  utils.GetFileSizeFormatted(size),
-				MimeType: utils.GetMimeType(fileInfo.Name()),
-				ModTime:  fileInfo.ModTime().Unix(),
-			}
-			result = append(result, metadata)
+// GetAllImagesWithMetadata returns all image files with detailed metadata.
+// withExif adds the embedded EXIF/XMP/IPTC metadata of images having any.
+func (s *ImageService) GetAllImagesWithMetadata(hostURL string, withExif bool) ([]ImageMetaData, *errors.AppError) {
+	records := s.listImages(nil)
+
+	result := make([]ImageMetaData, 0, len(records))
+	for _, rec := range records {
+		data := newImageMetaData(rec, hostURL)
+		if withExif && rec.Meta != nil && !rec.Meta.IsEmpty() {
+			data.Exif = rec.Meta
 		}
+		result = append(result, data)
 	}
 
 	return result, nil
 }
 
-// GetAllImagesPaginated returns paginated image files with metadata
-func (s *ImageService) GetAllImagesPaginated(hostURL string, page, pageSize int) (*PaginatedImageData, *errors.AppError) {
-	if page < 1 {
-		page = 1
-	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
-	}
+// GetAllImagesPaginated returns paginated image files with metadata,
+// optionally only those carrying all of tags. Records come straight from
+// the in-memory catalog, so pages always reflect the latest changes.
+func (s *ImageService) GetAllImagesPaginated(hostURL string, tags []string, opts PageOptions) (*PaginatedImageData, *errors.AppError) {
+	records := s.listImages(func(rec *catalog.Record) bool {
+		return hasTags(rec, tags)
+	})
+	return s.paginate(records, hostURL, opts)
+}
 
-	// Try to get from cache
-	cacheKey := "images_list"
-	if cached, ok := s.cache.Get(cacheKey); ok {
-		fileInfos := cached.([]os.FileInfo)
-		return s.paginateFiles(fileInfos, hostURL, page, pageSize), nil
+// paginate sorts records in place and returns the page selected by opts
+// along with cursors to its neighbours
+func (s *ImageService) paginate(records []catalog.Record, hostURL string, opts PageOptions) (*PaginatedImageData, *errors.AppError) {
+	if opts.PageSize < 1 || opts.PageSize > 100 {
+		opts.PageSize = 20
 	}
 
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
+	order, err := search.ParseSort(opts.Sort)
 	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to list images", err)
+		return nil, errors.NewError(http.StatusBadRequest, "invalid sort: "+err.Error())
 	}
+	order.Sort(records)
 
-	// Cache for 5 minutes
-	s.cache.Set(cacheKey, fileInfos, 5*time.Minute)
-
-	return s.paginateFiles(fileInfos, hostURL, page, pageSize), nil
-}
+	total := len(records)
+	result := &PaginatedImageData{
+		Total:    total,
+		PageSize: opts.PageSize,
+		Pages:    (total + opts.PageSize - 1) / opts.PageSize,
+	}
 
-// Helper function to paginate file list
-func (s *ImageService) paginateFiles(fileInfos []os.FileInfo, hostURL string, page, pageSize int) *PaginatedImageData {
-	validFiles := make([]os.FileInfo, 0)
-	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			validFiles = append(validFiles, fileInfo)
+	var start, end int
+	if opts.Cursor != "" {
+		cursor, err := search.ParseCursor(opts.Cursor, order)
+		if err != nil {
+			return nil, errors.NewError(http.StatusBadRequest, "invalid cursor: "+err.Error())
 		}
+		start, end = cursor.Window(records, opts.PageSize)
+	} else {
+		result.Page = max(1, min(opts.Page, result.Pages))
+		start = min((result.Page-1)*opts.PageSize, total)
+		end = min(start+opts.PageSize, total)
 	}
 
-	total := len(validFiles)
-	pages := (total + pageSize - 1) / pageSize
-
-	if page > pages && total > 0 {
-		page = pages
+	result.Data = make([]ImageMetaData, 0, end-start)
+	for i := start; i < end; i++ {
+		result.Data = append(result.Data, newImageMetaData(records[i], hostURL))
 	}
 
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if end > total {
-		end = total
+	if end < total && end > start {
+		result.NextCursor = search.NewCursor(order, &records[end-1], false)
 	}
-
-	result := &PaginatedImageData{
-		Total:    total,
-		Page:     page,
-		PageSize: pageSize,
-		Pages:    pages,
-		Data:     make([]ImageMetaData, 0, pageSize),
-	}
-
-	if start < total {
-		for i := start; i < end; i++ {
-			file := validFiles[i]
-			filePath := utils.GetUploadPath(s.config.File.UploadDir, file.Name())
-			size, _ := utils.GetFileInfo(filePath)
-			metadata := ImageMetaData{
-				Filename: file.Name(),
-				URL:      hostURL + "/f/" + file.Name(),
-				Size:     size,
-				SizeStr:  utils.GetFileSizeFormatted(size),
-				MimeType: utils.GetMimeType(file.Name()),
-				ModTime:  file.ModTime().Unix(),
-			}
-			result.Data = append(result.Data, metadata)
-		}
+	if start > 0 && start < total {
+		result.PrevCursor = search.NewCursor(order, &records[start], true)
 	}
 
-	return result
+	return result, nil
 }
 
-// GetRandomImage returns a random image filename
-func (s *ImageService) GetRandomImage() (string, *errors.AppError) {
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
-	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return "", errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to get random image", err)
+// newImageMetaData builds the API representation of a catalog record
+func newImageMetaData(rec catalog.Record, hostURL string) ImageMetaData {
+	return ImageMetaData{
+		Filename:     rec.Filename,
+		URL:          hostURL + "/f/" + rec.Filename,
+		Size:         rec.Size,
+		SizeStr:      utils.GetFileSizeFormatted(rec.Size),
+		MimeType:     rec.MimeType,
+		ModTime:      rec.ModTime.Unix(),
+		Width:        rec.Width,
+		Height:       rec.Height,
+		AspectRatio:  math.Round(rec.AspectRatio()*10000) / 10000,
+		Orientation:  rec.Orientation(),
+		Tags:         rec.Tags,
+		OriginalName: rec.OriginalName,
+		Aliases:      rec.Aliases,
 	}
+}
 
-	if len(fileInfos) == 0 {
-		return "", errors.ErrNoFiles
+// GetImageEXIF returns the embedded metadata of an image. Images catalogued
+// before metadata extraction existed are probed on first request.
+func (s *ImageService) GetImageEXIF(filename string) (*ImageEXIF, *errors.AppError) {
+	name, err := storage.CleanName(filename)
+	if err != nil || !isCatalogName(name) {
+		return nil, errors.ErrFileNotFound
 	}
 
-	validFiles := make([]os.FileInfo, 0)
-	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			validFiles = append(validFiles, fileInfo)
+	rec, ok := s.catalog.Get(name)
+	if !ok || rec.Meta == nil {
+		info, err := s.storage.Stat(name)
+		if err != nil || info.IsDir {
+			return nil, errors.ErrFileNotFound
 		}
-	}
 
-	if len(validFiles) == 0 {
-		return "", errors.ErrNoFiles
+		if !ok {
+			rec = catalog.Record{Filename: name, UploadedAt: info.ModTime}
+		}
+		rec.ModTime = info.ModTime
+
+		r, err := s.storage.Get(name)
+		if err != nil {
+			return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to open file", err)
+		}
+		err = catalog.ProbeReader(r, &rec)
+		r.Close()
+		if err != nil {
+			s.logger.Error("Failed to read metadata of %s: %v", name, err)
+			return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to read metadata", err)
+		}
+
+		if err := s.catalog.Put(rec); err != nil {
+			s.logger.Error("Failed to record %s in catalog: %v", name, err)
+		}
 	}
 
-	randomIndex := rand.Intn(len(validFiles))
-	return validFiles[randomIndex].Name(), nil
+	return &ImageEXIF{Filename: name, Metadata: rec.Meta}, nil
 }
 
-// GetRandomImages returns multiple random images
-func (s *ImageService) GetRandomImages(hostURL string, count int) ([]string, *errors.AppError) {
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
-	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to get random images", err)
-	}
+// isTopLevel matches records stored directly in the upload directory
+func isTopLevel(rec *catalog.Record) bool {
+	return !strings.Contains(rec.Filename, "/")
+}
 
-	validFiles := make([]os.FileInfo, 0)
-	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			validFiles = append(validFiles, fileInfo)
-		}
+// GetRandomImage returns a random image filename
+func (s *ImageService) GetRandomImage(tags []string) (string, *errors.AppError) {
+	picked := s.catalog.RandomMatching(1, func(rec *catalog.Record) bool {
+		return isTopLevel(rec) && hasTags(rec, tags)
+	})
+	if len(picked) == 0 {
+		return "", errors.ErrNoFiles
 	}
 
-	if len(validFiles) == 0 {
-		return nil, errors.ErrNoFiles
-	}
+	return picked[0].Filename, nil
+}
 
-	if count > len(validFiles) {
-		count = len(validFiles)
+// GetRandomImages returns multiple random images
+func (s *ImageService) GetRandomImages(hostURL string, count int, tags []string) ([]string, *errors.AppError) {
+	picked := s.catalog.RandomMatching(count, func(rec *catalog.Record) bool {
+		return isTopLevel(rec) && hasTags(rec, tags)
+	})
+	if len(picked) == 0 {
+		return nil, errors.ErrNoFiles
 	}
 
-	result := make([]string, 0, count)
-	for i := 0; i < count; i++ {
-		randomIndex := rand.Intn(len(validFiles))
-		result = append(result, hostURL+"/f/"+validFiles[randomIndex].Name())
+	result := make([]string, 0, len(picked))
+	for _, rec := range picked {
+		result = append(result, hostURL+"/f/"+rec.Filename)
 	}
 
 	return result, nil
@@ -260,18 +350,12 @@ func (s *ImageService) UploadFile(hostURL string, files []*multipart.FileHeader)
 		return nil, errors.NewError(400, "no files provided")
 	}
 
-	// Ensure upload directory exists
-	if err := utils.EnsureDir(s.config.File.UploadDir); err != nil {
-		s.logger.Error("Failed to create upload directory: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "Failed to create directory", err)
-	}
-
 	uploadedFiles := make([]string, 0)
 	failedFiles := make([]map[string]string, 0)
 
 	for _, file := range files {
 		// Validate file
-		if appErr := s.validateFile(file); appErr != nil {
+		if appErr := s.validateFile(file.Filename, file.Size); appErr != nil {
 			s.logger.Warn("File validation failed: %s, error: %s", file.Filename, appErr.Message)
 			failedFiles = append(failedFiles, map[string]string{
 				"filename": file.Filename,
@@ -301,137 +385,925 @@ func (s *ImageService) UploadFile(hostURL string, files []*multipart.FileHeader)
 	return result, nil
 }
 
-// SearchImages filters images by criteria
-func (s *ImageService) SearchImages(hostURL string, filename string, minSize, maxSize int64, fileType string, page, pageSize int) (*PaginatedImageData, *errors.AppError) {
-	if page < 1 {
-		page = 1
+// SearchParams filters SearchImages; zero values do not filter
+type SearchParams struct {
+	Filename    string // case insensitive substring
+	MinSize     int64
+	MaxSize     int64
+	FileType    string // extension, with or without the dot
+	MinWidth    int
+	MaxWidth    int
+	MinHeight   int
+	MaxHeight   int
+	Orientation string  // landscape, portrait or square
+	Aspect      float64 // width / height, matched within aspectTolerance
+	Query       string  // query language expression, see package search
+	Tags        []string
+}
+
+// aspectTolerance is the relative difference accepted when matching aspect ratios
+const aspectTolerance = 0.01
+
+// Match reports whether rec passes all filters. Dimension filters never
+// match images of unknown size.
+func (p SearchParams) Match(rec *catalog.Record) bool {
+	// Filter by filename
+	if p.Filename != "" && !strings.Contains(strings.ToLower(rec.Filename), strings.ToLower(p.Filename)) {
+		return false
+	}
+
+	// Filter by file size
+	if p.MinSize > 0 && rec.Size < p.MinSize {
+		return false
 	}
-	if pageSize < 1 || pageSize > 100 {
-		pageSize = 20
+	if p.MaxSize > 0 && rec.Size > p.MaxSize {
+		return false
 	}
 
-	fileInfos, err := utils.ListFiles(s.config.File.UploadDir)
-	if err != nil {
-		s.logger.Error("Failed to list files: %v", err)
-		return nil, errors.NewErrorWithCause(errors.ErrDirectoryFail.Code, "Failed to search images", err)
+	// Filter by file type/extension
+	if p.FileType != "" {
+		ext := strings.ToLower(utils.GetFileExt(rec.Filename))
+		if !strings.EqualFold(ext, "."+p.FileType) && !strings.EqualFold(ext, p.FileType) {
+			return false
+		}
 	}
 
-	validFiles := make([]os.FileInfo, 0)
+	// Filter by dimensions
+	if p.MinWidth > 0 && rec.Width < p.MinWidth {
+		return false
+	}
+	if p.MaxWidth > 0 && (rec.Width <= 0 || rec.Width > p.MaxWidth) {
+		return false
+	}
+	if p.MinHeight > 0 && rec.Height < p.MinHeight {
+		return false
+	}
+	if p.MaxHeight > 0 && (rec.Height <= 0 || rec.Height > p.MaxHeight) {
+		return false
+	}
+	if p.Orientation != "" && rec.Orientation() != p.Orientation {
+		return false
+	}
+	if p.Aspect > 0 && math.Abs(rec.AspectRatio()-p.Aspect) > p.Aspect*aspectTolerance {
+		return false
+	}
 
-	for _, fileInfo := range fileInfos {
-		if fileInfo.IsDir() {
-			continue
+	return hasTags(rec, p.Tags)
+}
+
+// hasTags reports whether rec carries all tags
+func hasTags(rec *catalog.Record, tags []string) bool {
+	for _, tag := range tags {
+		if !rec.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseAspect parses an aspect ratio written as "16:9", "16/9" or "1.78"
+func ParseAspect(value string) (float64, error) {
+	if w, h, ok := strings.Cut(strings.ReplaceAll(value, "/", ":"), ":"); ok {
+		width, err1 := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		height, err2 := strconv.ParseFloat(strings.TrimSpace(h), 64)
+		if err1 != nil || err2 != nil || width <= 0 || height <= 0 {
+			return 0, fmt.Errorf("invalid aspect ratio %q", value)
 		}
+		return width / height, nil
+	}
 
-		// Filter by filename
-		if filename != "" && !strings.Contains(strings.ToLower(fileInfo.Name()), strings.ToLower(filename)) {
-			continue
+	ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || ratio <= 0 {
+		return 0, fmt.Errorf("invalid aspect ratio %q", value)
+	}
+	return ratio, nil
+}
+
+// SelectFields narrows every image of a page to the given JSON fields.
+// Empty fields left out of the full representation stay left out.
+func SelectFields(data *PaginatedImageData, fields []string) (*SelectedImageData, *errors.AppError) {
+	for _, field := range fields {
+		if !slices.Contains(selectableFields, field) {
+			return nil, errors.NewError(http.StatusBadRequest,
+				fmt.Sprintf("unknown field %q (supported: %s)", field, strings.Join(selectableFields, ", ")))
 		}
+	}
 
-		// Filter by file size
-		if minSize > 0 && fileInfo.Size() < minSize {
-			continue
+	result := &SelectedImageData{
+		Total:      data.Total,
+		Page:       data.Page,
+		PageSize:   data.PageSize,
+		Pages:      data.Pages,
+		NextCursor: data.NextCursor,
+		PrevCursor: data.PrevCursor,
+		Data:       make([]map[string]interface{}, 0, len(data.Data)),
+	}
+
+	for _, item := range data.Data {
+		raw, err := json.Marshal(item)
+		if err != nil {
+			return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to encode image", err)
 		}
-		if maxSize > 0 && fileInfo.Size() > maxSize {
-			continue
+		var full map[string]interface{}
+		if err := json.Unmarshal(raw, &full); err != nil {
+			return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to encode image", err)
 		}
 
-		// Filter by file type/extension
-		if fileType != "" {
-			ext := strings.ToLower(utils.GetFileExt(fileInfo.Name()))
-			if !strings.EqualFold(ext, "."+fileType) && !strings.EqualFold(ext, fileType) {
-				continue
+		selected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := full[field]; ok {
+				selected[field] = value
 			}
 		}
+		result.Data = append(result.Data, selected)
+	}
+
+	return result, nil
+}
 
-		validFiles = append(validFiles, fileInfo)
+// SearchImages filters images by criteria
+func (s *ImageService) SearchImages(hostURL string, params SearchParams, opts PageOptions) (*PaginatedImageData, *errors.AppError) {
+	query, err := search.Parse(params.Query)
+	if err != nil {
+		return nil, errors.NewError(http.StatusBadRequest, "invalid query: "+err.Error())
 	}
 
-	total := len(validFiles)
-	pages := (total + pageSize - 1) / pageSize
+	validFiles := s.listImages(func(rec *catalog.Record) bool {
+		return params.Match(rec) && query.Match(rec)
+	})
 
-	if page > pages && total > 0 {
-		page = pages
+	return s.paginate(validFiles, hostURL, opts)
+}
+
+// validateFile checks an upload of size bytes named filename against the
+// configured size limit and the supported image formats
+func (s *ImageService) validateFile(filename string, size int64) *errors.AppError {
+	// Check file size
+	if size > s.config.File.MaxSize*1024*1024 {
+		return errors.ErrFileTooLarge
 	}
 
-	start := (page - 1) * pageSize
-	end := start + pageSize
-	if end > total {
-		end = total
+	// Check if file format is supported
+	if !utils.IsValidImageFormat(filename) {
+		return errors.NewError(400, "unsupported image format. Supported formats: jpg, jpeg, png, gif, webp, bmp, ico, svg")
 	}
 
-	result := &PaginatedImageData{
-		Total:    total,
-		Page:     page,
-		PageSize: pageSize,
-		Pages:    pages,
-		Data:     make([]ImageMetaData, 0, pageSize),
-	}
-
-	if start < total {
-		for i := start; i < end; i++ {
-			file := validFiles[i]
-			filePath := utils.GetUploadPath(s.config.File.UploadDir, file.Name())
-			size, _ := utils.GetFileInfo(filePath)
-			metadata := ImageMetaData{
-				Filename: file.Name(),
-				URL:      hostURL + "/f/" + file.Name(),
-				Size:     size,
-				SizeStr:  utils.GetFileSizeFormatted(size),
-				MimeType: utils.GetMimeType(file.Name()),
-				ModTime:  file.ModTime().Unix(),
-			}
-			result.Data = append(result.Data, metadata)
+	return nil
+}
+
+// MaxUploadSize returns the size limit of a single upload in bytes
+func (s *ImageService) MaxUploadSize() int64 {
+	return s.config.File.MaxSize * 1024 * 1024
+}
+
+// MaxUploadFiles returns how many files a single upload request may contain
+func (s *ImageService) MaxUploadFiles() int {
+	return s.config.File.MaxFiles
+}
+
+// sniffSize is how much of an upload is inspected to detect its type
+const sniffSize = 512
+
+// SaveUpload validates an image streamed from a client and saves it with
+// SaveImage. The name needs a supported image extension and the content,
+// sniffed from its first bytes, one of the FileConfig.AllowTypes. The size
+// limit is up to r: content it cuts off with an *http.MaxBytesError is
+// rejected with ErrFileTooLarge without being stored.
+func (s *ImageService) SaveUpload(filename string, r io.Reader, opts SaveOptions) (*SavedImage, *errors.AppError) {
+	if appErr := s.validateFile(filename, 0); appErr != nil {
+		return nil, appErr
+	}
+
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		if appErr := readError(err); appErr != nil {
+			return nil, appErr
 		}
+		return nil, errors.NewErrorWithCause(http.StatusBadRequest, "failed to read upload", err)
 	}
 
-	return result, nil
+	if mimeType := sniffType(filename, head); !slices.Contains(s.config.File.AllowTypes, mimeType) {
+		s.logger.Warn("Upload %s rejected, content type %s is not allowed", filename, mimeType)
+		return nil, errors.NewError(errors.ErrInvalidFileType.Code, "file type "+mimeType+" is not allowed")
+	}
+
+	return s.SaveImage(filename, br, opts)
 }
-func (s *ImageService) validateFile(file *multipart.FileHeader) *errors.AppError {
-	// Check file size
-	if file.Size > s.config.File.MaxSize*1024*1024 {
+
+// sniffType detects the MIME type of content from its first bytes. SVG is
+// plain text to http.DetectContentType and recognized by its root element.
+func sniffType(filename string, head []byte) string {
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	if strings.HasPrefix(mimeType, "text/") && strings.EqualFold(path.Ext(filename), ".svg") &&
+		bytes.Contains(head, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	return mimeType
+}
+
+// readError returns ErrFileTooLarge when reading an upload failed because
+// it exceeded the size limit, nil for other errors
+func readError(err error) *errors.AppError {
+	var tooLarge *http.MaxBytesError
+	if stderrors.As(err, &tooLarge) {
 		return errors.ErrFileTooLarge
 	}
+	return nil
+}
 
-	// Check if file format is supported
-	if !utils.IsValidImageFormat(file.Filename) {
-		return errors.NewError(400, "unsupported image format. Supported formats: jpg, jpeg, png, gif, webp, bmp, ico, svg")
+// SaveOptions controls how SaveImage stores an upload
+type SaveOptions struct {
+	Uploader string
+	// Folder is an existing folder to store the image in, empty for the root
+	Folder string
+	// Scrub overrides FileConfig.Scrub.Enabled when set
+	Scrub *bool
+}
+
+// SavedImage is the catalog record of a stored image
+type SavedImage struct {
+	catalog.Record
+	// Deduplicated is true when identical content was already stored and
+	// the image shares it instead of taking up space again
+	Deduplicated bool
+}
+
+// SaveImage stores an uploaded image and records it in the catalog. The
+// name follows FileConfig.DuplicateStrategy: filename with conflicts
+// overwritten, rejected or renamed, or the SHA-256 of the content ("hash")
+// or a random UUID ("uuid") in the folder of filename. The uploaded name is
+// kept as the original name of an image stored under another name. Privacy
+// sensitive metadata is removed unless disabled by configuration or opts.
+func (s *ImageService) SaveImage(filename string, r io.Reader, opts SaveOptions) (*SavedImage, *errors.AppError) {
+	if opts.Folder != "" {
+		folder, appErr := NewFolderService().Resolve(opts.Folder)
+		if appErr != nil {
+			return nil, appErr
+		}
+		if folder != "" {
+			filename = folder + "/" + filename
+		}
+	}
+
+	name, err := storage.CleanName(filename)
+	if err != nil || isHiddenName(name) {
+		return nil, errors.NewError(400, "invalid filename")
 	}
 
+	base := catalog.Record{UploadedAt: time.Now(), Uploader: opts.Uploader, OriginalName: path.Base(name)}
+
+	switch s.config.File.DuplicateStrategy {
+	case "hash":
+		content := s.prepareUpload(name, r, opts)
+		defer content.Close()
+		return s.saveByHash(name, content, base)
+	case "uuid":
+		id, err := newUUID()
+		if err != nil {
+			return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to generate file name", err)
+		}
+		name = path.Join(path.Dir(name), id+path.Ext(name))
+	}
+
+	name, reserved, appErr := s.resolveDuplicate(name)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	content := s.prepareUpload(name, r, opts)
+	defer content.Close()
+
+	// A name that was not free is overwritten
+	if !reserved {
+		return s.overwrite(name, content, base)
+	}
+
+	saved, appErr := s.putImage(name, content, base)
+	if appErr != nil {
+		s.release(name)
+	}
+	return saved, appErr
+}
+
+// overwrite replaces the image stored under name, keeping the content it
+// replaces as a version. The upload is staged first; the snapshot and the
+// replacement then happen under renameMu, so a revert or rename of name
+// cannot interleave with them.
+func (s *ImageService) overwrite(name string, r io.Reader, base catalog.Record) (*SavedImage, *errors.AppError) {
+	staged, info, probe, appErr := s.stage(name, r)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	versions := NewVersionService()
+	snapshot, err := versions.Snapshot(name, base.Uploader)
+	if err != nil {
+		_ = s.storage.Delete(staged)
+		s.logger.Error("Failed to save the previous version of %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save the previous version", err)
+	}
+
+	if err := s.storage.Rename(staged, name); err != nil {
+		_ = s.storage.Delete(staged)
+		// The upload did not replace the content, so it is no previous version
+		versions.Discard(snapshot)
+		s.logger.Error("Failed to save file %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save file", err)
+	}
+	return s.recordImage(name, info, probe, base), nil
+}
+
+// prepareUpload applies automatic orientation and metadata scrubbing to the
+// content of an upload. Close releases the scrubbing pipeline and removes
+// the spooled content of an oriented upload.
+func (s *ImageService) prepareUpload(name string, r io.Reader, opts SaveOptions) io.ReadCloser {
+	cleanup := func() {}
+	if s.config.File.AutoOrient {
+		r, cleanup = s.autoOrient(name, r)
+	}
+
+	scrub := s.config.File.Scrub.Enabled
+	if opts.Scrub != nil {
+		scrub = *opts.Scrub
+	}
+	content := io.NopCloser(r)
+	if scrub {
+		content = NewScrubService().Reader(r)
+	}
+	return &uploadContent{ReadCloser: content, cleanup: cleanup}
+}
+
+// uploadContent runs cleanup once the content of an upload is closed
+type uploadContent struct {
+	io.ReadCloser
+	cleanup func()
+}
+
+func (c *uploadContent) Close() error {
+	err := c.ReadCloser.Close()
+	c.cleanup()
+	return err
+}
+
+// uploadsDir holds uploads of the hash strategy until their hash is known,
+// and uploads overwriting an image until the previous version is kept.
+// Like all dot directories it is hidden from listings.
+const uploadsDir = ".uploads"
+
+// stage stores the content of an upload for name under a hidden name in
+// uploadsDir, collecting its checksum and dimensions. The caller moves it
+// into place or deletes it.
+func (s *ImageService) stage(name string, r io.Reader) (string, *storage.FileInfo, *catalog.Probe, *errors.AppError) {
+	id, err := newUUID()
+	if err != nil {
+		return "", nil, nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to generate file name", err)
+	}
+	staged := uploadsDir + "/" + id + path.Ext(name)
+
+	probe := catalog.NewProbe()
+	info, err := s.storage.Put(staged, io.TeeReader(r, probe))
+	if err != nil {
+		_ = s.storage.Delete(staged)
+		if appErr := readError(err); appErr != nil {
+			return "", nil, nil, appErr
+		}
+		s.logger.Error("Failed to save file %s: %v", name, err)
+		return "", nil, nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save file", err)
+	}
+	return staged, info, probe, nil
+}
+
+// saveByHash stores content under its hex encoded SHA-256, keeping the
+// folder and extension of name. The content is staged under a hidden name
+// first, as the hash is only known once everything was read. Content that
+// is already stored under its hash keeps the existing image.
+func (s *ImageService) saveByHash(name string, r io.Reader, base catalog.Record) (*SavedImage, *errors.AppError) {
+	staged, info, probe, appErr := s.stage(name, r)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	target := path.Join(path.Dir(name), probe.Checksum()+path.Ext(name))
+	for attempt := 0; ; attempt++ {
+		err := s.storage.Reserve(target)
+		if err == nil {
+			break
+		}
+		if !storage.IsExist(err) {
+			_ = s.storage.Delete(staged)
+			s.logger.Error("Failed to reserve %s: %v", target, err)
+			return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save file", err)
+		}
+
+		// The same content was uploaded before
+		if saved, ok := s.recordAlias(target, probe, base); ok {
+			_ = s.storage.Delete(staged)
+			s.logger.Info("Upload %s is already stored as %s", base.OriginalName, target)
+			return saved, nil
+		}
+
+		// Another upload of the same content reserved the name and is still
+		// storing it; it either completes or releases the name
+		if attempt == hashWaitAttempts {
+			_ = s.storage.Delete(staged)
+			return nil, errors.NewError(http.StatusServiceUnavailable, "the same content is being uploaded, retry later")
+		}
+		time.Sleep(hashWaitDelay)
+	}
+
+	if err := s.storage.Rename(staged, target); err != nil {
+		_ = s.storage.Delete(staged)
+		s.release(target)
+		s.logger.Error("Failed to save file %s: %v", target, err)
+		return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save file", err)
+	}
+	return s.recordImage(target, info, probe, base), nil
+}
+
+// How long saveByHash waits for another upload of the same content
+const (
+	hashWaitAttempts = 50
+	hashWaitDelay    = 100 * time.Millisecond
+)
+
+// recordAlias records an upload of content already stored as target as an
+// alias of its image. It reports false while target is only the empty
+// reservation of another upload that has not stored the content yet. The
+// returned record names the upload as its original name, like the record
+// of a newly stored image.
+func (s *ImageService) recordAlias(target string, probe *catalog.Probe, base catalog.Record) (*SavedImage, bool) {
+	alias := catalog.Alias{Name: base.OriginalName, Uploader: base.Uploader, UploadedAt: base.UploadedAt}
+	if alias.Name == path.Base(target) {
+		alias.Name = ""
+	}
+
+	var rec catalog.Record
+	err := s.catalog.Update(target, func(r *catalog.Record) error {
+		if alias.Name != "" && r.OriginalName != alias.Name && !r.HasAlias(alias.Name) {
+			r.Aliases = append(r.Aliases, alias)
+		}
+		rec = *r
+		return nil
+	})
+	if err == catalog.ErrNotFound {
+		// Content stored without a record, e.g. before reconciliation, is
+		// recorded for this upload
+		info, err := s.storage.Stat(target)
+		if err != nil || info.Size == 0 {
+			return nil, false
+		}
+		rec = catalog.Record{
+			Filename:     target,
+			ModTime:      info.ModTime,
+			UploadedAt:   base.UploadedAt,
+			Uploader:     base.Uploader,
+			OriginalName: alias.Name,
+		}
+		probe.Fill(&rec)
+		err = s.catalog.Put(rec)
+	}
+	if err != nil {
+		s.logger.Error("Failed to record %s as an alias of %s: %v", base.OriginalName, target, err)
+	}
+
+	rec.OriginalName = alias.Name
+	return &SavedImage{Record: rec, Deduplicated: true}, true
+}
+
+// autoOrient returns the content of r with JPEG pixels rotated upright
+// according to the EXIF orientation. Metadata is kept, with the orientation
+// reset to normal. Content that needs no rotation is streamed unchanged.
+// Content that does is spooled to a temporary file and rotated there while
+// holding a transform slot, so memory does not grow with concurrent uploads.
+// cleanup removes the temporary file.
+func (s *ImageService) autoOrient(name string, r io.Reader) (io.Reader, func()) {
+	br := bufio.NewReaderSize(r, orientHeaderSize)
+	header, _ := br.Peek(orientHeaderSize)
+	if imagemeta.Orientation(header) == 1 {
+		return br, func() {}
+	}
+
+	spool, err := os.CreateTemp("", "orient-*")
+	if err != nil {
+		s.logger.Warn("Failed to auto-orient %s, storing it unchanged: %v", name, err)
+		return br, func() {}
+	}
+	cleanup := func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}
+
+	// The upload is read before taking a slot, so slow clients do not hold
+	// up orientation of other uploads
+	if _, err := io.Copy(spool, br); err != nil {
+		return errReader{err}, cleanup
+	}
+
+	// Decoding holds the whole image in memory, bound how many run at once
+	transformSlots <- struct{}{}
+	err = s.orientSpool(name, spool)
+	<-transformSlots
+	if err != nil {
+		return errReader{err}, cleanup
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return errReader{err}, cleanup
+	}
+	return spool, cleanup
+}
+
+// orientSpool rotates the JPEG spooled in f upright in place. Content that
+// cannot be oriented is left unchanged.
+func (s *ImageService) orientSpool(name string, f *os.File) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	oriented, err := orientJPEG(data)
+	if err != nil {
+		s.logger.Warn("Failed to auto-orient %s, storing it unchanged: %v", name, err)
+		return nil
+	}
+
+	if _, err := f.WriteAt(oriented, 0); err != nil {
+		return err
+	}
+	if err := f.Truncate(int64(len(oriented))); err != nil {
+		return err
+	}
+	s.logger.Info("Auto-oriented %s", name)
 	return nil
 }
 
-// DeleteImage deletes a single image file
-func (s *ImageService) DeleteImage(filename string) *errors.AppError {
+// putImage stores content under name and records it in the catalog. base
+// supplies the upload time, uploader and original name of the record.
+func (s *ImageService) putImage(name string, r io.Reader, base catalog.Record) (*SavedImage, *errors.AppError) {
+	// Checksum and dimensions are collected while the content is stored
+	probe := catalog.NewProbe()
+	info, err := s.storage.Put(name, io.TeeReader(r, probe))
+	if err != nil {
+		if appErr := readError(err); appErr != nil {
+			return nil, appErr
+		}
+		s.logger.Error("Failed to save file %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrFileUploadFail.Code, "failed to save file", err)
+	}
+
+	return s.recordImage(name, info, probe, base), nil
+}
+
+// recordImage records content stored under name in the catalog, dropping
+// cached transforms of any content it replaces
+func (s *ImageService) recordImage(name string, info *storage.FileInfo, probe *catalog.Probe, base catalog.Record) *SavedImage {
+	rec := catalog.Record{
+		Filename:   name,
+		ModTime:    info.ModTime,
+		UploadedAt: base.UploadedAt,
+		Uploader:   base.Uploader,
+	}
+	if base.OriginalName != path.Base(name) {
+		rec.OriginalName = base.OriginalName
+	}
+	probe.Fill(&rec)
+
+	// Tags belong to the name and are kept when the content is replaced
+	previous, overwritten := s.catalog.Get(rec.Filename)
+	if overwritten {
+		rec.Tags = previous.Tags
+	}
+	if err := s.catalog.Put(rec); err != nil {
+		s.logger.Error("Failed to record %s in catalog: %v", name, err)
+	}
+
+	// Cached transforms of the replaced content are no longer reachable
+	if overwritten && previous.Checksum != rec.Checksum {
+		if err := removeTransforms(s.config, previous.Checksum); err != nil {
+			s.logger.Warn("Failed to drop cached transforms of %s: %v", name, err)
+		}
+	}
+
+	return &SavedImage{Record: rec, Deduplicated: info.Deduplicated}
+}
+
+// orientHeaderSize is how much of an upload is read to find its EXIF orientation
+const orientHeaderSize = 128 * 1024
+
+// orientJPEG re-encodes a JPEG with its pixels rotated upright according
+// to the EXIF orientation
+func orientJPEG(data []byte) ([]byte, error) {
+	// Decode applies the EXIF orientation
+	img, format, err := imageutil.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return nil, fmt.Errorf("unexpected format %s", format)
+	}
+
+	return reencode(img, format, data)
+}
+
+// reencode encodes upright pixels decoded from original. JPEG metadata of
+// the original is copied over with the orientation marked as normal.
+func reencode(img image.Image, format string, original []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := imageutil.Encode(&buf, img, format, 90); err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return buf.Bytes(), nil
+	}
+
+	out, err := imagemeta.CopyMetadata(buf.Bytes(), original)
+	if err != nil {
+		return nil, err
+	}
+	if err := imagemeta.ResetOrientation(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// errReader returns err on every read
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
+
+// OrientImage rotates, flips or transposes a stored image in place,
+// starting from its upright (EXIF oriented) pixels. JPEG metadata and the
+// catalog upload time and uploader are kept, and an existing thumbnail is
+// regenerated.
+func (s *ImageService) OrientImage(filename string, o imageutil.Orientation) (*catalog.Record, *errors.AppError) {
+	if err := o.Validate(); err != nil {
+		return nil, errors.NewError(http.StatusBadRequest, err.Error())
+	}
+	if o.IsZero() {
+		return nil, errors.NewError(http.StatusBadRequest, "degrees, flip or transpose required")
+	}
+
+	name, err := storage.CleanName(filename)
+	if err != nil || !isCatalogName(name) {
+		return nil, errors.ErrFileNotFound
+	}
+
+	r, err := s.storage.Get(name)
+	if err != nil {
+		if storage.IsNotExist(err) {
+			return nil, errors.ErrFileNotFound
+		}
+		s.logger.Error("Failed to open file %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to open file", err)
+	}
+	original, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		s.logger.Error("Failed to read file %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to read file", err)
+	}
+
+	img, format, err := imageutil.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, errors.NewError(http.StatusUnsupportedMediaType, "image format cannot be rotated")
+	}
+
+	data, err := reencode(imageutil.Orient(img, o), format, original)
+	if err != nil {
+		s.logger.Error("Failed to encode %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to encode image", err)
+	}
+
+	base, ok := s.catalog.Get(name)
+	if !ok {
+		base.UploadedAt = time.Now()
+	}
+
+	saved, appErr := s.putImage(name, bytes.NewReader(data), base)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	if _, err := s.storage.Stat(thumbnailName(name)); err == nil {
+		if err := NewThumbnailService().Generate(name); err != nil {
+			s.logger.Warn("Failed to regenerate thumbnail of %s: %v", name, err)
+		}
+	}
+
+	s.logger.Info("Image oriented: %s (rotate=%d flip=%q transpose=%t)", name, o.Rotate, o.Flip, o.Transpose)
+	return &saved.Record, nil
+}
+
+// resolveDuplicate returns the name content should be stored under,
+// resolving a conflict with an existing object according to
+// FileConfig.DuplicateStrategy; the hash and uuid strategies, whose names
+// only conflict for renamed or restored images, resolve them like rename.
+// Free names are claimed with Storage.Reserve, so concurrent uploads never
+// pick the same one. reserved reports whether the name was claimed this
+// way; it then holds an empty placeholder to replace, or to remove with
+// release, and otherwise an existing image to overwrite.
+func (s *ImageService) resolveDuplicate(name string) (string, bool, *errors.AppError) {
+	reserved, appErr := s.reserve(name)
+	if appErr != nil || reserved {
+		return name, reserved, appErr
+	}
+
+	switch s.config.File.DuplicateStrategy {
+	case "overwrite":
+		// keep the name, Put replaces the existing object
+		return name, false, nil
+	case "reject":
+		s.logger.Warn("Upload rejected for existing file %s", name)
+		return "", false, errors.ErrFileExists
+	default: // rename
+		// generate unique name: name_1.ext, name_2.ext ...
+		ext := path.Ext(name)
+		nameOnly := name[:len(name)-len(ext)]
+		for i := 1; ; i++ {
+			candidate := nameOnly + "_" + strconv.Itoa(i) + ext
+			reserved, appErr := s.reserve(candidate)
+			if appErr != nil || reserved {
+				return candidate, reserved, appErr
+			}
+		}
+	}
+}
+
+// reserve claims name with Storage.Reserve, reporting false when it is taken
+func (s *ImageService) reserve(name string) (bool, *errors.AppError) {
+	err := s.storage.Reserve(name)
+	if err == nil {
+		return true, nil
+	}
+	if storage.IsExist(err) {
+		return false, nil
+	}
+	s.logger.Error("Failed to reserve %s: %v", name, err)
+	return false, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to reserve file name", err)
+}
+
+// release removes the placeholder of a name reserved by resolveDuplicate
+// when nothing was stored under it
+func (s *ImageService) release(name string) {
+	if err := s.storage.Delete(name); err != nil && !storage.IsNotExist(err) {
+		s.logger.Warn("Failed to release reserved name %s: %v", name, err)
+	}
+}
+
+// newUUID returns a random (version 4) UUID
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// exists reports whether an object with the given name is stored
+func (s *ImageService) exists(name string) bool {
+	_, err := s.storage.Stat(name)
+	return err == nil
+}
+
+// renameMu serializes renames, so two renames cannot claim the same free
+// destination name
+var renameMu sync.Mutex
+
+// RenameImage renames or moves a stored image to destination, a filename
+// relative to the upload directory whose folder must exist. Conflicts are
+// resolved like uploads, according to FileConfig.DuplicateStrategy; an
+// overwritten image is kept as a version. Tags, album entries, versions and
+// the thumbnail follow the image; cached transforms are keyed by content
+// and stay valid. It returns the record under the new name.
+func (s *ImageService) RenameImage(filename, destination, user string) (*catalog.Record, *errors.AppError) {
+	from, err := storage.CleanName(filename)
+	if err != nil || !isCatalogName(from) {
+		return nil, errors.NewError(http.StatusBadRequest, "invalid filename format")
+	}
+
+	to, err := storage.CleanName(strings.Trim(destination, "/"))
+	if err != nil || !isCatalogName(to) {
+		return nil, errors.NewError(http.StatusBadRequest, "invalid destination filename")
+	}
+	if extensionKind(from) != extensionKind(to) {
+		return nil, errors.NewError(http.StatusBadRequest, "the file extension cannot be changed")
+	}
+	if _, appErr := NewFolderService().Resolve(parentFolder(to)); appErr != nil {
+		return nil, appErr
+	}
+
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	if !s.exists(from) {
+		return nil, errors.ErrFileNotFound
+	}
+	if to == from {
+		rec, _ := s.catalog.Get(from)
+		return &rec, nil
+	}
+
+	to, reserved, appErr := s.resolveDuplicate(to)
+	if appErr != nil {
+		return nil, appErr
+	}
+	replaced, overwritten := s.catalog.Get(to)
+	var snapshot string
+	if !reserved {
+		var err error
+		if snapshot, err = NewVersionService().Snapshot(to, user); err != nil {
+			s.logger.Error("Failed to save the previous version of %s: %v", to, err)
+			return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to save the previous version", err)
+		}
+	}
+
+	if err := s.storage.Rename(from, to); err != nil {
+		if reserved {
+			s.release(to)
+		}
+		NewVersionService().Discard(snapshot)
+		s.logger.Error("Failed to rename %s to %s: %v", from, to, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to rename file", err)
+	}
+
+	if err := renameImage(s.catalog, from, to); err != nil {
+		s.logger.Error("Failed to rename %s in catalog: %v", from, err)
+	}
+
+	// Like an overwriting upload, transforms of the replaced content are no
+	// longer reachable
+	rec, _ := s.catalog.Get(to)
+	if overwritten && replaced.Checksum != rec.Checksum {
+		if err := removeTransforms(s.config, replaced.Checksum); err != nil {
+			s.logger.Warn("Failed to drop cached transforms of %s: %v", to, err)
+		}
+	}
+
+	// Move the thumbnail, or drop the stale one of a replaced image
+	err = s.storage.Rename(thumbnailName(from), thumbnailName(to))
+	if storage.IsNotExist(err) {
+		err = s.storage.Delete(thumbnailName(to))
+	}
+	if err != nil && !storage.IsNotExist(err) {
+		s.logger.Warn("Failed to move thumbnail of %s: %v", from, err)
+	}
+
+	s.logger.Info("Image renamed: %s -> %s", from, to)
+	return &rec, nil
+}
+
+// extensionKind returns the lowercased extension of name, treating .jpeg
+// as .jpg
+func extensionKind(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	if ext == ".jpeg" {
+		return ".jpg"
+	}
+	return ext
+}
+
+// DeleteImage deletes a single image file on behalf of user. With
+// FileConfig.Trash enabled the image is moved to the trash instead.
+func (s *ImageService) DeleteImage(filename, user string) *errors.AppError {
 	if !utils.IsValidImageFormat(filename) {
 		return errors.NewError(400, "invalid filename format")
 	}
 
-	filepath := utils.GetUploadPath(s.config.File.UploadDir, filename)
+	name, err := storage.CleanName(filename)
+	if err != nil || isHiddenName(name) {
+		return errors.NewError(400, "invalid filename format")
+	}
 
-	if !utils.FileExists(filepath) {
+	if _, err := s.storage.Stat(name); err != nil {
 		return errors.ErrFileNotFound
 	}
 
-	if err := os.Remove(filepath); err != nil {
+	if err := NewTrashService().Discard(name, user, trash.ReasonDeleted); err != nil {
 		s.logger.Error("Failed to delete file %s: %v", filename, err)
 		return errors.NewErrorWithCause(500, "failed to delete file", err)
 	}
 
-	// Clear cache after deletion
-	s.cache.Delete("images_list")
 	s.logger.Info("File deleted: %s", filename)
 
 	return nil
 }
 
-// DeleteImages deletes multiple image files
-func (s *ImageService) DeleteImages(filenames []string) map[string]interface{} {
+// DeleteImages deletes multiple image files on behalf of user
+func (s *ImageService) DeleteImages(filenames []string, user string) map[string]interface{} {
 	deleted := make([]string, 0)
 	failed := make([]map[string]string, 0)
 
 	for _, filename := range filenames {
-		if err := s.DeleteImage(filename); err != nil {
+		if err := s.DeleteImage(filename, user); err != nil {
 			failed = append(failed, map[string]string{
 				"filename": filename,
 				"error":    err.Message,
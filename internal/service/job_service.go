@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/jobs"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+)
+
+// 任务类型
+const (
+	JobThumbnails = "thumbnails" // 生成缩略图
+	JobExport     = "export"     // 导出指定文件为ZIP
+	JobExportAll  = "export_all" // 导出所有文件为ZIP
+	JobCleanup    = "cleanup"    // 清理维护
+	JobStatistics = "statistics" // 统计信息
+	JobScrub      = "scrub"      // 清除已有图片的隐私元数据
+)
+
+// AdminJob 报告任务类型是否只允许管理员提交：清除元数据会改写、清理会删除整个图库中的图片
+func AdminJob(jobType string) bool {
+	return jobType == JobScrub || jobType == JobCleanup
+}
+
+var (
+	jobsMu       sync.Mutex
+	jobsInstance *jobs.Manager
+)
+
+// InitJobs 创建任务管理器（任务保存在共享数据库中），注册任务类型并启动工作协程
+func InitJobs(cfg *config.Config) (*jobs.Manager, error) {
+	manager, err := jobs.NewManager(GetDatabase(), jobs.Options{
+		Workers:     cfg.Jobs.Workers,
+		QueueSize:   cfg.Jobs.QueueSize,
+		MaxAttempts: cfg.Jobs.MaxAttempts,
+		RetryDelay:  cfg.Jobs.RetryDelay,
+		Retention:   cfg.Jobs.Retention,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	registerJobHandlers(manager)
+	manager.Start()
+
+	jobsMu.Lock()
+	jobsInstance = manager
+	jobsMu.Unlock()
+
+	return manager, nil
+}
+
+// GetJobs 获取共享的任务管理器，未初始化时按全局配置创建
+func GetJobs() *jobs.Manager {
+	jobsMu.Lock()
+	manager := jobsInstance
+	jobsMu.Unlock()
+
+	if manager != nil {
+		return manager
+	}
+
+	manager, err := InitJobs(config.GetConfig())
+	if err != nil {
+		panic(fmt.Sprintf("failed to initialize jobs: %v", err))
+	}
+	return manager
+}
+
+// StopJobs 停止任务管理器，运行中的任务会在下次启动时继续
+func StopJobs() {
+	jobsMu.Lock()
+	manager := jobsInstance
+	jobsInstance = nil
+	jobsMu.Unlock()
+
+	if manager != nil {
+		manager.Stop()
+	}
+}
+
+// registerJobHandlers 注册所有任务类型
+func registerJobHandlers(m *jobs.Manager) {
+	m.Register(JobThumbnails, NewThumbnailService().runJob)
+	m.Register(JobExport, runExportJob)
+	m.Register(JobExportAll, runExportAllJob)
+	m.Register(JobCleanup, runCleanupJob)
+	m.Register(JobStatistics, runStatisticsJob)
+	m.Register(JobScrub, NewScrubService().runJob)
+}
+
+// exportParams 导出任务参数
+type exportParams struct {
+	Filenames []string `json:"filenames"`
+}
+
+// runExportJob 导出指定文件
+func runExportJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var params exportParams
+	if err := task.Decode(&params); err != nil {
+		return nil, err
+	}
+	if len(params.Filenames) == 0 {
+		return nil, jobs.Permanent(fmt.Errorf("filenames required"))
+	}
+
+	return exportWithProgress(ctx, task, params.Filenames)
+}
+
+// runExportAllJob 导出所有文件
+func runExportAllJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	filenames, err := NewExportService().exportableFiles()
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, jobs.Permanent(errors.ErrNoFiles)
+	}
+
+	return exportWithProgress(ctx, task, filenames)
+}
+
+// exportWithProgress 导出文件并按文件报告进度
+func exportWithProgress(ctx context.Context, task *jobs.Task, filenames []string) (interface{}, error) {
+	exportService := NewExportService()
+	task.SetTotal(len(filenames))
+
+	return exportService.ExportFilesContext(ctx, filenames, exportService.ExportDir(), func() {
+		task.Advance(1)
+	})
+}
+
+// CleanupParams 清理任务参数
+type CleanupParams struct {
+	RemoveOrphanThumbnails bool `json:"remove_orphan_thumbnails"`
+	RemoveOldFiles         bool `json:"remove_old_files"`
+	MaxFileAgeDays         int  `json:"max_file_age_days"`
+	RemoveEmptyDirs        bool `json:"remove_empty_dirs"`
+	PruneVersions          bool `json:"prune_versions"`
+	// MaxVersions 与 MaxVersionAgeDays 为 0 时使用 File.Versions 配置
+	MaxVersions       int `json:"max_versions"`
+	MaxVersionAgeDays int `json:"max_version_age_days"`
+}
+
+// CleanupConfig 转换为清理配置
+func (p CleanupParams) CleanupConfig() CleanupConfig {
+	maxAge := time.Duration(p.MaxFileAgeDays) * 24 * time.Hour
+	if maxAge == 0 {
+		maxAge = 24 * time.Hour * 30 // 默认30天
+	}
+
+	versions := config.GetConfig().File.Versions
+	maxVersions := p.MaxVersions
+	if maxVersions == 0 {
+		maxVersions = versions.MaxCount
+	}
+	maxVersionAge := time.Duration(p.MaxVersionAgeDays) * 24 * time.Hour
+	if maxVersionAge == 0 {
+		maxVersionAge = versions.MaxAge
+	}
+
+	return CleanupConfig{
+		RemoveOrphanThumbnails: p.RemoveOrphanThumbnails,
+		RemoveOldFiles:         p.RemoveOldFiles,
+		MaxFileAge:             maxAge,
+		RemoveEmptyDirs:        p.RemoveEmptyDirs,
+		PruneVersions:          p.PruneVersions,
+		MaxVersions:            maxVersions,
+		MaxVersionAge:          maxVersionAge,
+	}
+}
+
+// runCleanupJob 执行清理
+func runCleanupJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var params CleanupParams
+	if err := task.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	return NewMaintenanceService().Cleanup(params.CleanupConfig()), nil
+}
+
+// runStatisticsJob 计算统计信息
+func runStatisticsJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	return NewStatisticsService().GetStatistics(), nil
+}
+
+// JobService 后台任务服务
+type JobService struct {
+	logger *logger.Logger
+	jobs   *jobs.Manager
+}
+
+// NewJobService 创建后台任务服务
+func NewJobService() *JobService {
+	return &JobService{
+		logger: logger.GetLogger(),
+		jobs:   GetJobs(),
+	}
+}
+
+// Submit 提交任务
+func (j *JobService) Submit(jobType string, params interface{}) (*jobs.Job, *errors.AppError) {
+	job, err := j.jobs.Submit(jobType, params)
+	if err != nil {
+		return nil, jobError(err)
+	}
+
+	j.logger.Info("Job %s (%s) submitted", job.ID, job.Type)
+	return &job, nil
+}
+
+// Get 获取任务状态
+func (j *JobService) Get(id string) (*jobs.Job, *errors.AppError) {
+	job, err := j.jobs.Get(id)
+	if err != nil {
+		return nil, jobError(err)
+	}
+	return &job, nil
+}
+
+// List 列出任务，status 与 jobType 为空时不过滤
+func (j *JobService) List(status, jobType string) []jobs.Job {
+	return j.jobs.List(jobs.Status(status), jobType)
+}
+
+// Cancel 取消等待中或运行中的任务
+func (j *JobService) Cancel(id string) (*jobs.Job, *errors.AppError) {
+	job, err := j.jobs.Cancel(id)
+	if err != nil {
+		return nil, jobError(err)
+	}
+
+	j.logger.Info("Job %s canceled", id)
+	return &job, nil
+}
+
+// Delete 删除已结束的任务记录
+func (j *JobService) Delete(id string) *errors.AppError {
+	if err := j.jobs.Delete(id); err != nil {
+		return jobError(err)
+	}
+	return nil
+}
+
+// Retry 重新执行失败或已取消的任务
+func (j *JobService) Retry(id string) (*jobs.Job, *errors.AppError) {
+	job, err := j.jobs.Retry(id)
+	if err != nil {
+		return nil, jobError(err)
+	}
+
+	j.logger.Info("Job %s queued for retry", id)
+	return &job, nil
+}
+
+// Purge 删除所有已结束的任务记录
+func (j *JobService) Purge() int {
+	return j.jobs.Purge(time.Time{})
+}
+
+// jobError 将任务错误转换为应用错误
+func jobError(err error) *errors.AppError {
+	switch err {
+	case jobs.ErrNotFound:
+		return errors.NewError(http.StatusNotFound, "job not found")
+	case jobs.ErrUnknownType:
+		return errors.NewError(http.StatusBadRequest, "unknown job type")
+	case jobs.ErrQueueFull:
+		return errors.NewError(http.StatusServiceUnavailable, "job queue is full")
+	case jobs.ErrFinished:
+		return errors.NewError(http.StatusConflict, "job already finished")
+	case jobs.ErrNotFinished:
+		return errors.NewError(http.StatusConflict, "job is still pending or running")
+	default:
+		return errors.NewErrorWithCause(errors.ErrInternalServer.Code, "job operation failed", err)
+	}
+}
@@ -1,26 +1,26 @@
 package service
 
 import (
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/trash"
 	"github.com/gantoho/go-img-sys/pkg/logger"
-	"github.com/gantoho/go-img-sys/pkg/utils"
+	"github.com/gantoho/go-img-sys/pkg/storage"
 )
 
 // MaintenanceService 维护服务
 type MaintenanceService struct {
-	config *config.Config
-	logger *logger.Logger
+	logger  *logger.Logger
+	storage storage.Storage
 }
 
 // NewMaintenanceService 创建维护服务
 func NewMaintenanceService() *MaintenanceService {
 	return &MaintenanceService{
-		config: config.GetConfig(),
-		logger: logger.GetLogger(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
 	}
 }
 
@@ -30,6 +30,9 @@ type CleanupConfig struct {
 	RemoveOldFiles         bool          // 删除旧文件
 	MaxFileAge             time.Duration // 最大文件年龄
 	RemoveEmptyDirs        bool          // 删除空目录
+	PruneVersions          bool          // 删除多余的历史版本
+	MaxVersions            int           // 每张图片保留的历史版本数，0 表示不限
+	MaxVersionAge          time.Duration // 历史版本最大年龄，0 表示不限
 }
 
 // CleanupResult 清理结果
@@ -37,6 +40,7 @@ type CleanupResult struct {
 	FilesRemoved      int
 	ThumbnailsRemoved int
 	DirsRemoved       int
+	VersionsRemoved   int
 	SizeFreed         int64
 	Errors            []string
 }
@@ -47,95 +51,110 @@ func (m *MaintenanceService) Cleanup(cfg CleanupConfig) *CleanupResult {
 		Errors: make([]string, 0),
 	}
 
-	uploadDir := m.config.File.UploadDir
-
 	if cfg.RemoveOrphanThumbnails {
-		m.cleanupOrphanThumbnails(uploadDir, result)
+		m.cleanupOrphanThumbnails(result)
 	}
 
 	if cfg.RemoveOldFiles {
-		m.cleanupOldFiles(uploadDir, cfg.MaxFileAge, result)
+		m.cleanupOldFiles(cfg.MaxFileAge, result)
 	}
 
 	if cfg.RemoveEmptyDirs {
-		m.cleanupEmptyDirs(uploadDir, result)
+		m.cleanupEmptyDirs("", result)
+	}
+
+	if cfg.PruneVersions {
+		removed, freed, errs := NewVersionService().Prune(cfg.MaxVersions, cfg.MaxVersionAge)
+		result.VersionsRemoved += removed
+		result.SizeFreed += freed
+		result.Errors = append(result.Errors, errs...)
 	}
 
-	m.logger.Info("Cleanup completed: %d files removed, %d thumbnails removed, %d dirs removed, %.2f MB freed",
-		result.FilesRemoved, result.ThumbnailsRemoved, result.DirsRemoved, float64(result.SizeFreed)/1024/1024)
+	m.logger.Info("Cleanup completed: %d files removed, %d thumbnails removed, %d dirs removed, %d versions removed, %.2f MB freed",
+		result.FilesRemoved, result.ThumbnailsRemoved, result.DirsRemoved, result.VersionsRemoved, float64(result.SizeFreed)/1024/1024)
 
 	return result
 }
 
 // cleanupOrphanThumbnails 清理孤立缩略图
-func (m *MaintenanceService) cleanupOrphanThumbnails(uploadDir string, result *CleanupResult) {
-	thumbDir := filepath.Join(uploadDir, "thumbs")
-	if _, err := os.Stat(thumbDir); os.IsNotExist(err) {
+func (m *MaintenanceService) cleanupOrphanThumbnails(result *CleanupResult) {
+	thumbs, err := m.storage.List(thumbnailDir, true)
+	if err != nil {
 		return
 	}
 
-	filepath.Walk(thumbDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
+	for _, thumb := range thumbs {
 		// 检查对应的原始文件是否存在
-		relPath, _ := filepath.Rel(thumbDir, path)
-		originalPath := filepath.Join(uploadDir, relPath)
-
-		if !utils.FileExists(originalPath) {
-			size := info.Size()
-			os.Remove(path)
-			result.ThumbnailsRemoved++
-			result.SizeFreed += size
-			m.logger.Info("Orphan thumbnail removed: %s", path)
+		originalName := strings.TrimPrefix(thumb.Name, thumbnailDir+"/")
+
+		if _, err := m.storage.Stat(originalName); err == nil {
+			continue
 		}
 
-		return nil
-	})
+		if err := m.storage.Delete(thumb.Name); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.ThumbnailsRemoved++
+		result.SizeFreed += thumb.Size
+		m.logger.Info("Orphan thumbnail removed: %s", thumb.Name)
+	}
 }
 
-// cleanupOldFiles 清理旧文件
-func (m *MaintenanceService) cleanupOldFiles(uploadDir string, maxAge time.Duration, result *CleanupResult) {
+// cleanupOldFiles 清理旧文件。图片在启用回收站时移入回收站，缩略图随原图删除
+func (m *MaintenanceService) cleanupOldFiles(maxAge time.Duration, result *CleanupResult) {
 	cutoffTime := time.Now().Add(-maxAge)
+	trashService := NewTrashService()
 
-	filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
+	files, err := m.storage.List("", true)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+		return
+	}
 
-		if info.ModTime().Before(cutoffTime) {
-			size := info.Size()
-			os.Remove(path)
-			result.FilesRemoved++
-			result.SizeFreed += size
-			m.logger.Info("Old file removed: %s", path)
+	for _, file := range files {
+		if isHiddenName(file.Name) || isThumbnailName(file.Name) || !file.ModTime.Before(cutoffTime) {
+			continue
 		}
 
-		return nil
-	})
+		if isCatalogName(file.Name) {
+			err = trashService.Discard(file.Name, "", trash.ReasonCleanup)
+		} else {
+			err = m.storage.Delete(file.Name)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		result.FilesRemoved++
+		result.SizeFreed += file.Size
+		m.logger.Info("Old file removed: %s", file.Name)
+	}
 }
 
-// cleanupEmptyDirs 清理空目录
-func (m *MaintenanceService) cleanupEmptyDirs(uploadDir string, result *CleanupResult) {
-	filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || !info.IsDir() {
-			return nil
-		}
+// cleanupEmptyDirs 清理空目录，返回目录是否为空
+func (m *MaintenanceService) cleanupEmptyDirs(dir string, result *CleanupResult) bool {
+	entries, err := m.storage.List(dir, false)
+	if err != nil {
+		return false
+	}
 
-		if path == uploadDir {
-			return nil
+	remaining := len(entries)
+	for _, entry := range entries {
+		if !entry.IsDir || isHiddenName(entry.Name) {
+			continue
 		}
 
-		entries, err := os.ReadDir(path)
-		if err == nil && len(entries) == 0 {
-			os.Remove(path)
-			result.DirsRemoved++
-			m.logger.Info("Empty directory removed: %s", path)
+		if m.cleanupEmptyDirs(entry.Name, result) {
+			if err := m.storage.Delete(entry.Name); err == nil {
+				remaining--
+				result.DirsRemoved++
+				m.logger.Info("Empty directory removed: %s", entry.Name)
+			}
 		}
+	}
 
-		return nil
-	})
+	return remaining == 0
 }
 
 // StartAutoCleanup 启动自动清理（后台定时任务）
@@ -145,11 +164,15 @@ func (m *MaintenanceService) StartAutoCleanup(interval time.Duration) {
 		defer ticker.Stop()
 
 		for range ticker.C {
+			versions := config.GetConfig().File.Versions
 			cfg := CleanupConfig{
 				RemoveOrphanThumbnails: true,
 				RemoveOldFiles:         true,
 				MaxFileAge:             24 * time.Hour * 30, // 30天
 				RemoveEmptyDirs:        true,
+				PruneVersions:          true,
+				MaxVersions:            versions.MaxCount,
+				MaxVersionAge:          versions.MaxAge,
 			}
 			m.Cleanup(cfg)
 		}
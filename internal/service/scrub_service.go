@@ -0,0 +1,152 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/jobs"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// scrubParams 元数据清除任务参数
+type scrubParams struct {
+	Filenames []string `json:"filenames,omitempty"`
+}
+
+// ScrubResult 元数据清除任务结果
+type ScrubResult struct {
+	Scanned  int      `json:"scanned"`
+	Scrubbed int      `json:"scrubbed"`
+	Failed   int      `json:"failed"`
+	Errors   []string `json:"errors,omitempty"`
+}
+
+// ScrubService 隐私元数据清除服务
+type ScrubService struct {
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
+	catalog *catalog.Catalog
+}
+
+// NewScrubService 创建隐私元数据清除服务
+func NewScrubService() *ScrubService {
+	return &ScrubService{
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
+		catalog: GetCatalog(),
+	}
+}
+
+// options 返回配置的清除选项
+func (s *ScrubService) options() imagemeta.ScrubOptions {
+	return imagemeta.ScrubOptions{KeepOrientation: s.config.File.Scrub.KeepOrientation}
+}
+
+// Reader 返回清除元数据后的内容，数据在读取时流式处理。
+// 调用方读取完毕或放弃读取后必须关闭返回值。
+func (s *ScrubService) Reader(r io.Reader) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := imagemeta.Scrub(pw, r, s.options())
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// StartJob 提交清除已有图片元数据的后台任务，filenames 为空时处理所有图片
+func (s *ScrubService) StartJob(filenames []string) (*jobs.Job, *errors.AppError) {
+	return NewJobService().Submit(JobScrub, scrubParams{Filenames: filenames})
+}
+
+// runJob 执行元数据清除任务，逐个处理图片并报告进度
+func (s *ScrubService) runJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var params scrubParams
+	if err := task.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	filenames := params.Filenames
+	if len(filenames) == 0 {
+		for _, rec := range s.catalog.All() {
+			filenames = append(filenames, rec.Filename)
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, jobs.Permanent(errors.ErrNoFiles)
+	}
+
+	task.SetTotal(len(filenames))
+	result := &ScrubResult{}
+
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		scrubbed, err := s.Scrub(filename)
+		if storage.IsNotExist(err) {
+			err = errors.ErrFileNotFound
+		}
+		result.Scanned++
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, filename+": "+err.Error())
+		} else if scrubbed {
+			result.Scrubbed++
+		}
+		task.Advance(1)
+	}
+
+	s.logger.Info("Scrub job %s finished: %d of %d images scrubbed, %d failed",
+		task.ID(), result.Scrubbed, result.Scanned, result.Failed)
+
+	if result.Failed == result.Scanned {
+		return nil, jobs.Permanent(fmt.Errorf("no images scrubbed: %s", result.Errors[0]))
+	}
+	return result, nil
+}
+
+// Scrub 清除单个已存储图片的元数据，图片没有可清除的元数据时不改写文件。
+// 返回是否清除了元数据。
+func (s *ScrubService) Scrub(filename string) (bool, error) {
+	name, err := storage.CleanName(filename)
+	if err != nil {
+		return false, err
+	}
+	if !isCatalogName(name) {
+		return false, storage.ErrInvalidName
+	}
+
+	r, err := s.storage.Get(name)
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	removed, err := imagemeta.Scrub(&buf, r, s.options())
+	r.Close()
+	if err != nil || !removed {
+		return false, err
+	}
+
+	base, ok := s.catalog.Get(name)
+	if !ok {
+		base.UploadedAt = time.Now()
+	}
+
+	if _, appErr := NewImageService().putImage(name, &buf, base); appErr != nil {
+		return false, appErr
+	}
+
+	s.logger.Info("Metadata scrubbed: %s", name)
+	return true, nil
+}
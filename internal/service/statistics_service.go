@@ -1,10 +1,11 @@
 package service
 
 import (
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 
+	"github.com/gantoho/go-img-sys/internal/blobs"
+	"github.com/gantoho/go-img-sys/internal/catalog"
 	"github.com/gantoho/go-img-sys/internal/config"
 	"github.com/gantoho/go-img-sys/pkg/logger"
 	"github.com/gantoho/go-img-sys/pkg/utils"
@@ -12,15 +13,17 @@ import (
 
 // StatisticsService 统计服务
 type StatisticsService struct {
-	config *config.Config
-	logger *logger.Logger
+	config  *config.Config
+	logger  *logger.Logger
+	catalog *catalog.Catalog
 }
 
 // NewStatisticsService 创建统计服务
 func NewStatisticsService() *StatisticsService {
 	return &StatisticsService{
-		config: config.GetConfig(),
-		logger: logger.GetLogger(),
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		catalog: GetCatalog(),
 	}
 }
 
@@ -33,6 +36,21 @@ type FileStats struct {
 	FormatStats     map[string]FormatStat `json:"format_stats"`
 	LargestFile     string                `json:"largest_file"`
 	LargestFileSize int64                 `json:"largest_file_size"`
+	// Storage 启用去重存储时的存储用量
+	Storage *StorageUsage `json:"storage,omitempty"`
+}
+
+// StorageUsage 去重存储用量。逻辑大小为所有对象（图片、缩略图、回收站与历史版本）
+// 各自大小之和，物理大小为去重后实际保存的数据
+type StorageUsage struct {
+	Objects         int    `json:"objects"`
+	Blobs           int    `json:"blobs"`
+	LogicalSize     int64  `json:"logical_size"`
+	LogicalSizeStr  string `json:"logical_size_str"`
+	PhysicalSize    int64  `json:"physical_size"`
+	PhysicalSizeStr string `json:"physical_size_str"`
+	SavedSize       int64  `json:"saved_size"`
+	SavedSizeStr    string `json:"saved_size_str"`
 }
 
 // FormatStat 格式统计
@@ -49,42 +67,30 @@ func (s *StatisticsService) GetStatistics() *FileStats {
 		FormatStats: make(map[string]FormatStat),
 	}
 
-	uploadDir := s.config.File.UploadDir
-
 	var largestSize int64
 
-	filepath.Walk(uploadDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-
-		// 忽略缩略图
-		if strings.Contains(path, "thumbs") {
-			return nil
-		}
-
-		size := info.Size()
+	// 基于目录数据统计，无需遍历存储
+	for _, rec := range s.catalog.All() {
+		size := rec.Size
 		stats.TotalFiles++
 		stats.TotalSize += size
 
 		// 跟踪最大文件
 		if size > largestSize {
 			largestSize = size
-			stats.LargestFile = filepath.Base(path)
+			stats.LargestFile = path.Base(rec.Filename)
 			stats.LargestFileSize = size
 		}
 
 		// 统计格式
-		ext := strings.ToLower(filepath.Ext(info.Name()))
+		ext := strings.ToLower(path.Ext(rec.Filename))
 		if ext != "" {
 			formatStat := stats.FormatStats[ext]
 			formatStat.Count++
 			formatStat.Size += size
 			stats.FormatStats[ext] = formatStat
 		}
-
-		return nil
-	})
+	}
 
 	// 计算平均大小
 	if stats.TotalFiles > 0 {
@@ -103,11 +109,34 @@ func (s *StatisticsService) GetStatistics() *FileStats {
 		stats.FormatStats[fmt] = stat
 	}
 
+	stats.Storage = s.storageUsage()
+
 	s.logger.Info("Statistics computed: %d files, %.2f MB total", stats.TotalFiles, float64(stats.TotalSize)/1024/1024)
 
 	return stats
 }
 
+// storageUsage 返回去重存储的用量，未启用去重时返回 nil
+func (s *StatisticsService) storageUsage() *StorageUsage {
+	deduped, ok := GetStorage().(*blobs.Storage)
+	if !ok {
+		return nil
+	}
+
+	usage := deduped.Usage()
+	saved := usage.LogicalSize - usage.PhysicalSize
+	return &StorageUsage{
+		Objects:         usage.Objects,
+		Blobs:           usage.Blobs,
+		LogicalSize:     usage.LogicalSize,
+		LogicalSizeStr:  utils.GetFileSizeFormatted(usage.LogicalSize),
+		PhysicalSize:    usage.PhysicalSize,
+		PhysicalSizeStr: utils.GetFileSizeFormatted(usage.PhysicalSize),
+		SavedSize:       saved,
+		SavedSizeStr:    utils.GetFileSizeFormatted(saved),
+	}
+}
+
 // DiskUsage 磁盘使用情况
 type DiskUsage struct {
 	UsedSpace    int64   `json:"used_space"`
@@ -117,20 +146,25 @@ type DiskUsage struct {
 	Percentage   float64 `json:"percentage"`
 }
 
-// GetDiskUsage 获取磁盘使用情况
+// GetDiskUsage 获取磁盘使用情况，启用去重存储时按实际保存的数据计算
 func (s *StatisticsService) GetDiskUsage() *DiskUsage {
 	stats := s.GetStatistics()
 	maxSize := s.config.File.MaxSize * 1024 * 1024 // 转换为字节
 
+	used, usedStr := stats.TotalSize, stats.TotalSizeStr
+	if stats.Storage != nil {
+		used, usedStr = stats.Storage.PhysicalSize, stats.Storage.PhysicalSizeStr
+	}
+
 	usage := &DiskUsage{
-		UsedSpace:    stats.TotalSize,
-		UsedSpaceStr: stats.TotalSizeStr,
+		UsedSpace:    used,
+		UsedSpaceStr: usedStr,
 		Limit:        maxSize,
 		LimitStr:     utils.GetFileSizeFormatted(maxSize),
 	}
 
 	if maxSize > 0 {
-		usage.Percentage = float64(stats.TotalSize) / float64(maxSize) * 100
+		usage.Percentage = float64(used) / float64(maxSize) * 100
 	}
 
 	return usage
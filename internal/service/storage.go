@@ -0,0 +1,130 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/gantoho/go-img-sys/internal/blobs"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+var (
+	storageMu       sync.Mutex
+	storageInstance storage.Storage
+)
+
+// InitStorage creates the storage backend selected by FileConfig.Storage,
+// wrapped in the deduplicating blob storage when enabled, and installs it as
+// the shared instance used by all services. Call InitDatabase first, the
+// blob index is kept in the database.
+func InitStorage(cfg *config.Config) (storage.Storage, error) {
+	store, err := newStorage(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err = dedupStorage(cfg, store)
+	if err != nil {
+		return nil, err
+	}
+
+	SetStorage(store)
+	return store, nil
+}
+
+// dedupStorage wraps store in a blobs.Storage when FileConfig.Dedup is
+// enabled, moving objects stored without deduplication into blobs. When
+// disabled, or without a database to keep the index in, content
+// deduplicated by an earlier run is written back under its own names.
+func dedupStorage(cfg *config.Config, store storage.Storage) (storage.Storage, error) {
+	log := logger.GetLogger()
+	index := GetBlobIndex()
+
+	if !cfg.File.Dedup || GetDatabase() == nil {
+		n, err := blobs.Export(store, index)
+		if n > 0 {
+			log.Info("Restored %d deduplicated objects under their own names", n)
+		}
+		return store, err
+	}
+
+	deduped := blobs.New(store, index)
+	n, err := deduped.Import()
+	if n > 0 {
+		log.Info("Moved %d existing objects into deduplicated storage", n)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return deduped, nil
+}
+
+// SetStorage replaces the shared storage instance, e.g. with an in-memory
+// storage in tests
+func SetStorage(store storage.Storage) {
+	storageMu.Lock()
+	defer storageMu.Unlock()
+	storageInstance = store
+}
+
+// GetStorage returns the shared storage instance, initializing it from the
+// global config on first use
+func GetStorage() storage.Storage {
+	storageMu.Lock()
+	store := storageInstance
+	storageMu.Unlock()
+
+	if store != nil {
+		return store
+	}
+
+	store, err := InitStorage(config.GetConfig())
+	if err != nil {
+		panic(fmt.Sprintf("failed to initialize storage: %v", err))
+	}
+	return store
+}
+
+func newStorage(cfg config.FileConfig) (storage.Storage, error) {
+	switch strings.ToLower(cfg.Storage) {
+	case "", "local":
+		return storage.NewLocalStorage(cfg.UploadDir)
+	case "memory":
+		return storage.NewMemoryStorage(), nil
+	case "s3":
+		return storage.NewS3Storage(storage.S3Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Prefix:    cfg.S3.Prefix,
+			PathStyle: cfg.S3.PathStyle,
+			PartSize:  cfg.S3.PartSize * 1024 * 1024,
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage)
+	}
+}
+
+// isHiddenName reports whether an object name refers to an internal file
+// (temporary uploads, dot directories) that must not show up in listings
+func isHiddenName(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// thumbnailDir is the storage prefix holding generated thumbnails
+const thumbnailDir = "thumbs"
+
+// isThumbnailName reports whether an object name lives in the thumbnail area
+func isThumbnailName(name string) bool {
+	return name == thumbnailDir || strings.HasPrefix(name, thumbnailDir+"/")
+}
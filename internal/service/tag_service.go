@@ -0,0 +1,259 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// 标签限制
+const (
+	MaxTagLength    = 64  // 单个标签的最大字符数
+	MaxTagsPerImage = 100 // 单张图片的最大标签数
+)
+
+// TagCount 标签及使用它的图片数量
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagUpdateResult 批量修改标签的结果
+type TagUpdateResult struct {
+	Updated  int      `json:"updated"`
+	NotFound []string `json:"not_found,omitempty"`
+}
+
+// TagService 图片标签服务，标签保存在图片目录记录中
+type TagService struct {
+	logger  *logger.Logger
+	catalog *catalog.Catalog
+}
+
+// NewTagService 创建图片标签服务
+func NewTagService() *TagService {
+	return &TagService{
+		logger:  logger.GetLogger(),
+		catalog: GetCatalog(),
+	}
+}
+
+// NormalizeTag 规范化标签：去除首尾空白并转为小写。
+// 标签只能包含字母、数字、空格以及 - _ .
+func NormalizeTag(tag string) (string, *errors.AppError) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" {
+		return "", errors.NewError(http.StatusBadRequest, "tag must not be empty")
+	}
+	if utf8.RuneCountInString(tag) > MaxTagLength {
+		return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("tag %q is longer than %d characters", tag, MaxTagLength))
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -_.", r) {
+			return "", errors.NewError(http.StatusBadRequest, fmt.Sprintf("tag %q contains invalid character %q", tag, r))
+		}
+	}
+	return tag, nil
+}
+
+// normalizeTags 规范化并去重标签列表
+func normalizeTags(tags []string) ([]string, *errors.AppError) {
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized, err := NormalizeTag(tag)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(result, normalized) {
+			result = append(result, normalized)
+		}
+	}
+	return result, nil
+}
+
+// imageName 校验文件名并返回目录中的名称
+func imageName(filename string) (string, *errors.AppError) {
+	name, err := storage.CleanName(filename)
+	if err != nil || !isCatalogName(name) {
+		return "", errors.ErrFileNotFound
+	}
+	return name, nil
+}
+
+// ImageTags 返回图片的标签
+func (s *TagService) ImageTags(filename string) ([]string, *errors.AppError) {
+	name, appErr := imageName(filename)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	rec, ok := s.catalog.Get(name)
+	if !ok {
+		return nil, errors.ErrFileNotFound
+	}
+	if rec.Tags == nil {
+		return []string{}, nil
+	}
+	return rec.Tags, nil
+}
+
+// Update 为多张图片添加和移除标签，先添加后移除；不存在的图片记录在结果中
+func (s *TagService) Update(filenames, add, remove []string) (*TagUpdateResult, *errors.AppError) {
+	if len(filenames) == 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "no filenames provided")
+	}
+	if len(add) == 0 && len(remove) == 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "no tags to add or remove")
+	}
+
+	add, appErr := normalizeTags(add)
+	if appErr != nil {
+		return nil, appErr
+	}
+	remove, appErr = normalizeTags(remove)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	result := &TagUpdateResult{}
+	for _, filename := range filenames {
+		name, appErr := imageName(filename)
+		if appErr != nil {
+			result.NotFound = append(result.NotFound, filename)
+			continue
+		}
+
+		err := s.catalog.Update(name, func(rec *catalog.Record) error {
+			tags := mergeTags(rec.Tags, add)
+			tags = slices.DeleteFunc(tags, func(t string) bool { return slices.Contains(remove, t) })
+			if len(tags) > MaxTagsPerImage {
+				return errors.NewError(http.StatusBadRequest, fmt.Sprintf("%s would have more than %d tags", name, MaxTagsPerImage))
+			}
+			rec.Tags = tags
+			return nil
+		})
+		switch e := err.(type) {
+		case nil:
+			result.Updated++
+		case *errors.AppError:
+			return nil, e
+		default:
+			if err == catalog.ErrNotFound {
+				result.NotFound = append(result.NotFound, filename)
+				continue
+			}
+			s.logger.Error("Failed to update tags of %s: %v", name, err)
+			return nil, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to update tags", err)
+		}
+	}
+
+	if result.Updated == 0 {
+		return nil, errors.ErrFileNotFound
+	}
+	return result, nil
+}
+
+// List 列出所有标签及其图片数量，按数量降序、名称升序排列
+func (s *TagService) List() []TagCount {
+	counts := make(map[string]int)
+	for _, rec := range s.catalog.All() {
+		for _, tag := range rec.Tags {
+			counts[tag]++
+		}
+	}
+
+	result := make([]TagCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, TagCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Merge 将多个标签合并为目标标签（目标可以是已有标签），返回受影响的图片数。
+// 重命名即只有一个源标签的合并。
+func (s *TagService) Merge(sources []string, target string) (int, *errors.AppError) {
+	sources, appErr := normalizeTags(sources)
+	if appErr != nil {
+		return 0, appErr
+	}
+	if len(sources) == 0 {
+		return 0, errors.NewError(http.StatusBadRequest, "no tags to merge")
+	}
+	target, appErr = NormalizeTag(target)
+	if appErr != nil {
+		return 0, appErr
+	}
+
+	changed, err := s.catalog.UpdateAll(func(rec *catalog.Record) bool {
+		if !slices.ContainsFunc(rec.Tags, func(t string) bool { return slices.Contains(sources, t) }) {
+			return false
+		}
+		tags := slices.DeleteFunc(slices.Clone(rec.Tags), func(t string) bool { return slices.Contains(sources, t) })
+		rec.Tags = mergeTags(tags, []string{target})
+		return true
+	})
+	if err != nil {
+		s.logger.Error("Failed to merge tags %v into %s: %v", sources, target, err)
+		return 0, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to merge tags", err)
+	}
+	if changed == 0 {
+		return 0, errors.NewError(http.StatusNotFound, "tag not found")
+	}
+
+	s.logger.Info("Tags %v merged into %s on %d images", sources, target, changed)
+	return changed, nil
+}
+
+// Delete 从所有图片移除标签，返回受影响的图片数
+func (s *TagService) Delete(tag string) (int, *errors.AppError) {
+	tag, appErr := NormalizeTag(tag)
+	if appErr != nil {
+		return 0, appErr
+	}
+
+	changed, err := s.catalog.UpdateAll(func(rec *catalog.Record) bool {
+		if !slices.Contains(rec.Tags, tag) {
+			return false
+		}
+		rec.Tags = slices.DeleteFunc(slices.Clone(rec.Tags), func(t string) bool { return t == tag })
+		return true
+	})
+	if err != nil {
+		s.logger.Error("Failed to delete tag %s: %v", tag, err)
+		return 0, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to delete tag", err)
+	}
+	if changed == 0 {
+		return 0, errors.NewError(http.StatusNotFound, "tag not found")
+	}
+	return changed, nil
+}
+
+// mergeTags 返回两个标签列表的并集，已排序
+func mergeTags(tags, add []string) []string {
+	result := slices.Clone(tags)
+	for _, tag := range add {
+		if !slices.Contains(result, tag) {
+			result = append(result, tag)
+		}
+	}
+	slices.Sort(result)
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/jobs"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/imageutil"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// thumbnailParams 缩略图任务参数
+type thumbnailParams struct {
+	Filenames []string `json:"filenames,omitempty"`
+}
+
+// ThumbnailResult 缩略图任务结果
+type ThumbnailResult struct {
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// ThumbnailService 缩略图服务
+type ThumbnailService struct {
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
+	catalog *catalog.Catalog
+}
+
+// NewThumbnailService 创建缩略图服务
+func NewThumbnailService() *ThumbnailService {
+	return &ThumbnailService{
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
+		catalog: GetCatalog(),
+	}
+}
+
+// StartJob 提交后台缩略图生成任务，filenames 为空时处理所有图片
+func (t *ThumbnailService) StartJob(filenames []string) (*jobs.Job, *errors.AppError) {
+	return NewJobService().Submit(JobThumbnails, thumbnailParams{Filenames: filenames})
+}
+
+// runJob 执行缩略图任务，逐个生成缩略图并报告进度
+func (t *ThumbnailService) runJob(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var params thumbnailParams
+	if err := task.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	filenames := params.Filenames
+	if len(filenames) == 0 {
+		for _, rec := range t.catalog.All() {
+			filenames = append(filenames, rec.Filename)
+		}
+	}
+	if len(filenames) == 0 {
+		return nil, jobs.Permanent(errors.ErrNoFiles)
+	}
+
+	task.SetTotal(len(filenames))
+	result := &ThumbnailResult{}
+
+	for _, filename := range filenames {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		err := t.Generate(filename)
+		if storage.IsNotExist(err) {
+			err = errors.ErrFileNotFound
+		}
+		if err != nil {
+			result.Failed++
+			result.Errors = append(result.Errors, filename+": "+err.Error())
+		} else {
+			result.Succeeded++
+		}
+		task.Advance(1)
+	}
+
+	t.logger.Info("Thumbnail job %s finished: %d generated, %d failed", task.ID(), result.Succeeded, result.Failed)
+
+	if result.Succeeded == 0 {
+		return nil, jobs.Permanent(fmt.Errorf("no thumbnails generated: %s", result.Errors[0]))
+	}
+	return result, nil
+}
+
+// Generate 为单个图片生成缩略图，保存为 thumbs/<filename>
+func (t *ThumbnailService) Generate(filename string) error {
+	name, err := storage.CleanName(filename)
+	if err != nil {
+		return err
+	}
+	if !isCatalogName(name) {
+		return storage.ErrInvalidName
+	}
+
+	r, err := t.storage.Get(name)
+	if err != nil {
+		return err
+	}
+	img, format, err := imageutil.Decode(r)
+	r.Close()
+	if err != nil {
+		return err
+	}
+
+	cfg := imageutil.DefaultThumbnailConfig
+	var buf bytes.Buffer
+	if err := imageutil.Encode(&buf, imageutil.Thumbnail(img, cfg), format, cfg.Quality); err != nil {
+		return err
+	}
+
+	_, err = t.storage.Put(thumbnailName(name), &buf)
+	return err
+}
+
+// thumbnailName 返回图片对应的缩略图名称
+func thumbnailName(name string) string {
+	return thumbnailDir + "/" + name
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/imageutil"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+	"github.com/gantoho/go-img-sys/pkg/utils"
+)
+
+// transformSlots bounds how many images are decoded and resampled at once
+var transformSlots = make(chan struct{}, runtime.NumCPU())
+
+// TransformedImage is a transformed image stored in the local cache
+type TransformedImage struct {
+	Path     string
+	MimeType string
+	ModTime  time.Time
+}
+
+type TransformService struct {
+	config  *config.Config
+	logger  *logger.Logger
+	storage storage.Storage
+	catalog *catalog.Catalog
+}
+
+func NewTransformService() *TransformService {
+	return &TransformService{
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		storage: GetStorage(),
+		catalog: GetCatalog(),
+	}
+}
+
+// ValidateOptions checks transform options against the configured limits
+func (s *TransformService) ValidateOptions(opts imageutil.TransformOptions) *errors.AppError {
+	cfg := s.config.Transform
+
+	if opts.Width < 0 || (cfg.MaxWidth > 0 && opts.Width > cfg.MaxWidth) {
+		return errors.NewError(http.StatusBadRequest, fmt.Sprintf("width must be between 0 and %d", cfg.MaxWidth))
+	}
+	if opts.Height < 0 || (cfg.MaxHeight > 0 && opts.Height > cfg.MaxHeight) {
+		return errors.NewError(http.StatusBadRequest, fmt.Sprintf("height must be between 0 and %d", cfg.MaxHeight))
+	}
+	if opts.Quality < 0 || opts.Quality > 100 {
+		return errors.NewError(http.StatusBadRequest, "quality must be between 1 and 100")
+	}
+	if opts.Rotate%90 != 0 {
+		return errors.NewError(http.StatusBadRequest, "rotate must be a multiple of 90")
+	}
+	if opts.Blur < 0 || (cfg.MaxBlur > 0 && opts.Blur > cfg.MaxBlur) {
+		return errors.NewError(http.StatusBadRequest, fmt.Sprintf("blur must be between 0 and %g", cfg.MaxBlur))
+	}
+	return nil
+}
+
+// Transform returns the image filename transformed with opts, generating
+// and caching it on first request. Cache entries are keyed by the source
+// checksum, so overwriting the original never serves stale output.
+func (s *TransformService) Transform(filename string, opts imageutil.TransformOptions) (*TransformedImage, *errors.AppError) {
+	if appErr := s.ValidateOptions(opts); appErr != nil {
+		return nil, appErr
+	}
+
+	name, err := storage.CleanName(filename)
+	if err != nil || isHiddenName(name) {
+		return nil, errors.ErrFileNotFound
+	}
+
+	info, err := s.storage.Stat(name)
+	if err != nil || info.IsDir {
+		return nil, errors.ErrFileNotFound
+	}
+
+	rec, ok := s.catalog.Get(name)
+	mimeType := utils.GetMimeType(name)
+	if ok && rec.MimeType != "" {
+		mimeType = rec.MimeType
+	}
+
+	format := opts.Format
+	if format == "" {
+		format, err = imageutil.ParseFormat(strings.TrimPrefix(mimeType, "image/"))
+		if err != nil || format == "" {
+			return nil, errors.NewError(http.StatusUnsupportedMediaType, "image format cannot be transformed")
+		}
+	}
+
+	sourceKey := rec.Checksum
+	if !ok || sourceKey == "" || rec.Size != info.Size {
+		// Not catalogued yet, fall back to what identifies the current content
+		sourceKey = hashString(fmt.Sprintf("%s|%d|%d", name, info.Size, info.ModTime.UnixNano()))
+	}
+
+	opts.Format = format
+	cachePath := s.cachePath(sourceKey, hashString(opts.Key())[:32]+imageutil.FormatExtension(format))
+	result := &TransformedImage{Path: cachePath, MimeType: "image/" + format}
+
+	if stat, err := os.Stat(cachePath); err == nil {
+		result.ModTime = stat.ModTime()
+		return result, nil
+	}
+
+	if err := s.generate(name, cachePath, opts); err != nil {
+		return nil, err
+	}
+
+	result.ModTime = time.Now()
+	return result, nil
+}
+
+// PresetOptions returns the transform options of a configured preset
+func (s *TransformService) PresetOptions(preset string) (imageutil.TransformOptions, *errors.AppError) {
+	cfg, ok := s.config.Transform.Presets[preset]
+	if !ok {
+		return imageutil.TransformOptions{}, errors.NewError(http.StatusNotFound, "preset not found")
+	}
+
+	opts, err := presetOptions(cfg)
+	if err != nil {
+		s.logger.Error("Invalid preset %s: %v", preset, err)
+		return opts, errors.NewErrorWithCause(errors.ErrInternalServer.Code, "invalid preset configuration", err)
+	}
+	return opts, nil
+}
+
+// presetOptions converts a preset configuration into transform options
+func presetOptions(cfg config.PresetConfig) (imageutil.TransformOptions, error) {
+	opts := imageutil.TransformOptions{
+		Width:   cfg.Width,
+		Height:  cfg.Height,
+		Quality: cfg.Quality,
+	}
+
+	var err error
+	if opts.Fit, err = imageutil.ParseFitMode(cfg.Fit); err != nil {
+		return opts, err
+	}
+	if opts.Filter, err = imageutil.ParseFilter(cfg.Filter); err != nil {
+		return opts, err
+	}
+	if opts.Format, err = imageutil.ParseFormat(cfg.Format); err != nil {
+		return opts, err
+	}
+	return opts, nil
+}
+
+// TransformPreset returns the image filename rendered with a named preset
+func (s *TransformService) TransformPreset(preset, filename string) (*TransformedImage, *errors.AppError) {
+	opts, appErr := s.PresetOptions(preset)
+	if appErr != nil {
+		return nil, appErr
+	}
+	return s.Transform(filename, opts)
+}
+
+// GenerateEagerPresets renders every preset marked Eager for filename, so
+// the first request for it is served from the cache
+func (s *TransformService) GenerateEagerPresets(filename string) {
+	for preset, cfg := range s.config.Transform.Presets {
+		if !cfg.Eager {
+			continue
+		}
+		_, err := s.TransformPreset(preset, filename)
+		if err != nil && err.Code == http.StatusUnsupportedMediaType {
+			// Formats we cannot decode are served as-is anyway
+			return
+		}
+		if err != nil {
+			s.logger.Warn("Failed to generate preset %s for %s: %v", preset, filename, err)
+		}
+	}
+}
+
+// generate decodes the original, applies opts and writes the result to cachePath
+func (s *TransformService) generate(name, cachePath string, opts imageutil.TransformOptions) *errors.AppError {
+	transformSlots <- struct{}{}
+	defer func() { <-transformSlots }()
+
+	r, err := s.storage.Get(name)
+	if err != nil {
+		return errors.ErrFileNotFound
+	}
+	img, _, err := imageutil.Decode(r)
+	r.Close()
+	if err != nil {
+		s.logger.Warn("Cannot decode %s for transform: %v", name, err)
+		return errors.NewErrorWithCause(http.StatusUnsupportedMediaType, "image format cannot be transformed", err)
+	}
+
+	var buf bytes.Buffer
+	if err := imageutil.Encode(&buf, imageutil.Transform(img, opts), opts.Format, opts.Quality); err != nil {
+		s.logger.Error("Failed to encode transformed %s: %v", name, err)
+		return errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to transform image", err)
+	}
+
+	if err := writeFileAtomic(cachePath, buf.Bytes()); err != nil {
+		s.logger.Error("Failed to cache transformed %s: %v", name, err)
+		return errors.NewErrorWithCause(errors.ErrInternalServer.Code, "failed to transform image", err)
+	}
+
+	s.logger.Info("Transformed %s (%s)", name, opts.Key())
+	return nil
+}
+
+// cachePath returns the cache location of a variant of the source identified
+// by sourceKey. All variants of a source share one directory.
+func (s *TransformService) cachePath(sourceKey, variant string) string {
+	return filepath.Join(s.config.Transform.CacheDir, sourceKey[:2], sourceKey, variant)
+}
+
+// removeTransforms drops every cached variant (transforms and presets) of
+// the content with the given checksum. Identical content stored under
+// another name shares the entries, which are simply regenerated on demand.
+func removeTransforms(cfg *config.Config, checksum string) error {
+	if len(checksum) < 2 || cfg.Transform.CacheDir == "" {
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(cfg.Transform.CacheDir, checksum[:2], checksum))
+}
+
+// forgetImage removes the catalog record of a deleted image together with
+// its album entries and cached transforms
+func forgetImage(cfg *config.Config, cat *catalog.Catalog, name string) error {
+	rec, ok := cat.Get(name)
+	if err := cat.Delete(name); err != nil {
+		return err
+	}
+	if _, err := GetAlbums().RemoveImage(name); err != nil {
+		return err
+	}
+	if ok {
+		return removeTransforms(cfg, rec.Checksum)
+	}
+	return nil
+}
+
+// renameImage moves the catalog record of an image, including its tags,
+// its album entries and its versions to a new name
+func renameImage(cat *catalog.Catalog, from, to string) error {
+	if err := cat.Rename(from, to); err != nil && err != catalog.ErrNotFound {
+		return err
+	}
+	if _, err := GetAlbums().RenameImage(from, to); err != nil {
+		return err
+	}
+	_, err := GetVersions().RenameFile(from, to)
+	return err
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so concurrent readers never see partial content
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/album"
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/trash"
+	"github.com/gantoho/go-img-sys/internal/versions"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// trashDir 回收站目录，以 "." 开头因此不会出现在图片列表中，也无法通过 /f/ 访问
+const trashDir = ".trash"
+
+// TrashItem 回收站中的图片
+type TrashItem struct {
+	ID        string     `json:"id"`
+	Filename  string     `json:"filename"`
+	Size      int64      `json:"size"`
+	MimeType  string     `json:"mime_type,omitempty"`
+	Tags      []string   `json:"tags,omitempty"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	DeletedBy string     `json:"deleted_by,omitempty"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// TrashService 回收站服务。删除的图片移动到 .trash/<id>/ 下，可以恢复或彻底删除
+type TrashService struct {
+	config   *config.Config
+	logger   *logger.Logger
+	storage  storage.Storage
+	catalog  *catalog.Catalog
+	albums   *album.Store
+	trash    *trash.Store
+	versions *versions.Store
+}
+
+// NewTrashService 创建回收站服务
+func NewTrashService() *TrashService {
+	return &TrashService{
+		config:   config.GetConfig(),
+		logger:   logger.GetLogger(),
+		storage:  GetStorage(),
+		catalog:  GetCatalog(),
+		albums:   GetAlbums(),
+		trash:    GetTrash(),
+		versions: GetVersions(),
+	}
+}
+
+// Discard 删除一张图片。启用回收站时移入回收站并记录删除者、时间和原因，历史版本随之保留，
+// 否则直接删除图片及其历史版本；两种情况下都移除目录记录、相册引用、缩略图和缓存的变换结果。
+// by 为空表示系统自动删除。
+func (t *TrashService) Discard(name, by, reason string) error {
+	if t.config.File.Trash.Enabled {
+		if err := t.moveToTrash(name, by, reason); err != nil {
+			return err
+		}
+	} else {
+		if err := t.storage.Delete(name); err != nil {
+			return err
+		}
+		NewVersionService().RemoveAll(name)
+	}
+
+	if err := forgetImage(t.config, t.catalog, name); err != nil {
+		t.logger.Error("Failed to remove %s from catalog: %v", name, err)
+	}
+	if err := t.storage.Delete(thumbnailName(name)); err != nil && !storage.IsNotExist(err) {
+		t.logger.Warn("Failed to delete thumbnail of %s: %v", name, err)
+	}
+	return nil
+}
+
+// moveToTrash 将图片移入回收站，保存目录记录和所在相册以便恢复
+func (t *TrashService) moveToTrash(name, by, reason string) error {
+	id, err := trash.NewID()
+	if err != nil {
+		return err
+	}
+
+	rec, ok := t.catalog.Get(name)
+	if !ok {
+		rec = catalog.Record{Filename: name}
+	}
+	entry := trash.Entry{
+		ID:        id,
+		Filename:  name,
+		Object:    trashDir + "/" + id + "/" + path.Base(name),
+		Size:      rec.Size,
+		DeletedAt: time.Now().UTC(),
+		DeletedBy: by,
+		Reason:    reason,
+		Record:    rec,
+	}
+	if info, err := t.storage.Stat(name); err == nil {
+		entry.Size = info.Size
+	}
+	for _, a := range t.albums.All() {
+		if a.Contains(name) {
+			entry.Albums = append(entry.Albums, a.ID)
+		}
+	}
+
+	if err := t.storage.Rename(name, entry.Object); err != nil {
+		return err
+	}
+	if err := t.trash.Put(entry); err != nil {
+		// 记录失败时放回原处，避免留下无法恢复的文件
+		if err := t.storage.Rename(entry.Object, name); err != nil {
+			t.logger.Error("Failed to move %s back from the trash: %v", name, err)
+		}
+		return err
+	}
+
+	// 历史版本改为属于回收站中的文件，不再出现在同名的新图片下；恢复时随图片恢复
+	if _, err := t.versions.RenameFile(name, entry.Object); err != nil {
+		t.logger.Warn("Failed to move versions of %s to the trash: %v", name, err)
+	}
+
+	t.logger.Info("Image moved to trash: %s (%s)", name, id)
+	return nil
+}
+
+// List 列出回收站中的图片，最近删除的在前
+func (t *TrashService) List() []TrashItem {
+	entries := t.trash.All()
+	items := make([]TrashItem, 0, len(entries))
+	for _, e := range entries {
+		items = append(items, t.item(e))
+	}
+	return items
+}
+
+// Restore 将图片恢复到原来的位置，标签等目录信息、历史版本和相册引用一并恢复（相册中追加到末尾）。
+// 原名称已被占用时按 File.DuplicateStrategy 处理，被覆盖的图片保存为历史版本。
+func (t *TrashService) Restore(id, user string) (*catalog.Record, *errors.AppError) {
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	e, ok := t.trash.Get(id)
+	if !ok {
+		return nil, errors.ErrTrashNotFound
+	}
+
+	images := NewImageService()
+	name, reserved, appErr := images.resolveDuplicate(e.Filename)
+	if appErr != nil {
+		return nil, appErr
+	}
+	replaced, overwritten := t.catalog.Get(name)
+	var snapshot string
+	if !reserved {
+		var err error
+		if snapshot, err = NewVersionService().Snapshot(name, user); err != nil {
+			t.logger.Error("Failed to save the previous version of %s: %v", name, err)
+			return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to save the previous version", err)
+		}
+	}
+
+	if err := t.storage.Rename(e.Object, name); err != nil {
+		if reserved {
+			images.release(name)
+		}
+		NewVersionService().Discard(snapshot)
+		t.logger.Error("Failed to restore %s from the trash: %v", e.Filename, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to restore file", err)
+	}
+
+	rec := e.Record
+	rec.Filename = name
+	if info, err := t.storage.Stat(name); err == nil {
+		rec.Size = info.Size
+		rec.ModTime = info.ModTime
+	}
+	if err := t.catalog.Put(rec); err != nil {
+		t.logger.Error("Failed to record %s in catalog: %v", name, err)
+	}
+
+	// 覆盖已有图片时，被替换内容的缩略图和变换结果不再有效
+	if overwritten {
+		if replaced.Checksum != rec.Checksum {
+			if err := removeTransforms(t.config, replaced.Checksum); err != nil {
+				t.logger.Warn("Failed to drop cached transforms of %s: %v", name, err)
+			}
+		}
+		if err := t.storage.Delete(thumbnailName(name)); err != nil && !storage.IsNotExist(err) {
+			t.logger.Warn("Failed to delete thumbnail of %s: %v", name, err)
+		}
+	}
+
+	// 恢复的历史版本排在被覆盖内容的版本之后
+	if _, err := t.versions.RenameFile(e.Object, name); err != nil {
+		t.logger.Warn("Failed to restore versions of %s: %v", name, err)
+	}
+
+	for _, albumID := range e.Albums {
+		_, err := t.albums.Update(albumID, func(a *album.Album) error {
+			if !a.Contains(name) {
+				a.Images = append(a.Images, name)
+			}
+			return nil
+		})
+		if err != nil && err != album.ErrNotFound {
+			t.logger.Warn("Failed to restore %s to album %s: %v", name, albumID, err)
+		}
+	}
+
+	if err := t.trash.Delete(id); err != nil {
+		t.logger.Error("Failed to remove trash entry %s: %v", id, err)
+	}
+	t.removeEntryDir(id)
+
+	t.logger.Info("Image restored from trash: %s -> %s", e.Filename, name)
+	return &rec, nil
+}
+
+// Purge 彻底删除回收站中的一张图片
+func (t *TrashService) Purge(id string) *errors.AppError {
+	e, ok := t.trash.Get(id)
+	if !ok {
+		return errors.ErrTrashNotFound
+	}
+
+	if err := t.purge(e); err != nil {
+		t.logger.Error("Failed to purge %s from the trash: %v", e.Filename, err)
+		return errors.NewErrorWithCause(http.StatusInternalServerError, "failed to purge file", err)
+	}
+	return nil
+}
+
+// PurgeAll 清空回收站，返回删除的数量
+func (t *TrashService) PurgeAll() int {
+	return t.purgeEntries(t.trash.All())
+}
+
+// PurgeExpired 彻底删除超过 File.Trash.Retention 的图片，返回删除的数量
+func (t *TrashService) PurgeExpired() int {
+	retention := t.config.File.Trash.Retention
+	if retention <= 0 {
+		return 0
+	}
+	return t.purgeEntries(t.trash.DeletedBefore(time.Now().Add(-retention)))
+}
+
+// StartAutoPurge 启动后台定时任务，每小时清除过期的回收站图片
+func (t *TrashService) StartAutoPurge() {
+	if t.config.File.Trash.Retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if n := t.PurgeExpired(); n > 0 {
+				t.logger.Info("Purged %d expired images from the trash", n)
+			}
+			<-ticker.C
+		}
+	}()
+
+	t.logger.Info("Trash auto purge started with retention: %v", t.config.File.Trash.Retention)
+}
+
+// purgeEntries 彻底删除多张图片，出错的记录在日志中并保留
+func (t *TrashService) purgeEntries(entries []trash.Entry) int {
+	purged := 0
+	for _, e := range entries {
+		if err := t.purge(e); err != nil {
+			t.logger.Error("Failed to purge %s from the trash: %v", e.Filename, err)
+			continue
+		}
+		purged++
+	}
+	return purged
+}
+
+// purge 删除回收站中的文件、历史版本及其记录；文件已不存在时只删除历史版本和记录
+func (t *TrashService) purge(e trash.Entry) error {
+	if err := t.storage.Delete(e.Object); err != nil && !storage.IsNotExist(err) {
+		return err
+	}
+	NewVersionService().RemoveAll(e.Object)
+	if err := t.trash.Delete(e.ID); err != nil && err != trash.ErrNotFound {
+		return err
+	}
+	t.removeEntryDir(e.ID)
+
+	t.logger.Info("Image purged from trash: %s (%s)", e.Filename, e.ID)
+	return nil
+}
+
+// removeEntryDir 删除条目的空目录（只有本地存储存在目录）
+func (t *TrashService) removeEntryDir(id string) {
+	_ = t.storage.Delete(trashDir + "/" + id)
+}
+
+// item 转换为响应格式
+func (t *TrashService) item(e trash.Entry) TrashItem {
+	item := TrashItem{
+		ID:        e.ID,
+		Filename:  e.Filename,
+		Size:      e.Size,
+		MimeType:  e.Record.MimeType,
+		Tags:      e.Record.Tags,
+		DeletedAt: e.DeletedAt,
+		DeletedBy: e.DeletedBy,
+		Reason:    e.Reason,
+	}
+	if retention := t.config.File.Trash.Retention; retention > 0 {
+		expires := e.DeletedAt.Add(retention)
+		item.ExpiresAt = &expires
+	}
+	return item
+}
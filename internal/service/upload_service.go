@@ -0,0 +1,370 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/uploads"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+)
+
+// TusVersion 支持的 tus 协议版本
+const TusVersion = "1.0.0"
+
+// TusExtensions 支持的 tus 扩展
+const TusExtensions = "creation,creation-with-upload,termination,expiration"
+
+// uploadLocks 上传 ID -> *sync.Mutex，同一个上传的写入依次进行
+var uploadLocks sync.Map
+
+// UploadUser 访问上传的用户，只有创建者和管理员可以访问
+type UploadUser struct {
+	Name  string
+	Admin bool
+}
+
+// canAccess 判断用户能否访问上传
+func (u UploadUser) canAccess(up *uploads.Upload) bool {
+	return u.Admin || up.Uploader == u.Name
+}
+
+// UploadInfo 可恢复上传的状态
+type UploadInfo struct {
+	ID        string            `json:"id"`
+	URL       string            `json:"url"`
+	Filename  string            `json:"filename"`
+	Folder    string            `json:"folder,omitempty"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Uploader  string            `json:"uploader,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt *time.Time        `json:"expires_at,omitempty"`
+	Status    string            `json:"status"`
+	Image     string            `json:"image,omitempty"`
+	ImageURL  string            `json:"image_url,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// UploadService 可恢复上传服务（tus 1.0）。已接收的内容保存在本地的 File.Resumable.Dir 中，
+// 全部接收后按普通上传的校验和重名策略保存为图片
+type UploadService struct {
+	config  *config.Config
+	logger  *logger.Logger
+	uploads *uploads.Store
+}
+
+// NewUploadService 创建可恢复上传服务
+func NewUploadService() *UploadService {
+	return &UploadService{
+		config:  config.GetConfig(),
+		logger:  logger.GetLogger(),
+		uploads: GetUploads(),
+	}
+}
+
+// MaxSize 返回单个上传允许的最大字节数
+func (u *UploadService) MaxSize() int64 {
+	return u.config.File.MaxSize * 1024 * 1024
+}
+
+// Create 创建一个 length 字节的上传。metadata 为解码后的 Upload-Metadata，
+// 图片名称取自 filename（或 name），opts 决定完成后如何保存
+func (u *UploadService) Create(length int64, metadata map[string]string, opts SaveOptions) (*uploads.Upload, *errors.AppError) {
+	filename := metadata["filename"]
+	if filename == "" {
+		filename = metadata["name"]
+	}
+	if filename == "" {
+		return nil, errors.NewError(http.StatusBadRequest, "filename metadata required")
+	}
+	if length <= 0 {
+		return nil, errors.NewError(http.StatusBadRequest, "upload length must be positive")
+	}
+	if appErr := NewImageService().validateFile(filename, length); appErr != nil {
+		return nil, appErr
+	}
+	if opts.Folder != "" {
+		if _, appErr := NewFolderService().Resolve(opts.Folder); appErr != nil {
+			return nil, appErr
+		}
+	}
+
+	id, err := uploads.NewID()
+	if err != nil {
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to create upload", err)
+	}
+	now := time.Now().UTC()
+	up := uploads.Upload{
+		ID:        id,
+		Length:    length,
+		Metadata:  metadata,
+		Filename:  filename,
+		Folder:    opts.Folder,
+		Scrub:     opts.Scrub,
+		Uploader:  opts.Uploader,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    uploads.StatusUploading,
+	}
+	u.touch(&up)
+
+	// 先保存记录再创建文件，清理时没有记录的文件都是残留
+	if err := u.uploads.Put(up); err != nil {
+		u.logger.Error("Failed to record upload %s: %v", id, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to create upload", err)
+	}
+	if err := u.createData(id); err != nil {
+		_ = u.uploads.Delete(id)
+		u.logger.Error("Failed to create upload %s: %v", id, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to create upload", err)
+	}
+
+	u.logger.Info("Upload %s created for %s (%d bytes)", id, filename, length)
+	return &up, nil
+}
+
+// Get 获取上传
+func (u *UploadService) Get(id string, user UploadUser) (*uploads.Upload, *errors.AppError) {
+	up, ok := u.uploads.Get(id)
+	if !ok || !user.canAccess(&up) {
+		return nil, errors.ErrUploadNotFound
+	}
+	if !up.ExpiresAt.IsZero() && time.Now().After(up.ExpiresAt) {
+		return nil, errors.NewError(http.StatusGone, "upload expired")
+	}
+	return &up, nil
+}
+
+// Write 从 offset 处追加 r 的内容，offset 必须等于已接收的字节数。
+// 超出上传长度的内容被忽略；连接中断时已收到的部分同样保留。
+// 全部接收后保存为图片，保存失败（格式不支持、重名被拒绝等）的原因记录在上传中并返回
+func (u *UploadService) Write(id string, offset int64, r io.Reader, user UploadUser) (*uploads.Upload, *errors.AppError) {
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	up, appErr := u.Get(id, user)
+	if appErr != nil {
+		return nil, appErr
+	}
+	if offset != up.Offset {
+		return up, errors.NewError(http.StatusConflict, "upload offset mismatch")
+	}
+	if up.Done() {
+		return up, nil
+	}
+
+	n, writeErr := u.appendData(up, r)
+	up.Offset += n
+	up.UpdatedAt = time.Now().UTC()
+	u.touch(up)
+	if err := u.uploads.Put(*up); err != nil {
+		u.logger.Error("Failed to record upload %s: %v", id, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to record upload", err)
+	}
+	if writeErr != nil {
+		u.logger.Warn("Upload %s interrupted at %d of %d bytes: %v", id, up.Offset, up.Length, writeErr)
+		return up, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to write upload", writeErr)
+	}
+
+	if up.Offset == up.Length {
+		return u.complete(up)
+	}
+	return up, nil
+}
+
+// Terminate 终止上传并删除已接收的内容；已完成的上传只删除记录
+func (u *UploadService) Terminate(id string, user UploadUser) *errors.AppError {
+	lock, _ := uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	up, ok := u.uploads.Get(id)
+	if !ok || !user.canAccess(&up) {
+		return errors.ErrUploadNotFound
+	}
+	if err := u.remove(up); err != nil {
+		u.logger.Error("Failed to terminate upload %s: %v", id, err)
+		return errors.NewErrorWithCause(http.StatusInternalServerError, "failed to terminate upload", err)
+	}
+
+	u.logger.Info("Upload %s terminated", id)
+	return nil
+}
+
+// PurgeExpired 删除过期的上传以及没有记录的残留内容，返回删除的上传数量
+func (u *UploadService) PurgeExpired() int {
+	purged := 0
+	for _, up := range u.uploads.ExpiredBefore(time.Now()) {
+		if err := u.remove(up); err != nil {
+			u.logger.Error("Failed to remove expired upload %s: %v", up.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	entries, err := os.ReadDir(u.config.File.Resumable.Dir)
+	if err != nil {
+		return purged
+	}
+	for _, entry := range entries {
+		if _, ok := u.uploads.Get(entry.Name()); !ok && !entry.IsDir() {
+			_ = os.Remove(filepath.Join(u.config.File.Resumable.Dir, entry.Name()))
+		}
+	}
+	return purged
+}
+
+// StartAutoExpire 启动后台定时任务，每小时清除过期的上传
+func (u *UploadService) StartAutoExpire() {
+	if u.config.File.Resumable.Expiration <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			if n := u.PurgeExpired(); n > 0 {
+				u.logger.Info("Removed %d expired uploads", n)
+			}
+			<-ticker.C
+		}
+	}()
+
+	u.logger.Info("Upload expiration started with expiration: %v", u.config.File.Resumable.Expiration)
+}
+
+// Info 转换为响应格式
+func (u *UploadService) Info(up *uploads.Upload, hostURL string) UploadInfo {
+	info := UploadInfo{
+		ID:        up.ID,
+		URL:       "/api/v1/uploads/" + up.ID,
+		Filename:  up.Filename,
+		Folder:    up.Folder,
+		Length:    up.Length,
+		Offset:    up.Offset,
+		Metadata:  up.Metadata,
+		Uploader:  up.Uploader,
+		CreatedAt: up.CreatedAt,
+		Status:    up.Status,
+		Image:     up.Image,
+		Error:     up.Error,
+	}
+	if !up.ExpiresAt.IsZero() {
+		info.ExpiresAt = &up.ExpiresAt
+	}
+	if up.Image != "" {
+		info.ImageURL = hostURL + "/f/" + up.Image
+	}
+	return info
+}
+
+// complete 将接收完毕的内容按普通上传保存为图片并删除暂存的内容
+func (u *UploadService) complete(up *uploads.Upload) (*uploads.Upload, *errors.AppError) {
+	images := NewImageService()
+	appErr := images.validateFile(up.Filename, up.Offset)
+
+	var saved *SavedImage
+	if appErr == nil {
+		f, err := os.Open(u.dataPath(up.ID))
+		if err != nil {
+			u.logger.Error("Failed to open upload %s: %v", up.ID, err)
+			return up, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to open upload", err)
+		}
+		saved, appErr = images.SaveUpload(up.Filename, f, SaveOptions{
+			Uploader: up.Uploader,
+			Folder:   up.Folder,
+			Scrub:    up.Scrub,
+		})
+		f.Close()
+	}
+
+	if appErr != nil {
+		up.Status = uploads.StatusFailed
+		up.Error = appErr.Message
+	} else {
+		up.Status = uploads.StatusCompleted
+		up.Image = saved.Filename
+	}
+	if err := u.uploads.Put(*up); err != nil {
+		u.logger.Error("Failed to record upload %s: %v", up.ID, err)
+	}
+	u.removeData(up.ID)
+
+	if appErr != nil {
+		u.logger.Warn("Upload %s of %s rejected: %s", up.ID, up.Filename, appErr.Message)
+		return up, appErr
+	}
+
+	go NewTransformService().GenerateEagerPresets(saved.Filename)
+	u.logger.Info("Upload %s completed as %s", up.ID, saved.Filename)
+	return up, nil
+}
+
+// touch 按 File.Resumable.Expiration 延长上传的有效期
+func (u *UploadService) touch(up *uploads.Upload) {
+	if expiration := u.config.File.Resumable.Expiration; expiration > 0 {
+		up.ExpiresAt = time.Now().UTC().Add(expiration)
+	}
+}
+
+// createData 创建空的暂存文件
+func (u *UploadService) createData(id string) error {
+	if err := os.MkdirAll(u.config.File.Resumable.Dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(u.dataPath(id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// appendData 在暂存文件的 up.Offset 处写入 r，最多写到上传长度，返回写入的字节数
+func (u *UploadService) appendData(up *uploads.Upload, r io.Reader) (int64, error) {
+	f, err := os.OpenFile(u.dataPath(up.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	// 上次写入后记录失败时文件可能比偏移长，丢弃没有记录的部分
+	if err := f.Truncate(up.Offset); err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(up.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return io.Copy(f, io.LimitReader(r, up.Length-up.Offset))
+}
+
+// remove 删除上传的记录和暂存内容
+func (u *UploadService) remove(up uploads.Upload) error {
+	if err := u.uploads.Delete(up.ID); err != nil && err != uploads.ErrNotFound {
+		return err
+	}
+	u.removeData(up.ID)
+	uploadLocks.Delete(up.ID)
+	return nil
+}
+
+// removeData 删除暂存文件（可能已不存在）
+func (u *UploadService) removeData(id string) {
+	if err := os.Remove(u.dataPath(id)); err != nil && !os.IsNotExist(err) {
+		u.logger.Warn("Failed to remove data of upload %s: %v", id, err)
+	}
+}
+
+// dataPath 返回上传的暂存文件路径
+func (u *UploadService) dataPath(id string) string {
+	return filepath.Join(u.config.File.Resumable.Dir, id)
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/uploads"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+	bolt "go.etcd.io/bbolt"
+)
+
+// TestMain 在临时目录中运行测试（日志写入 ./logs），所有数据保存在内存中
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "service-test")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+
+	cfg := config.Init()
+	cfg.Database.Path = ""
+	cfg.Transform.Presets = nil
+	if _, err := InitDatabase(cfg); err != nil {
+		panic(err)
+	}
+	SetStorage(storage.NewMemoryStorage())
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestUploadOffsetMismatch(t *testing.T) {
+	u := newUploadService(t, nil, t.TempDir())
+	owner := UploadUser{Name: "alice"}
+	up := createUpload(t, u, owner, 10)
+
+	if _, appErr := u.Write(up.ID, 0, bytes.NewReader([]byte("abcd")), owner); appErr != nil {
+		t.Fatalf("Write: %v", appErr)
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		offset int64
+		user   UploadUser
+		code   int
+	}{
+		{"behind", up.ID, 0, owner, http.StatusConflict},
+		{"ahead", up.ID, 6, owner, http.StatusConflict},
+		{"other user", up.ID, 4, UploadUser{Name: "bob"}, http.StatusNotFound},
+		{"unknown upload", "missing", 4, owner, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, appErr := u.Write(tt.id, tt.offset, bytes.NewReader([]byte("xx")), tt.user)
+			if appErr == nil || appErr.Code != tt.code {
+				t.Errorf("Write at %d = %v, want %d", tt.offset, appErr, tt.code)
+			}
+			if got, _ := u.Get(up.ID, owner); got.Offset != 4 {
+				t.Errorf("offset after rejected write = %d, want 4", got.Offset)
+			}
+		})
+	}
+
+	// 管理员可以继续任何人的上传
+	if got, appErr := u.Write(up.ID, 4, bytes.NewReader([]byte("ef")), UploadUser{Admin: true}); appErr != nil || got.Offset != 6 {
+		t.Errorf("admin Write = %+v, %v; want offset 6", got, appErr)
+	}
+}
+
+func TestUploadResume(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "uploads.db")
+	db := openTestDB(t, path)
+	u := newUploadService(t, db, dir)
+	owner := UploadUser{Name: "alice"}
+	content := testPNG(t)
+	up := createUpload(t, u, owner, int64(len(content)))
+
+	// 连接中断时已收到的部分保留下来
+	half := int64(len(content) / 2)
+	r := io.MultiReader(bytes.NewReader(content[:half]), errReader{errors.New("connection reset")})
+	got, appErr := u.Write(up.ID, 0, r, owner)
+	if appErr == nil || got == nil || got.Offset != half {
+		t.Fatalf("interrupted Write = %+v, %v; want offset %d and an error", got, appErr, half)
+	}
+
+	// 重启后从记录的偏移继续
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	u = newUploadService(t, openTestDB(t, path), dir)
+	got, appErr = u.Get(up.ID, owner)
+	if appErr != nil || got.Offset != half || got.Status != uploads.StatusUploading {
+		t.Fatalf("Get after restart = %+v, %v", got, appErr)
+	}
+
+	got, appErr = u.Write(up.ID, half, bytes.NewReader(content[half:]), owner)
+	if appErr != nil {
+		t.Fatalf("Write: %v", appErr)
+	}
+	if got.Status != uploads.StatusCompleted || got.Offset != got.Length || got.Image == "" {
+		t.Errorf("completed upload = %+v", got)
+	}
+	if _, err := os.Stat(u.dataPath(up.ID)); !os.IsNotExist(err) {
+		t.Errorf("staged content left behind: %v", err)
+	}
+
+	f, _, appErr := NewImageService().OpenImage(got.Image)
+	if appErr != nil {
+		t.Fatalf("OpenImage: %v", appErr)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil || img.Bounds().Dx() != 8 {
+		t.Errorf("stored image = %v, %v", img.Bounds(), err)
+	}
+
+	// 重复的写入不会再次保存
+	if again, appErr := u.Write(up.ID, got.Length, bytes.NewReader(nil), owner); appErr != nil || again.Image != got.Image {
+		t.Errorf("Write after completion = %+v, %v", again, appErr)
+	}
+}
+
+func TestUploadExpiry(t *testing.T) {
+	u := newUploadService(t, nil, t.TempDir())
+	owner := UploadUser{Name: "alice"}
+
+	up := createUpload(t, u, owner, 10)
+	if want := time.Now().Add(u.config.File.Resumable.Expiration); up.ExpiresAt.Before(want.Add(-time.Minute)) || up.ExpiresAt.After(want) {
+		t.Errorf("ExpiresAt = %v, want about %v", up.ExpiresAt, want)
+	}
+	kept := createUpload(t, u, owner, 10)
+
+	expired := *up
+	expired.ExpiresAt = time.Now().Add(-time.Second)
+	if err := u.uploads.Put(expired); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if _, appErr := u.Get(up.ID, owner); appErr == nil || appErr.Code != http.StatusGone {
+		t.Errorf("Get of expired upload = %v, want 410", appErr)
+	}
+	if _, appErr := u.Write(up.ID, 0, bytes.NewReader([]byte("x")), owner); appErr == nil || appErr.Code != http.StatusGone {
+		t.Errorf("Write to expired upload = %v, want 410", appErr)
+	}
+
+	// 没有记录的残留内容同样被清除
+	stray := filepath.Join(u.config.File.Resumable.Dir, "stray")
+	if err := os.WriteFile(stray, []byte("x"), 0644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if n := u.PurgeExpired(); n != 1 {
+		t.Errorf("PurgeExpired = %d, want 1", n)
+	}
+	if _, ok := u.uploads.Get(up.ID); ok {
+		t.Errorf("expired upload still recorded")
+	}
+	for _, name := range []string{u.dataPath(up.ID), stray} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", filepath.Base(name), err)
+		}
+	}
+	if _, appErr := u.Get(kept.ID, owner); appErr != nil {
+		t.Errorf("unexpired upload removed: %v", appErr)
+	}
+	if _, err := os.Stat(u.dataPath(kept.ID)); err != nil {
+		t.Errorf("content of unexpired upload removed: %v", err)
+	}
+}
+
+// newUploadService 创建记录保存在 db（nil 时在内存中）、内容暂存在 dir 的上传服务
+func newUploadService(t *testing.T, db *bolt.DB, dir string) *UploadService {
+	t.Helper()
+	store, err := uploads.Open(db)
+	if err != nil {
+		t.Fatalf("uploads.Open: %v", err)
+	}
+	cfg := config.GetConfig()
+	cfg.File.Resumable.Dir = dir
+	return &UploadService{config: cfg, logger: logger.GetLogger(), uploads: store}
+}
+
+// createUpload 创建一个 length 字节的上传
+func createUpload(t *testing.T, u *UploadService, user UploadUser, length int64) *uploads.Upload {
+	t.Helper()
+	up, appErr := u.Create(length, map[string]string{"filename": "resume.png"}, SaveOptions{Uploader: user.Name})
+	if appErr != nil {
+		t.Fatalf("Create: %v", appErr)
+	}
+	return up
+}
+
+func openTestDB(t *testing.T, path string) *bolt.DB {
+	t.Helper()
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatalf("bolt.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testPNG 返回一张 8x4 的 PNG 图片
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 4))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i * 7)
+	}
+	img.Set(0, 0, color.White)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return buf.Bytes()
+}
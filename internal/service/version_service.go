@@ -0,0 +1,314 @@
+package service
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	"github.com/gantoho/go-img-sys/internal/config"
+	"github.com/gantoho/go-img-sys/internal/versions"
+	"github.com/gantoho/go-img-sys/pkg/errors"
+	"github.com/gantoho/go-img-sys/pkg/logger"
+	"github.com/gantoho/go-img-sys/pkg/storage"
+)
+
+// versionsDir 历史版本目录，以 "." 开头因此不会出现在图片列表中，也无法通过 /f/ 访问
+const versionsDir = ".versions"
+
+// VersionInfo 图片的一个历史版本
+type VersionInfo struct {
+	ID         string    `json:"id"`
+	Number     int       `json:"number"`
+	Filename   string    `json:"filename"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mime_type,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	Checksum   string    `json:"checksum,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	Uploader   string    `json:"uploader,omitempty"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	URL        string    `json:"url"`
+}
+
+// VersionService 历史版本服务。图片被覆盖前的内容复制到 .versions/<id>/ 下，
+// 可以下载或恢复
+type VersionService struct {
+	config   *config.Config
+	logger   *logger.Logger
+	storage  storage.Storage
+	catalog  *catalog.Catalog
+	versions *versions.Store
+}
+
+// NewVersionService 创建历史版本服务
+func NewVersionService() *VersionService {
+	return &VersionService{
+		config:   config.GetConfig(),
+		logger:   logger.GetLogger(),
+		storage:  GetStorage(),
+		catalog:  GetCatalog(),
+		versions: GetVersions(),
+	}
+}
+
+// Snapshot 在图片被覆盖前保存其当前内容，by 为覆盖者，返回版本ID。
+// 未启用历史版本或没有需要保存的内容时不做任何事，返回空ID。
+// 覆盖失败时调用方应使用 Discard 删除该版本
+func (v *VersionService) Snapshot(name, by string) (string, error) {
+	if !v.config.File.Versions.Enabled {
+		return "", nil
+	}
+
+	id, err := versions.NewID()
+	if err != nil {
+		return "", err
+	}
+	rec, ok := v.catalog.Get(name)
+	if !ok {
+		// 上传预留的空占位不是图片，没有需要保存的内容
+		if info, err := v.storage.Stat(name); err == nil && info.Size == 0 {
+			return "", nil
+		}
+		rec = catalog.Record{Filename: name}
+	}
+	object := versionsDir + "/" + id + "/" + path.Base(name)
+
+	// 复制而不是移动，覆盖完成前原图始终可以访问
+	r, err := v.storage.Get(name)
+	if err != nil {
+		return "", err
+	}
+	info, err := v.storage.Put(object, r)
+	r.Close()
+	if err != nil {
+		return "", err
+	}
+	rec.Size = info.Size
+
+	ver, err := v.versions.Add(versions.Version{
+		ID:         id,
+		Filename:   name,
+		Object:     object,
+		ReplacedAt: time.Now().UTC(),
+		ReplacedBy: by,
+		Record:     rec,
+	})
+	if err != nil {
+		v.removeObject(object, id)
+		return "", err
+	}
+
+	v.logger.Info("Version %d of %s saved (%s)", ver.Number, name, id)
+	return id, nil
+}
+
+// Discard 删除 Snapshot 刚保存的版本，用于覆盖失败、原内容并未被替换时。id 为空时不做任何事
+func (v *VersionService) Discard(id string) {
+	if id == "" {
+		return
+	}
+	ver, ok := v.versions.Get(id)
+	if !ok {
+		return
+	}
+	if err := v.remove(ver); err != nil {
+		v.logger.Warn("Failed to discard version %s of %s: %v", id, ver.Filename, err)
+	}
+}
+
+// List 列出图片的历史版本，最新的在前
+func (v *VersionService) List(filename, hostURL string) ([]VersionInfo, *errors.AppError) {
+	name, appErr := v.cleanName(filename)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	list := v.versions.ForFile(name)
+	if len(list) == 0 {
+		if _, err := v.storage.Stat(name); err != nil {
+			return nil, errors.ErrFileNotFound
+		}
+	}
+
+	result := make([]VersionInfo, 0, len(list))
+	for _, ver := range list {
+		result = append(result, v.info(ver, hostURL))
+	}
+	return result, nil
+}
+
+// Open 打开图片的一个历史版本用于下载
+func (v *VersionService) Open(filename, id string) (io.ReadSeekCloser, *versions.Version, *errors.AppError) {
+	ver, appErr := v.find(filename, id)
+	if appErr != nil {
+		return nil, nil, appErr
+	}
+
+	file, err := v.storage.Open(ver.Object)
+	if err != nil {
+		if storage.IsNotExist(err) {
+			return nil, nil, errors.ErrVersionNotFound
+		}
+		v.logger.Error("Failed to open version %s of %s: %v", id, ver.Filename, err)
+		return nil, nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to open version", err)
+	}
+	return file, ver, nil
+}
+
+// Revert 将图片恢复为指定的历史版本。当前内容先保存为新的历史版本，
+// 恢复的版本成为当前内容后从历史中移除；标签属于文件名，保持不变。
+func (v *VersionService) Revert(filename, id, by string) (*catalog.Record, *errors.AppError) {
+	renameMu.Lock()
+	defer renameMu.Unlock()
+
+	ver, appErr := v.find(filename, id)
+	if appErr != nil {
+		return nil, appErr
+	}
+	name := ver.Filename
+	if _, err := v.storage.Stat(name); err != nil {
+		return nil, errors.ErrFileNotFound
+	}
+
+	current, err := v.Snapshot(name, by)
+	if err != nil {
+		v.logger.Error("Failed to save the current version of %s: %v", name, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to save the current version", err)
+	}
+
+	r, err := v.storage.Get(ver.Object)
+	if err != nil {
+		v.Discard(current)
+		v.logger.Error("Failed to open version %s of %s: %v", id, name, err)
+		return nil, errors.NewErrorWithCause(http.StatusInternalServerError, "failed to open version", err)
+	}
+	saved, appErr := NewImageService().putImage(name, r, ver.Record)
+	r.Close()
+	if appErr != nil {
+		v.Discard(current)
+		return nil, appErr
+	}
+
+	if err := v.remove(*ver); err != nil {
+		v.logger.Warn("Failed to remove reverted version %s of %s: %v", id, name, err)
+	}
+
+	if _, err := v.storage.Stat(thumbnailName(name)); err == nil {
+		if err := NewThumbnailService().Generate(name); err != nil {
+			v.logger.Warn("Failed to regenerate thumbnail of %s: %v", name, err)
+		}
+	}
+
+	v.logger.Info("Image %s reverted to version %d", name, ver.Number)
+	return &saved.Record, nil
+}
+
+// RemoveAll 删除图片的全部历史版本
+func (v *VersionService) RemoveAll(name string) {
+	for _, ver := range v.versions.ForFile(name) {
+		if err := v.remove(ver); err != nil {
+			v.logger.Warn("Failed to remove version %s of %s: %v", ver.ID, name, err)
+		}
+	}
+}
+
+// Prune 删除每张图片超过 maxCount 个的旧版本以及早于 maxAge 的版本，
+// 两者为 0 时不限制。返回删除的版本数与释放的字节数
+func (v *VersionService) Prune(maxCount int, maxAge time.Duration) (int, int64, []string) {
+	var cutoff time.Time
+	if maxAge > 0 {
+		cutoff = time.Now().Add(-maxAge)
+	}
+
+	removed, freed := 0, int64(0)
+	var errs []string
+	kept := make(map[string]int)
+	// All 按文件名分组、最新的在前
+	for _, ver := range v.versions.All() {
+		kept[ver.Filename]++
+		tooMany := maxCount > 0 && kept[ver.Filename] > maxCount
+		tooOld := !cutoff.IsZero() && ver.ReplacedAt.Before(cutoff)
+		if !tooMany && !tooOld {
+			continue
+		}
+
+		if err := v.remove(ver); err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		removed++
+		freed += ver.Record.Size
+	}
+
+	if removed > 0 {
+		v.logger.Info("Pruned %d image versions", removed)
+	}
+	return removed, freed, errs
+}
+
+// find 查找属于 filename 的历史版本
+func (v *VersionService) find(filename, id string) (*versions.Version, *errors.AppError) {
+	name, appErr := v.cleanName(filename)
+	if appErr != nil {
+		return nil, appErr
+	}
+
+	ver, ok := v.versions.Get(id)
+	if !ok || ver.Filename != name {
+		return nil, errors.ErrVersionNotFound
+	}
+	return &ver, nil
+}
+
+// cleanName 规范化图片名称
+func (v *VersionService) cleanName(filename string) (string, *errors.AppError) {
+	name, err := storage.CleanName(filename)
+	if err != nil || !isCatalogName(name) {
+		return "", errors.ErrFileNotFound
+	}
+	return name, nil
+}
+
+// remove 删除一个历史版本的文件和记录
+func (v *VersionService) remove(ver versions.Version) error {
+	if err := v.storage.Delete(ver.Object); err != nil && !storage.IsNotExist(err) {
+		return err
+	}
+	if err := v.versions.Delete(ver.ID); err != nil && err != versions.ErrNotFound {
+		return err
+	}
+	v.removeObject("", ver.ID)
+	return nil
+}
+
+// removeObject 删除版本文件（可为空）和它的空目录（只有本地存储存在目录）
+func (v *VersionService) removeObject(object, id string) {
+	if object != "" {
+		_ = v.storage.Delete(object)
+	}
+	_ = v.storage.Delete(versionsDir + "/" + id)
+}
+
+// info 转换为响应格式
+func (v *VersionService) info(ver versions.Version, hostURL string) VersionInfo {
+	return VersionInfo{
+		ID:         ver.ID,
+		Number:     ver.Number,
+		Filename:   ver.Filename,
+		Size:       ver.Record.Size,
+		MimeType:   ver.Record.MimeType,
+		Width:      ver.Record.Width,
+		Height:     ver.Record.Height,
+		Checksum:   ver.Record.Checksum,
+		UploadedAt: ver.Record.UploadedAt,
+		Uploader:   ver.Record.Uploader,
+		ReplacedAt: ver.ReplacedAt,
+		ReplacedBy: ver.ReplacedBy,
+		URL:        hostURL + "/api/v1/images/" + url.PathEscape(ver.Filename) + "/versions/" + ver.ID,
+	}
+}
@@ -0,0 +1,194 @@
+// Package trash records deleted images kept in the trash area of the
+// storage, so they can be restored or purged later. Entries are kept in
+// memory, with every change written through to a bbolt database like the
+// image catalog.
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// trashBucket is the bbolt bucket holding one JSON document per entry
+var trashBucket = []byte("trash")
+
+// Reasons an image was moved to the trash
+const (
+	ReasonDeleted = "deleted" // deleted through the API
+	ReasonFolder  = "folder"  // part of a deleted folder
+	ReasonCleanup = "cleanup" // removed by the old files cleanup
+)
+
+// ErrNotFound is returned when an entry does not exist
+var ErrNotFound = errors.New("trash: entry not found")
+
+// Entry is a deleted image waiting in the trash
+type Entry struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"` // name the image had before deletion
+	// Object is the storage name of the trashed content
+	Object    string    `json:"object"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by,omitempty"` // empty for automatic deletions
+	Reason    string    `json:"reason"`
+	// Record is the catalog record at deletion, restored with the image
+	Record catalog.Record `json:"record"`
+	// Albums are the IDs of the albums that contained the image
+	Albums []string `json:"albums,omitempty"`
+}
+
+// Store keeps all entries in memory and persists them to a bbolt database
+type Store struct {
+	mu      sync.RWMutex
+	db      *bolt.DB // nil when the trash is not persisted
+	entries map[string]*Entry
+}
+
+// Open loads the entries from db. A nil db gives an in-memory store.
+func Open(db *bolt.DB) (*Store, error) {
+	s := &Store{
+		db:      db,
+		entries: make(map[string]*Entry),
+	}
+
+	if db == nil {
+		return s, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(trashBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var e Entry
+			if err := json.Unmarshal(v, &e); err != nil {
+				return nil // skip corrupt entries
+			}
+			s.entries[e.ID] = &e
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the entry with the given ID
+func (s *Store) Get(id string) (Entry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	e, ok := s.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return *e, true
+}
+
+// All returns all entries, most recently deleted first
+func (s *Store) All() []Entry {
+	s.mu.RLock()
+	result := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		result = append(result, *e)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].DeletedAt.Equal(result[j].DeletedAt) {
+			return result[i].DeletedAt.After(result[j].DeletedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// DeletedBefore returns the entries deleted before t
+func (s *Store) DeletedBefore(t time.Time) []Entry {
+	var result []Entry
+	for _, e := range s.All() {
+		if e.DeletedAt.Before(t) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// Put stores e, replacing any entry with the same ID
+func (s *Store) Put(e Entry) error {
+	if err := s.persist(e.ID, &e); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.entries[e.ID] = &e
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes an entry
+func (s *Store) Delete(id string) error {
+	if _, ok := s.Get(id); !ok {
+		return ErrNotFound
+	}
+	if err := s.persist(id, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.entries, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of entries
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// persist writes e (or deletes the key when e is nil) to the database
+func (s *Store) persist(id string, e *Entry) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(trashBucket)
+		if err != nil {
+			return err
+		}
+		if e == nil {
+			return bucket.Delete([]byte(id))
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// NewID generates a random entry ID
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,203 @@
+// Package uploads records resumable uploads in progress, so clients can
+// continue them after a dropped connection or a server restart. The content
+// received so far is kept in a staging directory by the upload service;
+// entries are kept in memory, with every change written through to a bbolt
+// database like the image catalog.
+package uploads
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// uploadsBucket is the bbolt bucket holding one JSON document per upload
+var uploadsBucket = []byte("uploads")
+
+// States of an upload
+const (
+	StatusUploading = "uploading" // waiting for more content
+	StatusCompleted = "completed" // stored as an image
+	StatusFailed    = "failed"    // complete, but the image was rejected
+)
+
+// ErrNotFound is returned when an upload does not exist
+var ErrNotFound = errors.New("uploads: not found")
+
+// Upload is a resumable upload
+type Upload struct {
+	ID string `json:"id"`
+	// Length is the total size announced when the upload was created
+	Length int64 `json:"length"`
+	// Offset is the number of bytes received so far
+	Offset int64 `json:"offset"`
+	// Metadata is the Upload-Metadata sent on creation, decoded
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Filename, Folder and Scrub are how the image is saved once complete
+	Filename  string    `json:"filename"`
+	Folder    string    `json:"folder,omitempty"`
+	Scrub     *bool     `json:"scrub,omitempty"`
+	Uploader  string    `json:"uploader,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// ExpiresAt is when the upload is discarded, zero for never
+	ExpiresAt time.Time `json:"expires_at"`
+	Status    string    `json:"status"`
+	// Image is the name the image was stored under once completed
+	Image string `json:"image,omitempty"`
+	// Error tells why a complete upload was not stored
+	Error string `json:"error,omitempty"`
+}
+
+// Done reports whether all content was received
+func (u *Upload) Done() bool {
+	return u.Status != StatusUploading
+}
+
+// Store keeps all uploads in memory and persists them to a bbolt database
+type Store struct {
+	mu      sync.RWMutex
+	db      *bolt.DB // nil when uploads are not persisted
+	uploads map[string]*Upload
+}
+
+// Open loads the uploads from db. A nil db gives an in-memory store.
+func Open(db *bolt.DB) (*Store, error) {
+	s := &Store{
+		db:      db,
+		uploads: make(map[string]*Upload),
+	}
+
+	if db == nil {
+		return s, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var u Upload
+			if err := json.Unmarshal(v, &u); err != nil {
+				return nil // skip corrupt entries
+			}
+			s.uploads[u.ID] = &u
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the upload with the given ID
+func (s *Store) Get(id string) (Upload, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.uploads[id]
+	if !ok {
+		return Upload{}, false
+	}
+	return *u, true
+}
+
+// All returns all uploads, most recently created first
+func (s *Store) All() []Upload {
+	s.mu.RLock()
+	result := make([]Upload, 0, len(s.uploads))
+	for _, u := range s.uploads {
+		result = append(result, *u)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID < result[j].ID
+	})
+	return result
+}
+
+// ExpiredBefore returns the uploads expiring before t. Uploads without an
+// expiration time never expire.
+func (s *Store) ExpiredBefore(t time.Time) []Upload {
+	var result []Upload
+	for _, u := range s.All() {
+		if !u.ExpiresAt.IsZero() && u.ExpiresAt.Before(t) {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+// Put stores u, replacing any upload with the same ID
+func (s *Store) Put(u Upload) error {
+	if err := s.persist(u.ID, &u); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.uploads[u.ID] = &u
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete removes an upload
+func (s *Store) Delete(id string) error {
+	if _, ok := s.Get(id); !ok {
+		return ErrNotFound
+	}
+	if err := s.persist(id, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// persist writes u (or deletes the key when u is nil) to the database
+func (s *Store) persist(id string, u *Upload) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		if err != nil {
+			return err
+		}
+		if u == nil {
+			return bucket.Delete([]byte(id))
+		}
+
+		data, err := json.Marshal(u)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// NewID generates a random upload ID. Upload URLs grant access to the
+// upload, so the ID is long enough not to be guessed.
+func NewID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
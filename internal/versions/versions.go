@@ -0,0 +1,254 @@
+// Package versions records earlier contents of images that were
+// overwritten, so they can be downloaded or reverted to. Entries are kept
+// in memory, with every change written through to a bbolt database like
+// the image catalog.
+package versions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gantoho/go-img-sys/internal/catalog"
+	bolt "go.etcd.io/bbolt"
+)
+
+// versionsBucket is the bbolt bucket holding one JSON document per version
+var versionsBucket = []byte("versions")
+
+// ErrNotFound is returned when a version does not exist
+var ErrNotFound = errors.New("versions: not found")
+
+// Version is an earlier content of an image
+type Version struct {
+	ID       string `json:"id"`
+	Filename string `json:"filename"` // image the version belongs to
+	// Number counts the versions of an image, starting at 1
+	Number int `json:"number"`
+	// Object is the storage name of the saved content
+	Object     string    `json:"object"`
+	ReplacedAt time.Time `json:"replaced_at"`
+	ReplacedBy string    `json:"replaced_by,omitempty"`
+	// Record is the catalog record of the content before it was replaced
+	Record catalog.Record `json:"record"`
+}
+
+// Store keeps all versions in memory and persists them to a bbolt database
+type Store struct {
+	write    sync.Mutex // serializes modifications, see Add
+	mu       sync.RWMutex
+	db       *bolt.DB // nil when versions are not persisted
+	versions map[string]*Version
+}
+
+// Open loads the versions from db. A nil db gives an in-memory store.
+func Open(db *bolt.DB) (*Store, error) {
+	s := &Store{
+		db:       db,
+		versions: make(map[string]*Version),
+	}
+
+	if db == nil {
+		return s, nil
+	}
+
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(versionsBucket)
+		if err != nil {
+			return err
+		}
+
+		return bucket.ForEach(func(k, v []byte) error {
+			var ver Version
+			if err := json.Unmarshal(v, &ver); err != nil {
+				return nil // skip corrupt entries
+			}
+			s.versions[ver.ID] = &ver
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the version with the given ID
+func (s *Store) Get(id string) (Version, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.versions[id]
+	if !ok {
+		return Version{}, false
+	}
+	return *v, true
+}
+
+// All returns every version, grouped by filename with the newest first
+func (s *Store) All() []Version {
+	s.mu.RLock()
+	result := make([]Version, 0, len(s.versions))
+	for _, v := range s.versions {
+		result = append(result, *v)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Filename != result[j].Filename {
+			return result[i].Filename < result[j].Filename
+		}
+		return result[i].Number > result[j].Number
+	})
+	return result
+}
+
+// ForFile returns the versions of filename, newest first
+func (s *Store) ForFile(filename string) []Version {
+	s.mu.RLock()
+	var result []Version
+	for _, v := range s.versions {
+		if v.Filename == filename {
+			result = append(result, *v)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Number > result[j].Number })
+	return result
+}
+
+// Add stores v as the newest version of its filename, assigning its ID and
+// number. Additions are serialized, so concurrent versions of the same
+// image get distinct numbers.
+func (s *Store) Add(v Version) (Version, error) {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	if v.ID == "" {
+		id, err := NewID()
+		if err != nil {
+			return Version{}, err
+		}
+		v.ID = id
+	}
+	v.Number = 1
+	if existing := s.ForFile(v.Filename); len(existing) > 0 {
+		v.Number = existing[0].Number + 1
+	}
+
+	if err := s.persist(v.ID, &v); err != nil {
+		return Version{}, err
+	}
+	s.mu.Lock()
+	s.versions[v.ID] = &v
+	s.mu.Unlock()
+	return v, nil
+}
+
+// Delete removes a version
+func (s *Store) Delete(id string) error {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	if _, ok := s.Get(id); !ok {
+		return ErrNotFound
+	}
+	if err := s.persist(id, nil); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	delete(s.versions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// RenameFile moves the versions of from to to, numbering them after the
+// versions to already has. It returns how many versions moved.
+func (s *Store) RenameFile(from, to string) (int, error) {
+	s.write.Lock()
+	defer s.write.Unlock()
+
+	moved := s.ForFile(from)
+	if len(moved) == 0 || from == to {
+		return 0, nil
+	}
+	next := 1
+	if existing := s.ForFile(to); len(existing) > 0 {
+		next = existing[0].Number + 1
+	}
+
+	// Oldest first, so the numbers keep their order
+	for i := len(moved) - 1; i >= 0; i-- {
+		moved[i].Filename = to
+		moved[i].Number = next
+		next++
+	}
+
+	if s.db != nil {
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(versionsBucket)
+			if err != nil {
+				return err
+			}
+			for _, v := range moved {
+				data, err := json.Marshal(v)
+				if err != nil {
+					return err
+				}
+				if err := bucket.Put([]byte(v.ID), data); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	s.mu.Lock()
+	for i := range moved {
+		s.versions[moved[i].ID] = &moved[i]
+	}
+	s.mu.Unlock()
+	return len(moved), nil
+}
+
+// persist writes v (or deletes the key when v is nil) to the database
+func (s *Store) persist(id string, v *Version) error {
+	if s.db == nil {
+		return nil
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(versionsBucket)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return bucket.Delete([]byte(id))
+		}
+
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(id), data)
+	})
+}
+
+// NewID generates a random version ID
+func NewID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -24,6 +24,13 @@ var (
 	ErrInternalServer  = &AppError{Code: http.StatusInternalServerError, Message: "internal server error"}
 	ErrDirectoryFail   = &AppError{Code: http.StatusInternalServerError, Message: "directory operation failed"}
 	ErrNoFiles         = &AppError{Code: http.StatusNotFound, Message: "no files found"}
+	ErrFileExists      = &AppError{Code: http.StatusConflict, Message: "file already exists"}
+	ErrAlbumNotFound   = &AppError{Code: http.StatusNotFound, Message: "album not found"}
+	ErrFolderNotFound  = &AppError{Code: http.StatusNotFound, Message: "folder not found"}
+	ErrFolderExists    = &AppError{Code: http.StatusConflict, Message: "folder already exists"}
+	ErrTrashNotFound   = &AppError{Code: http.StatusNotFound, Message: "trash entry not found"}
+	ErrVersionNotFound = &AppError{Code: http.StatusNotFound, Message: "version not found"}
+	ErrUploadNotFound  = &AppError{Code: http.StatusNotFound, Message: "upload not found"}
 )
 
 func NewError(code int, message string) *AppError {
@@ -0,0 +1,70 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Dimensions reads the pixel size of formats the standard library cannot
+// decode (WebP and BMP) from their leading bytes. It returns the format
+// name and false when the data is not recognized.
+func Dimensions(header []byte) (width, height int, format string, ok bool) {
+	switch {
+	case len(header) >= 30 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		width, height, ok = webpDimensions(header)
+		return width, height, "webp", ok
+	case len(header) >= 26 && bytes.Equal(header[:2], []byte("BM")):
+		width, height, ok = bmpDimensions(header)
+		return width, height, "bmp", ok
+	default:
+		return 0, 0, "", false
+	}
+}
+
+// webpDimensions reads the size from the first chunk of a WebP file, which
+// is a lossy (VP8), lossless (VP8L) or extended (VP8X) header
+func webpDimensions(b []byte) (int, int, bool) {
+	data := b[20:]
+
+	switch string(b[12:16]) {
+	case "VP8 ":
+		// 3 byte frame tag, then the start code 9d 01 2a
+		if len(data) < 10 || !bytes.Equal(data[3:6], []byte{0x9D, 0x01, 0x2A}) {
+			return 0, 0, false
+		}
+		w := int(binary.LittleEndian.Uint16(data[6:]) & 0x3FFF)
+		h := int(binary.LittleEndian.Uint16(data[8:]) & 0x3FFF)
+		return w, h, true
+	case "VP8L":
+		if len(data) < 5 || data[0] != 0x2F {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(data[1:])
+		return int(bits&0x3FFF) + 1, int(bits>>14&0x3FFF) + 1, true
+	case "VP8X":
+		if len(data) < 10 {
+			return 0, 0, false
+		}
+		w := int(data[4]) | int(data[5])<<8 | int(data[6])<<16
+		h := int(data[7]) | int(data[8])<<8 | int(data[9])<<16
+		return w + 1, h + 1, true
+	default:
+		return 0, 0, false
+	}
+}
+
+// bmpDimensions reads the size from the DIB header of a BMP file
+func bmpDimensions(b []byte) (int, int, bool) {
+	headerSize := binary.LittleEndian.Uint32(b[14:])
+	if headerSize == 12 {
+		// OS/2 BITMAPCOREHEADER with 16 bit dimensions
+		return int(binary.LittleEndian.Uint16(b[18:])), int(binary.LittleEndian.Uint16(b[20:])), true
+	}
+
+	w := int(int32(binary.LittleEndian.Uint32(b[18:])))
+	h := int(int32(binary.LittleEndian.Uint32(b[22:])))
+	if h < 0 {
+		h = -h // top-down bitmap
+	}
+	return w, h, w > 0 && h > 0
+}
@@ -0,0 +1,491 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exifHeader starts the APP1 segment holding EXIF data
+var exifHeader = []byte("Exif\x00\x00")
+
+// TIFF tags
+const (
+	// IFD0
+	tagImageDescription = 0x010E
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagSoftware         = 0x0131
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013B
+	tagCopyright        = 0x8298
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+
+	// Exif IFD
+	tagExposureTime       = 0x829A
+	tagFNumber            = 0x829D
+	tagISO                = 0x8827
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagFocalLength        = 0x920A
+	tagLensMake           = 0xA433
+	tagLensModel          = 0xA434
+
+	// GPS IFD
+	tagGPSLatitudeRef  = 0x0001
+	tagGPSLatitude     = 0x0002
+	tagGPSLongitudeRef = 0x0003
+	tagGPSLongitude    = 0x0004
+	tagGPSAltitudeRef  = 0x0005
+	tagGPSAltitude     = 0x0006
+)
+
+// TIFF field types
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+	typeSLong     = 9
+	typeSRational = 10
+)
+
+// typeSizes is the size in bytes of one value of each field type
+var typeSizes = map[uint16]int{
+	typeByte:      1,
+	typeASCII:     1,
+	typeShort:     2,
+	typeLong:      4,
+	typeRational:  8,
+	typeUndefined: 1,
+	typeSLong:     4,
+	typeSRational: 8,
+}
+
+// tiff is the TIFF structure EXIF data is stored in
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+// ifdEntry is a raw directory entry
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value int // offset of the 4 byte value/offset field in the TIFF data
+}
+
+// parseTIFF validates the TIFF header of EXIF data
+func parseTIFF(data []byte) (*tiff, bool) {
+	if len(data) < 8 {
+		return nil, false
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, false
+	}
+	if order.Uint16(data[2:]) != 42 {
+		return nil, false
+	}
+
+	return &tiff{data: data, order: order}, true
+}
+
+// ifd0 returns the entries of the first image directory
+func (t *tiff) ifd0() []ifdEntry {
+	return t.ifd(t.order.Uint32(t.data[4:]))
+}
+
+// ifd reads the directory at offset, ignoring entries past the end of data
+func (t *tiff) ifd(offset uint32) []ifdEntry {
+	if int64(offset)+2 > int64(len(t.data)) {
+		return nil
+	}
+
+	n := int(t.order.Uint16(t.data[offset:]))
+	entries := make([]ifdEntry, 0, n)
+	for i := 0; i < n; i++ {
+		pos := int(offset) + 2 + i*12
+		if pos+12 > len(t.data) {
+			break
+		}
+		entries = append(entries, ifdEntry{
+			tag:   t.order.Uint16(t.data[pos:]),
+			typ:   t.order.Uint16(t.data[pos+2:]),
+			count: t.order.Uint32(t.data[pos+4:]),
+			value: pos + 8,
+		})
+	}
+	return entries
+}
+
+// short returns the value of a SHORT entry
+func (t *tiff) short(e ifdEntry) (uint16, bool) {
+	if e.typ != typeShort || e.count < 1 {
+		return 0, false
+	}
+	return t.order.Uint16(t.data[e.value:]), true
+}
+
+// raw returns the bytes of an entry's values, which are stored inline when
+// they fit in 4 bytes and at an offset otherwise
+func (t *tiff) raw(e ifdEntry) ([]byte, bool) {
+	size, ok := typeSizes[e.typ]
+	if !ok {
+		return nil, false
+	}
+
+	n := int64(size) * int64(e.count)
+	if n <= 4 {
+		return t.data[e.value : e.value+int(n)], true
+	}
+
+	offset := int64(t.order.Uint32(t.data[e.value:]))
+	if offset+n > int64(len(t.data)) {
+		return nil, false
+	}
+	return t.data[offset : offset+n], true
+}
+
+// integer returns the first value of a BYTE, SHORT or LONG entry
+func (t *tiff) integer(e ifdEntry) (uint32, bool) {
+	b, ok := t.raw(e)
+	if !ok || len(b) == 0 {
+		return 0, false
+	}
+
+	switch e.typ {
+	case typeByte:
+		return uint32(b[0]), true
+	case typeShort:
+		return uint32(t.order.Uint16(b)), true
+	case typeLong:
+		return t.order.Uint32(b), true
+	default:
+		return 0, false
+	}
+}
+
+// text returns the value of an ASCII entry without trailing NULs and spaces
+func (t *tiff) text(e ifdEntry) string {
+	if e.typ != typeASCII {
+		return ""
+	}
+	b, ok := t.raw(e)
+	if !ok {
+		return ""
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// rationals returns the values of a RATIONAL or SRATIONAL entry
+func (t *tiff) rationals(e ifdEntry) []rational {
+	if e.typ != typeRational && e.typ != typeSRational {
+		return nil
+	}
+	b, ok := t.raw(e)
+	if !ok {
+		return nil
+	}
+
+	values := make([]rational, 0, e.count)
+	for i := 0; i+8 <= len(b); i += 8 {
+		num, den := t.order.Uint32(b[i:]), t.order.Uint32(b[i+4:])
+		if e.typ == typeSRational {
+			values = append(values, rational{int64(int32(num)), int64(int32(den))})
+		} else {
+			values = append(values, rational{int64(num), int64(den)})
+		}
+	}
+	return values
+}
+
+// rational is a TIFF fraction
+type rational struct {
+	num, den int64
+}
+
+// float returns the fraction as a float, false for a zero denominator
+func (r rational) float() (float64, bool) {
+	if r.den == 0 {
+		return 0, false
+	}
+	return float64(r.num) / float64(r.den), true
+}
+
+// readEXIF fills m from EXIF TIFF data
+func readEXIF(t *tiff, m *Metadata) {
+	var exifOffset, gpsOffset uint32
+
+	for _, e := range t.ifd0() {
+		switch e.tag {
+		case tagImageDescription:
+			m.Description = t.text(e)
+		case tagMake:
+			m.Make = t.text(e)
+		case tagModel:
+			m.Model = t.text(e)
+		case tagOrientation:
+			if v, ok := t.short(e); ok && v >= 1 && v <= 8 {
+				m.Orientation = int(v)
+			}
+		case tagSoftware:
+			m.Software = t.text(e)
+		case tagDateTime:
+			if m.TakenAt == nil {
+				m.TakenAt = parseEXIFTime(t.text(e), "")
+			}
+		case tagArtist:
+			m.Creator = t.text(e)
+		case tagCopyright:
+			m.Copyright = t.text(e)
+		case tagExifIFD:
+			exifOffset, _ = t.integer(e)
+		case tagGPSIFD:
+			gpsOffset, _ = t.integer(e)
+		}
+	}
+
+	if exifOffset != 0 {
+		readExifIFD(t, t.ifd(exifOffset), m)
+	}
+	if gpsOffset != 0 {
+		m.GPS = readGPS(t, t.ifd(gpsOffset))
+	}
+}
+
+// readExifIFD fills the camera settings of m
+func readExifIFD(t *tiff, entries []ifdEntry, m *Metadata) {
+	var original, offset string
+	var lensMake string
+
+	for _, e := range entries {
+		switch e.tag {
+		case tagExposureTime:
+			if r := t.rationals(e); len(r) > 0 {
+				m.ExposureTime = formatExposure(r[0])
+			}
+		case tagFNumber:
+			if r := t.rationals(e); len(r) > 0 {
+				if v, ok := r[0].float(); ok {
+					m.FNumber = round(v, 1)
+				}
+			}
+		case tagISO:
+			if v, ok := t.integer(e); ok {
+				m.ISO = int(v)
+			}
+		case tagDateTimeOriginal:
+			original = t.text(e)
+		case tagOffsetTimeOriginal:
+			offset = t.text(e)
+		case tagFocalLength:
+			if r := t.rationals(e); len(r) > 0 {
+				if v, ok := r[0].float(); ok {
+					m.FocalLength = round(v, 1)
+				}
+			}
+		case tagLensMake:
+			lensMake = t.text(e)
+		case tagLensModel:
+			m.Lens = t.text(e)
+		}
+	}
+
+	if takenAt := parseEXIFTime(original, offset); takenAt != nil {
+		m.TakenAt = takenAt
+	}
+	if m.Lens != "" && lensMake != "" && !strings.HasPrefix(m.Lens, lensMake) {
+		m.Lens = lensMake + " " + m.Lens
+	}
+}
+
+// readGPS returns the position stored in a GPS IFD, nil without coordinates
+func readGPS(t *tiff, entries []ifdEntry) *GPS {
+	var lat, lon []rational
+	var latRef, lonRef string
+	var alt []rational
+	var altRef uint32
+
+	for _, e := range entries {
+		switch e.tag {
+		case tagGPSLatitudeRef:
+			latRef = t.text(e)
+		case tagGPSLatitude:
+			lat = t.rationals(e)
+		case tagGPSLongitudeRef:
+			lonRef = t.text(e)
+		case tagGPSLongitude:
+			lon = t.rationals(e)
+		case tagGPSAltitudeRef:
+			altRef, _ = t.integer(e)
+		case tagGPSAltitude:
+			alt = t.rationals(e)
+		}
+	}
+
+	latitude, ok := degrees(lat)
+	if !ok {
+		return nil
+	}
+	longitude, ok := degrees(lon)
+	if !ok {
+		return nil
+	}
+	if latRef == "S" {
+		latitude = -latitude
+	}
+	if lonRef == "W" {
+		longitude = -longitude
+	}
+
+	gps := &GPS{Latitude: round(latitude, 6), Longitude: round(longitude, 6)}
+	if len(alt) > 0 {
+		if v, ok := alt[0].float(); ok {
+			if altRef == 1 {
+				v = -v // below sea level
+			}
+			v = round(v, 1)
+			gps.Altitude = &v
+		}
+	}
+	return gps
+}
+
+// degrees converts degrees, minutes and seconds to decimal degrees
+func degrees(dms []rational) (float64, bool) {
+	if len(dms) != 3 {
+		return 0, false
+	}
+
+	var result float64
+	for i, unit := range []float64{1, 60, 3600} {
+		v, ok := dms[i].float()
+		if !ok {
+			return 0, false
+		}
+		result += v / unit
+	}
+	return result, true
+}
+
+// formatExposure formats an exposure time as photographers write it, e.g. 1/125 or 2.5
+func formatExposure(r rational) string {
+	v, ok := r.float()
+	if !ok || v <= 0 {
+		return ""
+	}
+	if v < 1 {
+		return "1/" + strconv.FormatFloat(math.Round(1/v), 'f', -1, 64)
+	}
+	return strconv.FormatFloat(round(v, 1), 'f', -1, 64)
+}
+
+// parseEXIFTime parses an EXIF date ("2006:01:02 15:04:05") with an
+// optional offset ("+08:00"). Times without offset are taken as UTC.
+func parseEXIFTime(value, offset string) *time.Time {
+	if value == "" {
+		return nil
+	}
+
+	layout, value := "2006:01:02 15:04:05", strings.TrimSpace(value)
+	if offset != "" {
+		layout, value = layout+"-07:00", value+offset
+	}
+
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// round rounds v to the given number of decimals
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+// exifTIFF returns the TIFF data of the EXIF segment, if any
+func exifTIFF(segments []Segment) (*tiff, bool) {
+	for _, seg := range segments {
+		if seg.Marker == markerAPP1 && bytes.HasPrefix(seg.Data, exifHeader) {
+			return parseTIFF(seg.Data[len(exifHeader):])
+		}
+	}
+	return nil, false
+}
+
+// Orientation returns the EXIF orientation (1-8) of a JPEG given its
+// leading bytes. It returns 1, the normal orientation, when the data is not
+// a JPEG or carries no valid orientation.
+func Orientation(header []byte) int {
+	segments, _ := ReadSegments(header)
+	if t, ok := exifTIFF(segments); ok {
+		return tiffOrientation(t)
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation recorded in IFD0, 1 if none
+func tiffOrientation(t *tiff) int {
+	for _, e := range t.ifd0() {
+		if e.tag != tagOrientation {
+			continue
+		}
+		if v, ok := t.short(e); ok && v >= 1 && v <= 8 {
+			return int(v)
+		}
+		break
+	}
+	return 1
+}
+
+// xmpOrientation matches the orientation in XMP, as attribute or element
+var xmpOrientation = regexp.MustCompile(`tiff:Orientation(="|>)[1-8]`)
+
+// ResetOrientation sets the orientation recorded in the EXIF and XMP
+// segments of a JPEG to 1 (normal), modifying data in place. It is used
+// after the pixels were rotated upright.
+func ResetOrientation(data []byte) error {
+	segments, err := ReadSegments(data)
+	if err != nil {
+		return err
+	}
+
+	if t, ok := exifTIFF(segments); ok {
+		for _, e := range t.ifd0() {
+			if e.tag == tagOrientation && e.typ == typeShort {
+				t.order.PutUint16(t.data[e.value:], 1)
+			}
+		}
+	}
+
+	for _, seg := range segments {
+		if seg.Marker != markerAPP1 || bytes.HasPrefix(seg.Data, exifHeader) {
+			continue
+		}
+		for _, loc := range xmpOrientation.FindAllIndex(seg.Data, -1) {
+			seg.Data[loc[1]-1] = '1'
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// photoshopHeader starts the APP13 segment holding Photoshop image
+// resources, one of which is the IPTC-IIM record
+var photoshopHeader = []byte("Photoshop 3.0\x00")
+
+// markerAPP13 is the JPEG marker of Photoshop resources
+const markerAPP13 = 0xED
+
+// resourceIPTC is the Photoshop image resource ID of IPTC-IIM data
+const resourceIPTC = 0x0404
+
+// IPTC application record (2) datasets
+const (
+	iptcObjectName = 5
+	iptcKeywords   = 25
+	iptcByline     = 80
+	iptcCopyright  = 116
+	iptcCaption    = 120
+)
+
+// parseIPTC finds the IPTC resource among Photoshop image resources
+func parseIPTC(resources []byte) *descriptive {
+	for pos := 0; pos+8 <= len(resources); {
+		if !bytes.Equal(resources[pos:pos+4], []byte("8BIM")) {
+			return nil
+		}
+		id := binary.BigEndian.Uint16(resources[pos+4:])
+
+		// Pascal string name, padded to an even length including the length byte
+		nameLen := int(resources[pos+6])
+		pos += 6 + (nameLen+2)&^1
+		if pos+4 > len(resources) {
+			return nil
+		}
+
+		size := int(binary.BigEndian.Uint32(resources[pos:]))
+		pos += 4
+		if size < 0 || pos+size > len(resources) {
+			return nil
+		}
+
+		if id == resourceIPTC {
+			return parseIIM(resources[pos : pos+size])
+		}
+		pos += (size + 1) &^ 1
+	}
+	return nil
+}
+
+// parseIIM reads the datasets of IPTC-IIM data. Text is assumed to be UTF-8.
+func parseIIM(data []byte) *descriptive {
+	i := &descriptive{}
+
+	for pos := 0; pos+5 <= len(data); {
+		if data[pos] != 0x1C {
+			break
+		}
+		record, dataset := data[pos+1], data[pos+2]
+		size := int(binary.BigEndian.Uint16(data[pos+3:]))
+		pos += 5
+		if size&0x8000 != 0 || pos+size > len(data) {
+			// extended datasets are not used for text fields
+			break
+		}
+
+		value := strings.TrimSpace(string(data[pos : pos+size]))
+		pos += size
+		if record != 2 || value == "" {
+			continue
+		}
+
+		switch dataset {
+		case iptcObjectName:
+			setFirst(&i.title, value)
+		case iptcKeywords:
+			i.keywords = appendUnique(i.keywords, value)
+		case iptcByline:
+			setFirst(&i.creator, value)
+		case iptcCopyright:
+			setFirst(&i.copyright, value)
+		case iptcCaption:
+			setFirst(&i.description, value)
+		}
+	}
+
+	return i
+}
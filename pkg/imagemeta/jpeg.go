@@ -0,0 +1,129 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Common errors
+var (
+	ErrNotJPEG   = errors.New("imagemeta: not a JPEG image")
+	ErrNotPNG    = errors.New("imagemeta: not a PNG image")
+	ErrTruncated = errors.New("imagemeta: truncated data")
+)
+
+// JPEG markers
+const (
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+	markerCOM  = 0xFE
+)
+
+// Segment is a JPEG marker segment preceding the compressed image data
+type Segment struct {
+	Marker byte
+	Data   []byte // payload, without marker and length
+	Offset int    // offset of the marker in the file
+}
+
+// ReadSegments parses the marker segments of a JPEG up to the start of
+// scan. data may be just the leading bytes of the file: segments cut off
+// by the end of data are dropped and ErrTruncated is returned together
+// with the complete ones.
+func ReadSegments(data []byte) ([]Segment, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, ErrNotJPEG
+	}
+
+	var segments []Segment
+	pos := 2
+	for {
+		// markers may be preceded by any number of 0xFF fill bytes
+		for pos < len(data) && data[pos] == 0xFF && pos+1 < len(data) && data[pos+1] == 0xFF {
+			pos++
+		}
+		if pos+4 > len(data) {
+			return segments, ErrTruncated
+		}
+		if data[pos] != 0xFF {
+			return segments, ErrNotJPEG
+		}
+
+		marker := data[pos+1]
+		if marker == markerSOS || marker == markerEOI {
+			return segments, nil
+		}
+
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 {
+			return segments, ErrNotJPEG
+		}
+		end := pos + 2 + length
+		if end > len(data) {
+			return segments, ErrTruncated
+		}
+
+		segments = append(segments, Segment{Marker: marker, Data: data[pos+4 : end], Offset: pos})
+		pos = end
+	}
+}
+
+// CopyMetadata returns dst with the metadata segments of src (APP1-APP15
+// except APP14, and comments: EXIF, XMP, ICC profile, IPTC...) inserted
+// after its start marker, or after its JFIF APP0 segment which must come
+// first. dst is expected to be freshly encoded and carry no metadata of its
+// own, src is the original file it was encoded from.
+func CopyMetadata(dst, src []byte) ([]byte, error) {
+	if len(dst) < 2 || dst[0] != 0xFF || dst[1] != markerSOI {
+		return nil, ErrNotJPEG
+	}
+
+	segments, err := ReadSegments(src)
+	if err != nil {
+		return nil, err
+	}
+
+	head := 2
+	if len(dst) >= 6 && dst[2] == 0xFF && dst[3] == markerAPP0 {
+		head += 2 + int(binary.BigEndian.Uint16(dst[4:6]))
+		if head > len(dst) {
+			return nil, ErrNotJPEG
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(dst) + len(src)/8)
+	buf.Write(dst[:head])
+	for _, seg := range segments {
+		if !isMetadataMarker(seg.Marker) {
+			continue
+		}
+		writeSegment(&buf, seg.Marker, seg.Data)
+	}
+	buf.Write(dst[head:])
+
+	return buf.Bytes(), nil
+}
+
+// isMetadataMarker reports whether segments with marker carry metadata
+// rather than data needed to decode the image. APP0 (JFIF) is left out as
+// encoders write their own, APP14 (Adobe) as its color transform flag
+// describes the original encoding and would make decoders misread the
+// colors of the new one.
+func isMetadataMarker(marker byte) bool {
+	return (marker > markerAPP0 && marker <= 0xEF && marker != markerAPP14) || marker == markerCOM
+}
+
+// writeSegment writes a marker segment with the given payload
+func writeSegment(buf *bytes.Buffer, marker byte, payload []byte) {
+	var head [4]byte
+	head[0] = 0xFF
+	head[1] = marker
+	binary.BigEndian.PutUint16(head[2:], uint16(len(payload)+2))
+	buf.Write(head[:])
+	buf.Write(payload)
+}
@@ -0,0 +1,113 @@
+package imagemeta
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReadSegments(t *testing.T) {
+	data := jpegWith(
+		Segment{Marker: markerAPP0, Data: []byte("JFIF\x00")},
+		Segment{Marker: markerAPP1, Data: []byte("Exif\x00\x00")},
+	)
+
+	segments, err := ReadSegments(data)
+	if err != nil {
+		t.Fatalf("ReadSegments: %v", err)
+	}
+	if got := markers(segments); got != "E0 E1 DB" {
+		t.Errorf("markers = %s, want E0 E1 DB", got)
+	}
+	if segments[1].Offset != 11 || string(segments[1].Data) != "Exif\x00\x00" {
+		t.Errorf("APP1 segment = %+v", segments[1])
+	}
+
+	// Leading bytes only: complete segments are returned with ErrTruncated
+	segments, err = ReadSegments(data[:15])
+	if err != ErrTruncated || markers(segments) != "E0" {
+		t.Errorf("ReadSegments of truncated data = %s, %v", markers(segments), err)
+	}
+
+	if _, err := ReadSegments([]byte("GIF89a")); err != ErrNotJPEG {
+		t.Errorf("ReadSegments of GIF: %v, want ErrNotJPEG", err)
+	}
+}
+
+func TestCopyMetadata(t *testing.T) {
+	src := jpegWith(
+		Segment{Marker: markerAPP0, Data: []byte("JFIF\x00src")},
+		Segment{Marker: markerAPP1, Data: []byte("Exif\x00\x00")},
+		Segment{Marker: markerAPP2, Data: []byte("ICC_PROFILE\x00")},
+		Segment{Marker: markerAPP14, Data: []byte("Adobe")},
+		Segment{Marker: markerCOM, Data: []byte("comment")},
+	)
+
+	tests := []struct {
+		name string
+		dst  []byte
+		want string
+	}{
+		{
+			name: "no APP0",
+			dst:  jpegWith(),
+			want: "E1 E2 FE DB",
+		},
+		{
+			name: "JFIF APP0 stays first",
+			dst:  jpegWith(Segment{Marker: markerAPP0, Data: []byte("JFIF\x00dst")}),
+			want: "E0 E1 E2 FE DB",
+		},
+	}
+
+	for _, tt := range tests {
+		out, err := CopyMetadata(tt.dst, src)
+		if err != nil {
+			t.Fatalf("%s: CopyMetadata: %v", tt.name, err)
+		}
+		segments, err := ReadSegments(out)
+		if err != nil {
+			t.Fatalf("%s: ReadSegments: %v", tt.name, err)
+		}
+		if got := markers(segments); got != tt.want {
+			t.Errorf("%s: markers = %s, want %s", tt.name, got, tt.want)
+		}
+		if segments[0].Marker == markerAPP0 && string(segments[0].Data) != "JFIF\x00dst" {
+			t.Errorf("%s: APP0 of the source copied: %q", tt.name, segments[0].Data)
+		}
+		if !bytes.HasSuffix(out, tt.dst[len(tt.dst)-8:]) {
+			t.Errorf("%s: image data not kept", tt.name)
+		}
+	}
+
+	if _, err := CopyMetadata([]byte("not a jpeg"), src); err != ErrNotJPEG {
+		t.Errorf("CopyMetadata to non-JPEG: %v, want ErrNotJPEG", err)
+	}
+	if _, err := CopyMetadata([]byte{0xFF, markerSOI, 0xFF, markerAPP0, 0x00, 0x40}, src); err != ErrNotJPEG {
+		t.Errorf("CopyMetadata to truncated APP0: %v, want ErrNotJPEG", err)
+	}
+}
+
+// jpegWith returns a minimal JPEG holding segments, a quantization table
+// and a stub scan
+func jpegWith(segments ...Segment) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, markerSOI})
+	for _, seg := range segments {
+		writeSegment(&buf, seg.Marker, seg.Data)
+	}
+	writeSegment(&buf, 0xDB, make([]byte, 65))
+	writeSegment(&buf, markerSOS, []byte{1, 1, 0, 0, 63, 0})
+	buf.Write([]byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC, 0xFF, markerEOI})
+	return buf.Bytes()
+}
+
+// markers lists the markers of segments in hex
+func markers(segments []Segment) string {
+	list := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		list = append(list, fmt.Sprintf("%02X", seg.Marker))
+	}
+	return strings.Join(list, " ")
+}
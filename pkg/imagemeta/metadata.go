@@ -0,0 +1,132 @@
+package imagemeta
+
+import (
+	"bytes"
+	"time"
+)
+
+// Metadata is the descriptive information embedded in an image file,
+// merged from EXIF, XMP and IPTC. Empty fields were not present.
+type Metadata struct {
+	// Camera and exposure (EXIF)
+	Make         string     `json:"make,omitempty"`
+	Model        string     `json:"model,omitempty"`
+	Lens         string     `json:"lens,omitempty"`
+	ExposureTime string     `json:"exposure_time,omitempty"` // e.g. "1/125"
+	FNumber      float64    `json:"f_number,omitempty"`
+	ISO          int        `json:"iso,omitempty"`
+	FocalLength  float64    `json:"focal_length,omitempty"` // millimeters
+	TakenAt      *time.Time `json:"taken_at,omitempty"`
+	Orientation  int        `json:"orientation,omitempty"`
+	Software     string     `json:"software,omitempty"`
+	GPS          *GPS       `json:"gps,omitempty"`
+
+	// Description and rights (XMP, IPTC, EXIF)
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Keywords    []string `json:"keywords,omitempty"`
+	Creator     string   `json:"creator,omitempty"`
+	Copyright   string   `json:"copyright,omitempty"`
+}
+
+// GPS is the position an image was taken at, in decimal degrees
+type GPS struct {
+	Latitude  float64  `json:"latitude"`
+	Longitude float64  `json:"longitude"`
+	Altitude  *float64 `json:"altitude,omitempty"` // meters above sea level
+}
+
+// IsEmpty reports whether no metadata was found
+func (m *Metadata) IsEmpty() bool {
+	return m.Make == "" && m.Model == "" && m.Lens == "" && m.ExposureTime == "" &&
+		m.FNumber == 0 && m.ISO == 0 && m.FocalLength == 0 && m.TakenAt == nil &&
+		m.Orientation == 0 && m.Software == "" && m.GPS == nil && m.Title == "" &&
+		m.Description == "" && len(m.Keywords) == 0 && m.Creator == "" && m.Copyright == ""
+}
+
+// Extract reads the metadata of a JPEG or PNG image from its leading
+// bytes. Metadata past the end of data is missed, unknown formats give
+// empty metadata.
+func Extract(data []byte) *Metadata {
+	m := &Metadata{}
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, markerSOI}):
+		segments, _ := ReadSegments(data)
+		extractJPEG(segments, m)
+	case bytes.HasPrefix(data, pngSignature):
+		chunks, _ := readChunks(data)
+		extractPNG(chunks, m)
+	}
+
+	return m
+}
+
+// extractJPEG reads the EXIF, XMP and IPTC segments of a JPEG
+func extractJPEG(segments []Segment, m *Metadata) {
+	var x, i *descriptive
+
+	for _, seg := range segments {
+		switch {
+		case seg.Marker == markerAPP1 && bytes.HasPrefix(seg.Data, exifHeader):
+			if t, ok := parseTIFF(seg.Data[len(exifHeader):]); ok {
+				readEXIF(t, m)
+			}
+		case seg.Marker == markerAPP1 && bytes.HasPrefix(seg.Data, xmpHeader):
+			x = parseXMP(seg.Data[len(xmpHeader):])
+		case seg.Marker == markerAPP13 && bytes.HasPrefix(seg.Data, photoshopHeader):
+			i = parseIPTC(seg.Data[len(photoshopHeader):])
+		}
+	}
+
+	// XMP is preferred over IPTC, which is preferred over EXIF
+	merge(m, i, x)
+}
+
+// merge fills the descriptive fields of m from sources in increasing order
+// of precedence, skipping nil ones. Keywords are combined.
+func merge(m *Metadata, sources ...*descriptive) {
+	for _, src := range sources {
+		if src == nil {
+			continue
+		}
+		override(&m.Title, src.title)
+		override(&m.Description, src.description)
+		override(&m.Creator, src.creator)
+		override(&m.Copyright, src.copyright)
+		m.Keywords = appendUnique(m.Keywords, src.keywords...)
+	}
+}
+
+// descriptive holds the fields XMP, IPTC and PNG text have in common
+type descriptive struct {
+	title       string
+	description string
+	creator     string
+	copyright   string
+	keywords    []string
+}
+
+// override sets *dst to v unless v is empty
+func override(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+// appendUnique appends the values not yet in list
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found && v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
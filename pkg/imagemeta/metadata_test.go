@@ -0,0 +1,264 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExtractJPEG(t *testing.T) {
+	data := jpegWith(
+		Segment{Marker: markerAPP0, Data: []byte("JFIF\x00")},
+		Segment{Marker: markerAPP1, Data: exifSegment(sampleEXIF())},
+		Segment{Marker: markerAPP1, Data: xmpSegment(sampleXMP)},
+		Segment{Marker: markerAPP13, Data: iptcSegment(
+			iimDataset{iptcKeywords, "tibet"},
+			iimDataset{iptcKeywords, "lhasa"},
+			iimDataset{iptcCaption, "iptc caption"},
+			iimDataset{iptcByline, "iptc byline"},
+			iimDataset{iptcObjectName, "iptc title"},
+		)},
+	)
+
+	m := Extract(data)
+
+	altitude := 3650.0
+	taken := time.Date(2025, 7, 1, 12, 30, 45, 0, time.FixedZone("", 8*3600))
+	want := &Metadata{
+		Make:         "Canon",
+		Model:        "EOS R5",
+		Lens:         "Canon RF 50mm",
+		ExposureTime: "1/125",
+		FNumber:      2.8,
+		ISO:          400,
+		FocalLength:  50,
+		TakenAt:      &taken,
+		Orientation:  6,
+		Software:     "Firmware 1.0",
+		GPS:          &GPS{Latitude: 29.655, Longitude: -91.117, Altitude: &altitude},
+		// XMP wins over IPTC, which wins over EXIF; keywords are combined
+		Title:       "xmp title",
+		Description: "iptc caption",
+		Keywords:    []string{"tibet", "lhasa", "palace"},
+		Creator:     "xmp creator",
+		Copyright:   "xmp rights",
+	}
+
+	if !m.TakenAt.Equal(taken) {
+		t.Errorf("TakenAt = %v, want %v", m.TakenAt, taken)
+	}
+	m.TakenAt = want.TakenAt
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Extract =\n%+v\nwant\n%+v", m, want)
+	}
+	if *m.GPS.Altitude != altitude {
+		t.Errorf("GPS altitude = %v, want %v", *m.GPS.Altitude, altitude)
+	}
+}
+
+func TestExtractPartial(t *testing.T) {
+	exif := exifSegment(sampleEXIF())
+	data := jpegWith(
+		Segment{Marker: markerAPP1, Data: exif},
+		Segment{Marker: markerAPP1, Data: xmpSegment(sampleXMP)},
+	)
+
+	// Only the leading bytes up to the end of the EXIF segment are given
+	m := Extract(data[:2+4+len(exif)+10])
+	if m.Make != "Canon" || m.Title != "" {
+		t.Errorf("Extract of leading bytes = %+v, want EXIF only", m)
+	}
+
+	if m := Extract([]byte("GIF89a...")); !m.IsEmpty() {
+		t.Errorf("Extract of GIF = %+v, want empty", m)
+	}
+	if m := Extract(jpegWith()); !m.IsEmpty() {
+		t.Errorf("Extract of JPEG without metadata = %+v, want empty", m)
+	}
+
+	// A corrupt IFD offset is ignored rather than read out of bounds
+	corrupt := append([]byte{}, exif...)
+	binary.BigEndian.PutUint32(corrupt[len(exifHeader)+4:], 0xFFFFFF)
+	if m := Extract(jpegWith(Segment{Marker: markerAPP1, Data: corrupt})); !m.IsEmpty() {
+		t.Errorf("Extract of corrupt EXIF = %+v, want empty", m)
+	}
+}
+
+func TestOrientationAndReset(t *testing.T) {
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description xmlns:tiff="http://ns.adobe.com/tiff/1.0/" tiff:Orientation="6"/></rdf:RDF></x:xmpmeta>`
+	data := jpegWith(
+		Segment{Marker: markerAPP1, Data: exifSegment([]ifdField{{tag: tagOrientation, value: uint16(6)}})},
+		Segment{Marker: markerAPP1, Data: xmpSegment(xmp)},
+	)
+
+	if got := Orientation(data); got != 6 {
+		t.Fatalf("Orientation = %d, want 6", got)
+	}
+	if err := ResetOrientation(data); err != nil {
+		t.Fatalf("ResetOrientation: %v", err)
+	}
+	if got := Orientation(data); got != 1 {
+		t.Errorf("Orientation after reset = %d, want 1", got)
+	}
+	if !bytes.Contains(data, []byte(`tiff:Orientation="1"`)) {
+		t.Errorf("XMP orientation not reset")
+	}
+
+	for _, header := range [][]byte{nil, []byte("not a jpeg"), jpegWith()} {
+		if got := Orientation(header); got != 1 {
+			t.Errorf("Orientation(%q) = %d, want 1", header, got)
+		}
+	}
+	invalid := jpegWith(Segment{Marker: markerAPP1, Data: exifSegment([]ifdField{{tag: tagOrientation, value: uint16(9)}})})
+	if got := Orientation(invalid); got != 1 {
+		t.Errorf("Orientation of out of range value = %d, want 1", got)
+	}
+}
+
+// sampleXMP holds Dublin Core properties as an attribute and as rdf:Alt,
+// rdf:Bag and rdf:Seq elements
+const sampleXMP = `<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" dc:rights="xmp rights">
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">xmp title</rdf:li><rdf:li xml:lang="de">XMP Titel</rdf:li></rdf:Alt></dc:title>
+   <dc:subject><rdf:Bag><rdf:li>lhasa</rdf:li><rdf:li>palace</rdf:li></rdf:Bag></dc:subject>
+   <dc:creator><rdf:Seq><rdf:li>xmp creator</rdf:li></rdf:Seq></dc:creator>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>`
+
+// sampleEXIF returns IFD0 with camera, exposure and GPS data
+func sampleEXIF() []ifdField {
+	return []ifdField{
+		{tag: tagImageDescription, value: "exif description"},
+		{tag: tagMake, value: "Canon"},
+		{tag: tagModel, value: "EOS R5"},
+		{tag: tagOrientation, value: uint16(6)},
+		{tag: tagSoftware, value: "Firmware 1.0"},
+		{tag: tagDateTime, value: "2026:01:01 00:00:00"},
+		{tag: tagArtist, value: "exif artist"},
+		{tag: tagExifIFD, value: []ifdField{
+			{tag: tagExposureTime, value: []rational{{1, 125}}},
+			{tag: tagFNumber, value: []rational{{28, 10}}},
+			{tag: tagISO, value: uint16(400)},
+			{tag: tagDateTimeOriginal, value: "2025:07:01 12:30:45"},
+			{tag: tagOffsetTimeOriginal, value: "+08:00"},
+			{tag: tagFocalLength, value: []rational{{50, 1}}},
+			{tag: tagLensMake, value: "Canon"},
+			{tag: tagLensModel, value: "RF 50mm"},
+		}},
+		{tag: tagGPSIFD, value: []ifdField{
+			{tag: tagGPSLatitudeRef, value: "N"},
+			{tag: tagGPSLatitude, value: []rational{{29, 1}, {39, 1}, {18, 1}}},
+			{tag: tagGPSLongitudeRef, value: "W"},
+			{tag: tagGPSLongitude, value: []rational{{91, 1}, {7, 1}, {12, 10}}},
+			{tag: tagGPSAltitudeRef, value: uint8(0)},
+			{tag: tagGPSAltitude, value: []rational{{3650, 1}}},
+		}},
+	}
+}
+
+// ifdField is a TIFF field written by buildTIFF. value is a string
+// (ASCII), uint8 (BYTE), uint16 (SHORT), uint32 (LONG), []rational
+// (RATIONAL) or []ifdField, a sub-IFD whose offset is stored as LONG.
+type ifdField struct {
+	tag   uint16
+	value interface{}
+}
+
+// exifSegment returns the APP1 payload holding fields as IFD0
+func exifSegment(fields []ifdField) []byte {
+	return append(append([]byte{}, exifHeader...), buildTIFF(fields)...)
+}
+
+// buildTIFF returns big endian TIFF data with fields as IFD0
+func buildTIFF(fields []ifdField) []byte {
+	buf := []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	writeIFD(&buf, fields)
+	return buf
+}
+
+// writeIFD appends a directory holding fields to buf and returns its offset
+func writeIFD(buf *[]byte, fields []ifdField) uint32 {
+	be := binary.BigEndian
+	start := len(*buf)
+	*buf = append(*buf, make([]byte, 2+12*len(fields)+4)...)
+	be.PutUint16((*buf)[start:], uint16(len(fields)))
+
+	for i, f := range fields {
+		var typ uint16
+		var count int
+		var data []byte
+		switch v := f.value.(type) {
+		case string:
+			typ, data = typeASCII, append([]byte(v), 0)
+			count = len(data)
+		case uint8:
+			typ, count, data = typeByte, 1, []byte{v}
+		case uint16:
+			typ, count, data = typeShort, 1, be.AppendUint16(nil, v)
+		case uint32:
+			typ, count, data = typeLong, 1, be.AppendUint32(nil, v)
+		case []rational:
+			typ, count = typeRational, len(v)
+			for _, r := range v {
+				data = be.AppendUint32(data, uint32(r.num))
+				data = be.AppendUint32(data, uint32(r.den))
+			}
+		case []ifdField:
+			typ, count, data = typeLong, 1, be.AppendUint32(nil, writeIFD(buf, v))
+		}
+
+		if len(data) > 4 {
+			offset := uint32(len(*buf))
+			*buf = append(*buf, data...)
+			if len(*buf)%2 == 1 {
+				*buf = append(*buf, 0)
+			}
+			data = be.AppendUint32(nil, offset)
+		}
+
+		// buf may have moved while appending
+		entry := (*buf)[start+2+12*i:]
+		be.PutUint16(entry, f.tag)
+		be.PutUint16(entry[2:], typ)
+		be.PutUint32(entry[4:], uint32(count))
+		copy(entry[8:12], data)
+	}
+	return uint32(start)
+}
+
+// xmpSegment returns the APP1 payload holding an XMP packet
+func xmpSegment(packet string) []byte {
+	return append(append([]byte{}, xmpHeader...), packet...)
+}
+
+// iimDataset is a dataset of the IPTC application record
+type iimDataset struct {
+	dataset byte
+	value   string
+}
+
+// iptcSegment returns the APP13 payload holding datasets, preceded by
+// another Photoshop resource with a name
+func iptcSegment(datasets ...iimDataset) []byte {
+	var iim []byte
+	for _, d := range datasets {
+		iim = append(iim, 0x1C, 2, d.dataset)
+		iim = binary.BigEndian.AppendUint16(iim, uint16(len(d.value)))
+		iim = append(iim, d.value...)
+	}
+
+	buf := append([]byte{}, photoshopHeader...)
+	// Resolution info resource named "res", odd sized data gets padded
+	buf = append(buf, "8BIM"...)
+	buf = append(buf, 0x03, 0xED, 3, 'r', 'e', 's', 0, 0, 0, 3, 1, 2, 3, 0)
+	buf = append(buf, "8BIM"...)
+	buf = binary.BigEndian.AppendUint16(buf, resourceIPTC)
+	buf = append(buf, 0, 0) // empty name, padded
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(iim)))
+	return append(buf, iim...)
+}
@@ -0,0 +1,143 @@
+package imagemeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// pngSignature starts every PNG file
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// maxTextSize limits decompressed PNG text chunks
+const maxTextSize = 1 << 20
+
+// chunk is a PNG chunk
+type chunk struct {
+	Type   string
+	Data   []byte
+	Offset int // offset of the chunk (its length field) in the file
+	Length int // total size including length, type and CRC
+}
+
+// readChunks parses the chunks of a PNG. As with ReadSegments, data may be
+// just the leading bytes of the file, in which case ErrTruncated is returned
+// with the complete chunks.
+func readChunks(data []byte) ([]chunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrNotPNG
+	}
+
+	var chunks []chunk
+	for pos := len(pngSignature); ; {
+		if pos+8 > len(data) {
+			return chunks, ErrTruncated
+		}
+		length := int64(binary.BigEndian.Uint32(data[pos:]))
+		end := int64(pos) + 12 + length
+		if end > int64(len(data)) {
+			return chunks, ErrTruncated
+		}
+
+		c := chunk{
+			Type:   string(data[pos+4 : pos+8]),
+			Data:   data[pos+8 : pos+8+int(length)],
+			Offset: pos,
+			Length: int(end) - pos,
+		}
+		chunks = append(chunks, c)
+		if c.Type == "IEND" {
+			return chunks, nil
+		}
+		pos = int(end)
+	}
+}
+
+// extractPNG reads the eXIf and text chunks of a PNG
+func extractPNG(chunks []chunk, m *Metadata) {
+	var x *descriptive
+	text := &descriptive{}
+
+	for _, c := range chunks {
+		switch c.Type {
+		case "eXIf":
+			if t, ok := parseTIFF(c.Data); ok {
+				readEXIF(t, m)
+			}
+		case "tEXt", "zTXt", "iTXt":
+			keyword, value, ok := pngText(c)
+			if !ok {
+				continue
+			}
+			switch keyword {
+			case "XML:com.adobe.xmp":
+				x = parseXMP([]byte(value))
+			case "Title":
+				setFirst(&text.title, value)
+			case "Description":
+				setFirst(&text.description, value)
+			case "Author":
+				setFirst(&text.creator, value)
+			case "Copyright":
+				setFirst(&text.copyright, value)
+			case "Software":
+				setFirst(&m.Software, value)
+			}
+		}
+	}
+
+	merge(m, text, x)
+}
+
+// pngText decodes a tEXt, zTXt or iTXt chunk into keyword and text
+func pngText(c chunk) (string, string, bool) {
+	keyword, rest, ok := bytes.Cut(c.Data, []byte{0})
+	if !ok {
+		return "", "", false
+	}
+
+	switch c.Type {
+	case "tEXt":
+		// Latin-1, which matches UTF-8 for the ASCII text found in practice
+		return string(keyword), strings.TrimSpace(string(rest)), true
+	case "zTXt":
+		if len(rest) < 1 {
+			return "", "", false
+		}
+		text, err := inflate(rest[1:])
+		return string(keyword), strings.TrimSpace(text), err == nil
+	default: // iTXt
+		if len(rest) < 2 {
+			return "", "", false
+		}
+		compressed := rest[0] == 1
+		// skip the compression method, language tag and translated keyword
+		_, rest, ok = bytes.Cut(rest[2:], []byte{0})
+		if !ok {
+			return "", "", false
+		}
+		_, rest, ok = bytes.Cut(rest, []byte{0})
+		if !ok {
+			return "", "", false
+		}
+		if !compressed {
+			return string(keyword), strings.TrimSpace(string(rest)), true
+		}
+		text, err := inflate(rest)
+		return string(keyword), strings.TrimSpace(text), err == nil
+	}
+}
+
+// inflate decompresses zlib data of a text chunk
+func inflate(data []byte) (string, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	b, err := io.ReadAll(io.LimitReader(r, maxTextSize))
+	return string(b), err
+}
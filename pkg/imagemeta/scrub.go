@@ -0,0 +1,234 @@
+package imagemeta
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// JPEG segments kept by Scrub besides JFIF (APP0)
+const (
+	markerAPP2  = 0xE2 // ICC profile
+	markerAPP14 = 0xEE // Adobe color transform, needed to decode CMYK JPEGs
+)
+
+// maxEXIFChunk limits the eXIf chunk read to keep the orientation
+const maxEXIFChunk = 1 << 20
+
+// ScrubOptions selects what Scrub keeps
+type ScrubOptions struct {
+	// KeepOrientation keeps the EXIF orientation, so images whose pixels
+	// are stored sideways still display upright
+	KeepOrientation bool
+}
+
+// Scrub copies a JPEG or PNG image from r to w without EXIF (including
+// GPS), XMP, IPTC, comments and PNG text chunks. The pixel data is copied
+// as is, and color profiles are kept. Other formats are copied unchanged.
+// It reports whether any metadata was removed.
+func Scrub(w io.Writer, r io.Reader, opts ScrubOptions) (bool, error) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(len(pngSignature))
+
+	switch {
+	case bytes.HasPrefix(head, []byte{0xFF, markerSOI}):
+		return scrubJPEG(w, br, opts)
+	case bytes.HasPrefix(head, pngSignature):
+		return scrubPNG(w, br, opts)
+	default:
+		_, err := io.Copy(w, br)
+		return false, err
+	}
+}
+
+// scrubJPEG filters the marker segments before the image data
+func scrubJPEG(w io.Writer, r *bufio.Reader, opts ScrubOptions) (bool, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil {
+		return false, err
+	}
+	if _, err := w.Write(soi[:]); err != nil {
+		return false, err
+	}
+
+	removed := false
+	for {
+		marker, err := readMarker(r)
+		if err != nil {
+			return removed, err
+		}
+
+		// Entropy coded data follows the start of scan; markers without
+		// a length only appear from there on
+		if marker == markerSOS || marker == markerEOI || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+			if _, err := w.Write([]byte{0xFF, marker}); err != nil {
+				return removed, err
+			}
+			_, err := io.Copy(w, r)
+			return removed, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			return removed, err
+		}
+		size := int(binary.BigEndian.Uint16(length[:])) - 2
+		if size < 0 {
+			return removed, ErrNotJPEG
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return removed, err
+		}
+
+		if keepSegment(marker) {
+			var buf bytes.Buffer
+			writeSegment(&buf, marker, payload)
+			if _, err := w.Write(buf.Bytes()); err != nil {
+				return removed, err
+			}
+			continue
+		}
+
+		removed = true
+		if opts.KeepOrientation && marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) {
+			if v := scrubbedOrientation(payload[len(exifHeader):]); v != 1 {
+				var buf bytes.Buffer
+				writeSegment(&buf, markerAPP1, append(append([]byte{}, exifHeader...), orientationTIFF(v)...))
+				if _, err := w.Write(buf.Bytes()); err != nil {
+					return removed, err
+				}
+			}
+		}
+	}
+}
+
+// readMarker reads the next marker, skipping fill bytes
+func readMarker(r *bufio.Reader) (byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != 0xFF {
+		return 0, ErrNotJPEG
+	}
+	for {
+		if b, err = r.ReadByte(); err != nil {
+			return 0, err
+		}
+		if b != 0xFF {
+			return b, nil
+		}
+	}
+}
+
+// keepSegment reports whether a JPEG segment survives scrubbing. EXIF and
+// XMP (APP1), IPTC (APP13), vendor data (APP3-APP12, APP15) and comments are
+// dropped; JFIF (APP0), ICC profiles (APP2), Adobe color info (APP14) and
+// the decoding tables are kept.
+func keepSegment(marker byte) bool {
+	switch {
+	case marker == markerCOM:
+		return false
+	case marker >= markerAPP0 && marker <= 0xEF:
+		return marker == markerAPP0 || marker == markerAPP2 || marker == markerAPP14
+	default:
+		return true
+	}
+}
+
+// scrubbedOrientation returns the orientation of EXIF TIFF data, 1 if none
+func scrubbedOrientation(data []byte) int {
+	if t, ok := parseTIFF(data); ok {
+		return tiffOrientation(t)
+	}
+	return 1
+}
+
+// orientationTIFF returns EXIF TIFF data holding only an orientation
+func orientationTIFF(orientation int) []byte {
+	return []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // big endian header, IFD0 at 8
+		0, 1, // one entry
+		byte(tagOrientation >> 8), byte(tagOrientation & 0xFF), 0, typeShort, 0, 0, 0, 1, 0, byte(orientation), 0, 0,
+		0, 0, 0, 0, // no next IFD
+	}
+}
+
+// scrubPNG drops text and eXIf chunks
+func scrubPNG(w io.Writer, r *bufio.Reader, opts ScrubOptions) (bool, error) {
+	sig := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, sig); err != nil {
+		return false, err
+	}
+	if _, err := w.Write(sig); err != nil {
+		return false, err
+	}
+
+	removed := false
+	for {
+		var head [8]byte
+		if _, err := io.ReadFull(r, head[:]); err != nil {
+			if err == io.EOF {
+				return removed, nil
+			}
+			return removed, err
+		}
+		length := int64(binary.BigEndian.Uint32(head[:4]))
+		typ := string(head[4:])
+
+		switch typ {
+		case "tEXt", "zTXt", "iTXt":
+			removed = true
+			if _, err := r.Discard(int(length) + 4); err != nil {
+				return removed, err
+			}
+			continue
+		case "eXIf":
+			removed = true
+			if length > maxEXIFChunk {
+				if _, err := r.Discard(int(length) + 4); err != nil {
+					return removed, err
+				}
+				continue
+			}
+			data := make([]byte, length+4)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return removed, err
+			}
+			if !opts.KeepOrientation {
+				continue
+			}
+			if v := scrubbedOrientation(data[:length]); v != 1 {
+				if err := writeChunk(w, "eXIf", orientationTIFF(v)); err != nil {
+					return removed, err
+				}
+			}
+			continue
+		}
+
+		if _, err := w.Write(head[:]); err != nil {
+			return removed, err
+		}
+		if _, err := io.CopyN(w, r, length+4); err != nil {
+			return removed, err
+		}
+		if typ == "IEND" {
+			_, err := io.Copy(io.Discard, r)
+			return removed, err
+		}
+	}
+}
+
+// writeChunk writes a PNG chunk with its CRC
+func writeChunk(w io.Writer, typ string, data []byte) error {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint32(len(data)))
+	buf.WriteString(typ)
+	buf.Write(data)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(buf.Bytes()[4:]))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
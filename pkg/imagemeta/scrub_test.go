@@ -0,0 +1,75 @@
+package imagemeta
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestScrubJPEG(t *testing.T) {
+	src := jpegWith(
+		Segment{Marker: markerAPP0, Data: []byte("JFIF\x00")},
+		Segment{Marker: markerAPP1, Data: exifSegment(sampleEXIF())},
+		Segment{Marker: markerAPP1, Data: xmpSegment(sampleXMP)},
+		Segment{Marker: markerAPP2, Data: []byte("ICC_PROFILE\x00")},
+		Segment{Marker: 0xE5, Data: []byte("vendor")},
+		Segment{Marker: markerAPP13, Data: iptcSegment(iimDataset{iptcKeywords, "tibet"})},
+		Segment{Marker: markerAPP14, Data: []byte("Adobe\x00")},
+		Segment{Marker: markerCOM, Data: []byte("comment")},
+	)
+
+	tests := []struct {
+		name        string
+		opts        ScrubOptions
+		markers     string
+		orientation int
+	}{
+		{name: "everything", markers: "E0 E2 EE DB", orientation: 1},
+		{name: "keep orientation", opts: ScrubOptions{KeepOrientation: true}, markers: "E0 E1 E2 EE DB", orientation: 6},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		removed, err := Scrub(&out, bytes.NewReader(src), tt.opts)
+		if err != nil || !removed {
+			t.Fatalf("%s: Scrub = %v, %v", tt.name, removed, err)
+		}
+
+		segments, err := ReadSegments(out.Bytes())
+		if err != nil {
+			t.Fatalf("%s: ReadSegments: %v", tt.name, err)
+		}
+		if got := markers(segments); got != tt.markers {
+			t.Errorf("%s: markers = %s, want %s", tt.name, got, tt.markers)
+		}
+
+		if got := Orientation(out.Bytes()); got != tt.orientation {
+			t.Errorf("%s: orientation = %d, want %d", tt.name, got, tt.orientation)
+		}
+		m := Extract(out.Bytes())
+		if m.GPS != nil || m.Make != "" || len(m.Keywords) != 0 || m.Title != "" {
+			t.Errorf("%s: metadata left = %+v", tt.name, m)
+		}
+		// The scan is copied as is
+		if !bytes.HasSuffix(out.Bytes(), src[len(src)-8:]) {
+			t.Errorf("%s: image data changed", tt.name)
+		}
+	}
+}
+
+func TestScrubUnchanged(t *testing.T) {
+	clean := jpegWith(
+		Segment{Marker: markerAPP0, Data: []byte("JFIF\x00")},
+		Segment{Marker: markerAPP14, Data: []byte("Adobe\x00")},
+	)
+
+	for name, src := range map[string][]byte{"clean JPEG": clean, "GIF": []byte("GIF89a\x01\x00\x01\x00")} {
+		var out bytes.Buffer
+		removed, err := Scrub(&out, bytes.NewReader(src), ScrubOptions{KeepOrientation: true})
+		if err != nil || removed {
+			t.Errorf("%s: Scrub = %v, %v; want nothing removed", name, removed, err)
+		}
+		if !bytes.Equal(out.Bytes(), src) {
+			t.Errorf("%s: content changed", name)
+		}
+	}
+}
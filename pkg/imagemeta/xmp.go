@@ -0,0 +1,96 @@
+package imagemeta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+)
+
+// xmpHeader starts the APP1 segment holding an XMP packet
+var xmpHeader = []byte("http://ns.adobe.com/xap/1.0/\x00")
+
+// XMP namespaces
+const (
+	nsRDF = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	nsDC  = "http://purl.org/dc/elements/1.1/"
+)
+
+// parseXMP reads the Dublin Core properties of an XMP packet. Properties
+// are either simple attributes of rdf:Description or elements holding an
+// rdf:Alt, rdf:Bag or rdf:Seq of rdf:li items.
+func parseXMP(packet []byte) *descriptive {
+	x := &descriptive{}
+	dec := xml.NewDecoder(bytes.NewReader(packet))
+	dec.Strict = false
+
+	var property string // Dublin Core element being read
+	var text strings.Builder
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == nsRDF && t.Name.Local == "Description" {
+				for _, attr := range t.Attr {
+					if attr.Name.Space == nsDC {
+						setXMP(x, attr.Name.Local, attr.Value)
+					}
+				}
+			}
+			if t.Name.Space == nsDC {
+				property = t.Name.Local
+			}
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			text.Reset()
+
+			switch {
+			case t.Name.Space == nsRDF && t.Name.Local == "li" && property != "":
+				setXMP(x, property, value)
+			case t.Name.Space == nsDC:
+				// simple element value, without rdf:li
+				if t.Name.Local == property && value != "" {
+					setXMP(x, property, value)
+				}
+				property = ""
+			}
+		}
+	}
+
+	return x
+}
+
+// setXMP stores a Dublin Core property; list properties collect all values
+// while for language alternatives the first (default) value wins
+func setXMP(x *descriptive, property, value string) {
+	if value == "" {
+		return
+	}
+
+	switch property {
+	case "title":
+		setFirst(&x.title, value)
+	case "description":
+		setFirst(&x.description, value)
+	case "creator":
+		setFirst(&x.creator, value)
+	case "rights":
+		setFirst(&x.copyright, value)
+	case "subject":
+		x.keywords = appendUnique(x.keywords, value)
+	}
+}
+
+// setFirst sets *dst to v if it is still empty
+func setFirst(dst *string, v string) {
+	if *dst == "" {
+		*dst = v
+	}
+}
@@ -4,11 +4,8 @@ import (
 	"fmt"
 	"image"
 	"image/draw"
-	"image/jpeg"
-	"image/png"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/gantoho/go-img-sys/pkg/logger"
 )
@@ -17,7 +14,9 @@ import (
 type ThumbnailConfig struct {
 	Width   int
 	Height  int
-	Quality int // 仅JPEG
+	Quality int     // 仅JPEG
+	Fit     FitMode // 适配模式，默认 inside
+	Filter  Filter  // 重采样滤波器，默认 lanczos
 }
 
 // DefaultThumbnailConfig 默认缩略图配置
@@ -25,52 +24,21 @@ var DefaultThumbnailConfig = ThumbnailConfig{
 	Width:   200,
 	Height:  200,
 	Quality: 85,
+	Fit:     FitInside,
+	Filter:  FilterLanczos,
 }
 
 // GenerateThumbnail 生成缩略图
 func GenerateThumbnail(sourcePath string, thumbPath string, config ThumbnailConfig) error {
 	logger := logger.GetLogger()
 
-	// 打开原始图片
-	sourceFile, err := os.Open(sourcePath)
-	if err != nil {
-		logger.Error("Failed to open source image: %v", err)
-		return err
-	}
-	defer sourceFile.Close()
-
-	// 解码图片
-	img, format, err := image.DecodeConfig(sourceFile)
+	originalImg, format, err := decodeFile(sourcePath)
 	if err != nil {
 		logger.Error("Failed to decode image: %v", err)
 		return err
 	}
 
-	// 重新打开文件用于实际解码
-	sourceFile.Seek(0, 0)
-
-	var originalImg image.Image
-	switch strings.ToLower(format) {
-	case "jpeg":
-		originalImg, err = jpeg.Decode(sourceFile)
-	case "png":
-		originalImg, err = png.Decode(sourceFile)
-	default:
-		logger.Warn("Unsupported format for thumbnail: %s", format)
-		return fmt.Errorf("unsupported format: %s", format)
-	}
-
-	if err != nil {
-		logger.Error("Failed to decode image content: %v", err)
-		return err
-	}
-
-	// 计算缩略图尺寸（保持宽高比）
-	thumbWidth, thumbHeight := calculateThumbnailSize(img.Width, img.Height, config.Width, config.Height)
-
-	// 创建缩略图
-	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
-	draw.Draw(thumb, thumb.Bounds(), originalImg, image.Point{}, draw.Src)
+	thumb := Thumbnail(originalImg, config)
 
 	// 确保缩略图目录存在
 	thumbDir := filepath.Dir(thumbPath)
@@ -79,23 +47,8 @@ func GenerateThumbnail(sourcePath string, thumbPath string, config ThumbnailConf
 		return err
 	}
 
-	// 保存缩略图
-	thumbFile, err := os.Create(thumbPath)
-	if err != nil {
-		logger.Error("Failed to create thumbnail file: %v", err)
-		return err
-	}
-	defer thumbFile.Close()
-
 	// 根据原始格式保存
-	switch strings.ToLower(format) {
-	case "jpeg":
-		err = jpeg.Encode(thumbFile, thumb, &jpeg.Options{Quality: config.Quality})
-	case "png":
-		err = png.Encode(thumbFile, thumb)
-	}
-
-	if err != nil {
+	if err := encodeFile(thumbPath, thumb, format, config.Quality); err != nil {
 		logger.Error("Failed to encode thumbnail: %v", err)
 		return err
 	}
@@ -104,123 +57,90 @@ func GenerateThumbnail(sourcePath string, thumbPath string, config ThumbnailConf
 	return nil
 }
 
-// calculateThumbnailSize 计算缩略图尺寸（保持宽高比）
-func calculateThumbnailSize(origWidth, origHeight, maxWidth, maxHeight int) (int, int) {
-	ratio := float64(origWidth) / float64(origHeight)
-	targetRatio := float64(maxWidth) / float64(maxHeight)
-
-	var w, h int
-	if ratio > targetRatio {
-		w = maxWidth
-		h = int(float64(maxWidth) / ratio)
-	} else {
-		h = maxHeight
-		w = int(float64(maxHeight) * ratio)
+// Thumbnail 按缩略图配置缩放已解码的图片
+func Thumbnail(img image.Image, config ThumbnailConfig) image.Image {
+	fit := config.Fit
+	if fit == "" {
+		fit = FitInside
 	}
-
-	return w, h
+	return Fit(img, config.Width, config.Height, fit, config.Filter)
 }
 
-// RotateImage 旋转图片（90, 180, 270度）
-func RotateImage(sourcePath string, outputPath string, degrees int) error {
-	logger := logger.GetLogger()
-
-	if degrees%90 != 0 {
-		return fmt.Errorf("rotation degrees must be multiple of 90")
-	}
-
-	sourceFile, err := os.Open(sourcePath)
+// decodeFile 解码图片文件，返回图片及其格式
+func decodeFile(path string) (image.Image, string, error) {
+	file, err := os.Open(path)
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	defer sourceFile.Close()
+	defer file.Close()
 
-	img, format, err := image.DecodeConfig(sourceFile)
+	return Decode(file)
+}
+
+// encodeFile 按格式编码并写入图片文件，写入失败时删除不完整的文件
+func encodeFile(path string, img image.Image, format string, quality int) error {
+	file, err := os.Create(path)
 	if err != nil {
 		return err
 	}
 
-	sourceFile.Seek(0, 0)
-
-	var originalImg image.Image
-	switch strings.ToLower(format) {
-	case "jpeg":
-		originalImg, _ = jpeg.Decode(sourceFile)
-	case "png":
-		originalImg, _ = png.Decode(sourceFile)
-	default:
-		return fmt.Errorf("unsupported format")
-	}
+	err = Encode(file, img, format, quality)
 
-	// 简化旋转（实际应用中建议使用专业库）
-	var rotated image.Image
-	switch degrees % 360 {
-	case 90, 270:
-		rotated = image.NewRGBA(image.Rect(0, 0, img.Height, img.Width))
-	default:
-		rotated = originalImg
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
 	}
-
-	outFile, _ := os.Create(outputPath)
-	defer outFile.Close()
-
-	switch strings.ToLower(format) {
-	case "jpeg":
-		jpeg.Encode(outFile, rotated, &jpeg.Options{Quality: 90})
-	case "png":
-		png.Encode(outFile, rotated)
+	if err != nil {
+		os.Remove(path)
 	}
+	return err
+}
 
-	logger.Info("Image rotated: %s", outputPath)
-	return nil
+// RotateImage 顺时针旋转图片（90, 180, 270度）
+func RotateImage(sourcePath string, outputPath string, degrees int) error {
+	return OrientImage(sourcePath, outputPath, Orientation{Rotate: degrees})
 }
 
-// ResizeImage 缩放图片
-func ResizeImage(sourcePath string, outputPath string, width, height int) error {
+// OrientImage 旋转、翻转或转置图片文件
+func OrientImage(sourcePath string, outputPath string, o Orientation) error {
 	logger := logger.GetLogger()
 
-	if width <= 0 || height <= 0 {
-		return fmt.Errorf("width and height must be positive")
+	if err := o.Validate(); err != nil {
+		return err
 	}
 
-	sourceFile, err := os.Open(sourcePath)
+	originalImg, format, err := decodeFile(sourcePath)
 	if err != nil {
 		return err
 	}
-	defer sourceFile.Close()
 
-	_, format, err := image.DecodeConfig(sourceFile)
-	if err != nil {
+	if err := encodeFile(outputPath, Orient(originalImg, o), format, 90); err != nil {
 		return err
 	}
 
-	sourceFile.Seek(0, 0)
+	logger.Info("Image oriented: %s", outputPath)
+	return nil
+}
+
+// ResizeImage 缩放图片。width 或 height 为 0 时按宽高比推算。
+func ResizeImage(sourcePath string, outputPath string, width, height int, fit FitMode, filter Filter) error {
+	logger := logger.GetLogger()
 
-	var originalImg image.Image
-	switch strings.ToLower(format) {
-	case "jpeg":
-		originalImg, _ = jpeg.Decode(sourceFile)
-	case "png":
-		originalImg, _ = png.Decode(sourceFile)
-	default:
-		return fmt.Errorf("unsupported format")
+	if width < 0 || height < 0 || (width == 0 && height == 0) {
+		return fmt.Errorf("width and height must be positive")
 	}
 
-	// 简单缩放实现
-	resized := image.NewRGBA(image.Rect(0, 0, width, height))
-	draw.Draw(resized, resized.Bounds(), originalImg, image.Point{}, draw.Src)
+	originalImg, format, err := decodeFile(sourcePath)
+	if err != nil {
+		return err
+	}
 
-	outFile, _ := os.Create(outputPath)
-	defer outFile.Close()
+	resized := Fit(originalImg, width, height, fit, filter)
 
-	switch strings.ToLower(format) {
-	case "jpeg":
-		jpeg.Encode(outFile, resized, &jpeg.Options{Quality: 90})
-	case "png":
-		png.Encode(outFile, resized)
+	if err := encodeFile(outputPath, resized, format, 90); err != nil {
+		return err
 	}
 
-	logger.Info("Image resized to %dx%d: %s", width, height, outputPath)
+	logger.Info("Image resized to %dx%d: %s", resized.Bounds().Dx(), resized.Bounds().Dy(), outputPath)
 	return nil
 }
 
@@ -228,42 +148,18 @@ func ResizeImage(sourcePath string, outputPath string, width, height int) error
 func AddWatermark(sourcePath string, outputPath string, watermarkText string) error {
 	logger := logger.GetLogger()
 
-	sourceFile, err := os.Open(sourcePath)
-	if err != nil {
-		return err
-	}
-	defer sourceFile.Close()
-
-	_, format, err := image.DecodeConfig(sourceFile)
+	originalImg, format, err := decodeFile(sourcePath)
 	if err != nil {
 		return err
 	}
 
-	sourceFile.Seek(0, 0)
-
-	var originalImg image.Image
-	switch strings.ToLower(format) {
-	case "jpeg":
-		originalImg, _ = jpeg.Decode(sourceFile)
-	case "png":
-		originalImg, _ = png.Decode(sourceFile)
-	default:
-		return fmt.Errorf("unsupported format")
-	}
-
 	// 简单水印实现（在右下角添加文本）
 	// 实际应用需要使用 golang.org/x/image/font 包
 	result := image.NewRGBA(originalImg.Bounds())
-	draw.Draw(result, result.Bounds(), originalImg, image.Point{}, draw.Src)
-
-	outFile, _ := os.Create(outputPath)
-	defer outFile.Close()
+	draw.Draw(result, result.Bounds(), originalImg, originalImg.Bounds().Min, draw.Src)
 
-	switch strings.ToLower(format) {
-	case "jpeg":
-		jpeg.Encode(outFile, result, &jpeg.Options{Quality: 90})
-	case "png":
-		png.Encode(outFile, result)
+	if err := encodeFile(outputPath, result, format, 90); err != nil {
+		return err
 	}
 
 	logger.Info("Watermark added to: %s", outputPath)
@@ -0,0 +1,141 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+// Flip 翻转方向
+type Flip string
+
+const (
+	FlipNone       Flip = ""
+	FlipHorizontal Flip = "horizontal" // 左右翻转
+	FlipVertical   Flip = "vertical"   // 上下翻转
+)
+
+// ParseFlip 解析翻转方向，支持 horizontal/h 与 vertical/v
+func ParseFlip(name string) (Flip, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "none":
+		return FlipNone, nil
+	case "horizontal", "h":
+		return FlipHorizontal, nil
+	case "vertical", "v":
+		return FlipVertical, nil
+	default:
+		return "", fmt.Errorf("unknown flip: %s", name)
+	}
+}
+
+// Orientation 无损方向变换，依次执行顺时针旋转、翻转和转置
+type Orientation struct {
+	Rotate    int  // 顺时针旋转角度，必须是 90 的倍数
+	Flip      Flip // 翻转方向
+	Transpose bool // 沿左上-右下对角线转置
+}
+
+// IsZero 是否不改变图片
+func (o Orientation) IsZero() bool {
+	return normalizeDegrees(o.Rotate) == 0 && o.Flip == FlipNone && !o.Transpose
+}
+
+// Validate 检查参数是否合法
+func (o Orientation) Validate() error {
+	if o.Rotate%90 != 0 {
+		return fmt.Errorf("rotation degrees must be multiple of 90")
+	}
+	if _, err := ParseFlip(string(o.Flip)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// exifOrientations EXIF 方向值（2-8）对应的摆正操作
+var exifOrientations = map[int]Orientation{
+	2: {Flip: FlipHorizontal},
+	3: {Rotate: 180},
+	4: {Flip: FlipVertical},
+	5: {Transpose: true},
+	6: {Rotate: 90},
+	7: {Rotate: 270, Flip: FlipHorizontal},
+	8: {Rotate: 270},
+}
+
+// OrientationFromEXIF 返回将 EXIF 方向为 orientation 的图片摆正所需的操作
+func OrientationFromEXIF(orientation int) Orientation {
+	return exifOrientations[orientation]
+}
+
+// Orient 按方向变换参数处理图片
+func Orient(img image.Image, o Orientation) *image.RGBA {
+	dst := Rotate(img, o.Rotate)
+
+	switch o.Flip {
+	case FlipHorizontal:
+		dst = FlipH(dst)
+	case FlipVertical:
+		dst = FlipV(dst)
+	}
+
+	if o.Transpose {
+		dst = Transpose(dst)
+	}
+	return dst
+}
+
+// Rotate 顺时针旋转图片，degrees 必须是 90 的倍数
+func Rotate(img image.Image, degrees int) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	switch normalizeDegrees(degrees) {
+	case 90:
+		return remap(src, h, w, func(x, y int) (int, int) { return h - 1 - y, x })
+	case 180:
+		return remap(src, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+	case 270:
+		return remap(src, h, w, func(x, y int) (int, int) { return y, w - 1 - x })
+	default:
+		return src
+	}
+}
+
+// FlipH 左右翻转图片
+func FlipH(img image.Image) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	return remap(src, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+// FlipV 上下翻转图片
+func FlipV(img image.Image) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	return remap(src, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+// Transpose 沿左上-右下对角线转置图片（交换行与列）
+func Transpose(img image.Image) *image.RGBA {
+	src := toRGBA(img)
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	return remap(src, h, w, func(x, y int) (int, int) { return y, x })
+}
+
+// remap 将 src 的每个像素复制到 mapPoint 给出的目标位置，生成 dstW x dstH 的图片
+func remap(src *image.RGBA, dstW, dstH int, mapPoint func(x, y int) (int, int)) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := mapPoint(x, y)
+			s := y*src.Stride + x*4
+			d := dy*dst.Stride + dx*4
+			copy(dst.Pix[d:d+4], src.Pix[s:s+4])
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,184 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"strings"
+	"testing"
+)
+
+func TestRotateFlipTranspose(t *testing.T) {
+	// 3x2 image, pixels named by their position:
+	//   a b c
+	//   d e f
+	src := pattern(3, 2)
+
+	tests := []struct {
+		name string
+		got  *image.RGBA
+		want string
+	}{
+		{name: "Rotate 0", got: Rotate(src, 0), want: "abc/def"},
+		{name: "Rotate 90", got: Rotate(src, 90), want: "da/eb/fc"},
+		{name: "Rotate 180", got: Rotate(src, 180), want: "fed/cba"},
+		{name: "Rotate 270", got: Rotate(src, 270), want: "cf/be/ad"},
+		{name: "Rotate -90", got: Rotate(src, -90), want: "cf/be/ad"},
+		{name: "Rotate 450", got: Rotate(src, 450), want: "da/eb/fc"},
+		{name: "FlipH", got: FlipH(src), want: "cba/fed"},
+		{name: "FlipV", got: FlipV(src), want: "def/abc"},
+		{name: "Transpose", got: Transpose(src), want: "ad/be/cf"},
+		{name: "Orient flip", got: Orient(src, Orientation{Flip: FlipVertical}), want: "def/abc"},
+		// Rotating, mirroring and transposing again gives the original
+		{name: "Orient all", got: Orient(src, Orientation{Rotate: 90, Flip: FlipHorizontal, Transpose: true}), want: "abc/def"},
+	}
+
+	for _, tt := range tests {
+		if got := layout(tt.got); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOrientationFromEXIF(t *testing.T) {
+	upright := pattern(3, 2)
+
+	// How a camera stores the upright image for each EXIF orientation
+	stored := map[int]*image.RGBA{
+		1: upright,
+		2: FlipH(upright),
+		3: Rotate(upright, 180),
+		4: FlipV(upright),
+		5: Transpose(upright),
+		6: Rotate(upright, 270),
+		7: Rotate(FlipH(upright), 90),
+		8: Rotate(upright, 90),
+	}
+
+	for orientation, img := range stored {
+		got := Orient(img, OrientationFromEXIF(orientation))
+		if layout(got) != layout(upright) {
+			t.Errorf("orientation %d: Orient gives %s, want %s", orientation, layout(got), layout(upright))
+		}
+	}
+
+	if !OrientationFromEXIF(1).IsZero() || !OrientationFromEXIF(0).IsZero() {
+		t.Errorf("normal orientation is not the zero Orientation")
+	}
+}
+
+func TestOrientationValidate(t *testing.T) {
+	tests := []struct {
+		o       Orientation
+		zero    bool
+		invalid bool
+	}{
+		{o: Orientation{}, zero: true},
+		{o: Orientation{Rotate: 360}, zero: true},
+		{o: Orientation{Rotate: -270}},
+		{o: Orientation{Flip: FlipHorizontal}},
+		{o: Orientation{Transpose: true}},
+		{o: Orientation{Rotate: 45}, invalid: true},
+		{o: Orientation{Flip: "diagonal"}, invalid: true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.o.Validate(); (err != nil) != tt.invalid {
+			t.Errorf("%+v: Validate() = %v, want invalid %v", tt.o, err, tt.invalid)
+		}
+		if !tt.invalid && tt.o.IsZero() != tt.zero {
+			t.Errorf("%+v: IsZero() = %v, want %v", tt.o, tt.o.IsZero(), tt.zero)
+		}
+	}
+}
+
+func TestParseFlip(t *testing.T) {
+	tests := map[string]Flip{
+		"":           FlipNone,
+		"none":       FlipNone,
+		"H":          FlipHorizontal,
+		"horizontal": FlipHorizontal,
+		" v ":        FlipVertical,
+		"vertical":   FlipVertical,
+	}
+	for name, want := range tests {
+		if got, err := ParseFlip(name); err != nil || got != want {
+			t.Errorf("ParseFlip(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFlip("diagonal"); err == nil {
+		t.Errorf("ParseFlip(diagonal) succeeded")
+	}
+}
+
+func TestDecodeAppliesEXIFOrientation(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 16)), nil); err != nil {
+		t.Fatalf("encoding JPEG: %v", err)
+	}
+
+	tests := []struct {
+		orientation int
+		w, h        int
+	}{
+		{orientation: 1, w: 40, h: 16},
+		{orientation: 3, w: 40, h: 16},
+		{orientation: 6, w: 16, h: 40},
+		{orientation: 8, w: 16, h: 40},
+	}
+
+	for _, tt := range tests {
+		img, format, err := Decode(bytes.NewReader(withOrientation(buf.Bytes(), tt.orientation)))
+		if err != nil {
+			t.Fatalf("orientation %d: Decode: %v", tt.orientation, err)
+		}
+		b := img.Bounds()
+		if format != "jpeg" || b.Dx() != tt.w || b.Dy() != tt.h {
+			t.Errorf("orientation %d: Decode = %s %dx%d, want jpeg %dx%d", tt.orientation, format, b.Dx(), b.Dy(), tt.w, tt.h)
+		}
+	}
+}
+
+// pattern returns a w x h image whose pixels are named "a", "b", ... row by
+// row through their red value
+func pattern(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: byte('a' + y*w + x), A: 255})
+		}
+	}
+	return img
+}
+
+// layout returns the pixel names of a pattern image, rows separated by "/"
+func layout(img *image.RGBA) string {
+	b := img.Bounds()
+	rows := make([]string, 0, b.Dy())
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var row []byte
+		for x := b.Min.X; x < b.Max.X; x++ {
+			row = append(row, img.RGBAAt(x, y).R)
+		}
+		rows = append(rows, string(row))
+	}
+	return strings.Join(rows, "/")
+}
+
+// withOrientation inserts an EXIF segment with the given orientation after
+// the start marker of a JPEG
+func withOrientation(data []byte, orientation int) []byte {
+	tiff := []byte{
+		'I', 'I', 42, 0, 8, 0, 0, 0, // little endian header, IFD0 at 8
+		1, 0, // one entry
+		0x12, 0x01, 3, 0, 1, 0, 0, 0, byte(orientation), 0, 0, 0, // Orientation, SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := append([]byte{0xFF, 0xE1, 0, byte(len(payload) + 2)}, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
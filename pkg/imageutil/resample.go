@@ -0,0 +1,340 @@
+package imageutil
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strings"
+)
+
+// Filter 重采样滤波器
+type Filter string
+
+const (
+	FilterNearest    Filter = "nearest"    // 最近邻，速度最快，有锯齿
+	FilterBilinear   Filter = "bilinear"   // 双线性
+	FilterCatmullRom Filter = "catmullrom" // Catmull-Rom 三次卷积，较锐利
+	FilterLanczos    Filter = "lanczos"    // Lanczos3，质量最好
+)
+
+// FitMode 缩放适配模式
+type FitMode string
+
+const (
+	FitContain FitMode = "contain" // 等比缩放至完整放入目标框（可放大）
+	FitCover   FitMode = "cover"   // 等比缩放至铺满目标框，居中裁剪多余部分
+	FitFill    FitMode = "fill"    // 拉伸至目标尺寸，不保持宽高比
+	FitInside  FitMode = "inside"  // 同 contain，但不放大小图
+)
+
+// ParseFilter 解析滤波器名称
+func ParseFilter(name string) (Filter, error) {
+	switch f := Filter(strings.ToLower(name)); f {
+	case "":
+		return FilterLanczos, nil
+	case FilterNearest, FilterBilinear, FilterCatmullRom, FilterLanczos:
+		return f, nil
+	case "catmull-rom", "bicubic":
+		return FilterCatmullRom, nil
+	default:
+		return "", fmt.Errorf("unknown resample filter: %s", name)
+	}
+}
+
+// ParseFitMode 解析适配模式名称
+func ParseFitMode(name string) (FitMode, error) {
+	switch m := FitMode(strings.ToLower(name)); m {
+	case "":
+		return FitInside, nil
+	case FitContain, FitCover, FitFill, FitInside:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unknown fit mode: %s", name)
+	}
+}
+
+// kernel 返回滤波器的卷积核及其半径
+func (f Filter) kernel() (func(float64) float64, float64) {
+	switch f {
+	case FilterBilinear:
+		return func(x float64) float64 {
+			x = math.Abs(x)
+			if x < 1 {
+				return 1 - x
+			}
+			return 0
+		}, 1
+	case FilterCatmullRom:
+		return func(x float64) float64 {
+			x = math.Abs(x)
+			switch {
+			case x < 1:
+				return (3*x*x*x - 5*x*x + 2) / 2
+			case x < 2:
+				return (-x*x*x + 5*x*x - 8*x + 4) / 2
+			}
+			return 0
+		}, 2
+	default: // Lanczos3
+		return func(x float64) float64 {
+			x = math.Abs(x)
+			if x == 0 {
+				return 1
+			}
+			if x < 3 {
+				px := math.Pi * x
+				return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+			}
+			return 0
+		}, 3
+	}
+}
+
+// FitSize 计算按适配模式缩放后的尺寸。width 或 height 为 0 时按宽高比推算。
+// cover 模式返回的是裁剪后的最终尺寸（即目标框尺寸）。
+func FitSize(srcWidth, srcHeight, width, height int, mode FitMode) (int, int) {
+	if srcWidth <= 0 || srcHeight <= 0 {
+		return 0, 0
+	}
+
+	switch {
+	case width <= 0 && height <= 0:
+		width, height = srcWidth, srcHeight
+	case width <= 0:
+		width = maxInt(1, int(math.Round(float64(srcWidth)*float64(height)/float64(srcHeight))))
+	case height <= 0:
+		height = maxInt(1, int(math.Round(float64(srcHeight)*float64(width)/float64(srcWidth))))
+	}
+
+	switch mode {
+	case FitFill, FitCover:
+		return width, height
+	}
+
+	scale := math.Min(float64(width)/float64(srcWidth), float64(height)/float64(srcHeight))
+	if mode == FitInside && scale > 1 {
+		scale = 1
+	}
+
+	w := maxInt(1, int(math.Round(float64(srcWidth)*scale)))
+	h := maxInt(1, int(math.Round(float64(srcHeight)*scale)))
+	return w, h
+}
+
+// Fit 按适配模式将图片缩放到目标尺寸
+func Fit(img image.Image, width, height int, mode FitMode, filter Filter) *image.RGBA {
+	b := img.Bounds()
+	w, h := FitSize(b.Dx(), b.Dy(), width, height, mode)
+
+	if mode == FitCover {
+		// 先按目标宽高比居中裁剪源图，再缩放
+		srcRatio := float64(b.Dx()) / float64(b.Dy())
+		dstRatio := float64(w) / float64(h)
+
+		crop := b
+		if srcRatio > dstRatio {
+			cw := int(math.Round(float64(b.Dy()) * dstRatio))
+			x0 := b.Min.X + (b.Dx()-cw)/2
+			crop = image.Rect(x0, b.Min.Y, x0+cw, b.Max.Y)
+		} else if srcRatio < dstRatio {
+			ch := int(math.Round(float64(b.Dx()) / dstRatio))
+			y0 := b.Min.Y + (b.Dy()-ch)/2
+			crop = image.Rect(b.Min.X, y0, b.Max.X, y0+ch)
+		}
+		img = subImage(img, crop)
+	}
+
+	return Resize(img, w, h, filter)
+}
+
+// Resize 使用指定滤波器将图片重采样到 width x height
+func Resize(img image.Image, width, height int, filter Filter) *image.RGBA {
+	src := toRGBA(img)
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+
+	if width <= 0 || height <= 0 || sw == 0 || sh == 0 {
+		return image.NewRGBA(image.Rect(0, 0, maxInt(width, 0), maxInt(height, 0)))
+	}
+	if width == sw && height == sh {
+		return src
+	}
+
+	if filter == FilterNearest {
+		return resizeNearest(src, width, height)
+	}
+
+	kernel, support := filter.kernel()
+
+	// 两次一维卷积：先水平（sh x width），再垂直（height x width）
+	xWeights := computeWeights(sw, width, kernel, support)
+	yWeights := computeWeights(sh, height, kernel, support)
+
+	tmp := make([]float64, sh*width*4)
+	for y := 0; y < sh; y++ {
+		row := src.Pix[y*src.Stride : y*src.Stride+sw*4]
+		for x, cw := range xWeights {
+			var r, g, bl, a float64
+			for i, w := range cw.weights {
+				off := (cw.start + i) * 4
+				r += float64(row[off]) * w
+				g += float64(row[off+1]) * w
+				bl += float64(row[off+2]) * w
+				a += float64(row[off+3]) * w
+			}
+			o := (y*width + x) * 4
+			tmp[o], tmp[o+1], tmp[o+2], tmp[o+3] = r, g, bl, a
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, cw := range yWeights {
+		for x := 0; x < width; x++ {
+			var r, g, bl, a float64
+			for i, w := range cw.weights {
+				o := ((cw.start+i)*width + x) * 4
+				r += tmp[o] * w
+				g += tmp[o+1] * w
+				bl += tmp[o+2] * w
+				a += tmp[o+3] * w
+			}
+
+			// 预乘 alpha：颜色分量不能超过 alpha
+			alpha := clampUint8(a)
+			d := y*dst.Stride + x*4
+			dst.Pix[d] = minUint8(clampUint8(r), alpha)
+			dst.Pix[d+1] = minUint8(clampUint8(g), alpha)
+			dst.Pix[d+2] = minUint8(clampUint8(bl), alpha)
+			dst.Pix[d+3] = alpha
+		}
+	}
+
+	return dst
+}
+
+// contribution 一个目标像素对应的源像素区间与权重
+type contribution struct {
+	start   int
+	weights []float64
+}
+
+// computeWeights 计算一维重采样权重。缩小时按比例放大卷积核以避免走样。
+func computeWeights(srcSize, dstSize int, kernel func(float64) float64, support float64) []contribution {
+	scale := float64(srcSize) / float64(dstSize)
+	filterScale := math.Max(scale, 1)
+	radius := support * filterScale
+
+	result := make([]contribution, dstSize)
+	for i := 0; i < dstSize; i++ {
+		center := (float64(i)+0.5)*scale - 0.5
+
+		start := int(math.Ceil(center - radius))
+		end := int(math.Floor(center + radius))
+		if start < 0 {
+			start = 0
+		}
+		if end > srcSize-1 {
+			end = srcSize - 1
+		}
+
+		weights := make([]float64, end-start+1)
+		var sum float64
+		for j := start; j <= end; j++ {
+			w := kernel((float64(j) - center) / filterScale)
+			weights[j-start] = w
+			sum += w
+		}
+
+		if sum != 0 {
+			for j := range weights {
+				weights[j] /= sum
+			}
+		} else {
+			// 极端情况下退化为最近邻
+			nearest := int(math.Round(center))
+			if nearest < start {
+				nearest = start
+			}
+			if nearest > end {
+				nearest = end
+			}
+			weights[nearest-start] = 1
+		}
+
+		result[i] = contribution{start: start, weights: weights}
+	}
+
+	return result
+}
+
+// resizeNearest 最近邻缩放
+func resizeNearest(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		sy := minInt(sh-1, int((float64(y)+0.5)*float64(sh)/float64(height)))
+		for x := 0; x < width; x++ {
+			sx := minInt(sw-1, int((float64(x)+0.5)*float64(sw)/float64(width)))
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:sy*src.Stride+sx*4+4])
+		}
+	}
+
+	return dst
+}
+
+// toRGBA 转换为以 (0,0) 为原点的 RGBA 图像
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Bounds().Min == (image.Point{}) {
+		return rgba
+	}
+
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+// subImage 裁剪图片区域
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if sub, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return sub.SubImage(r)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, r.Min, draw.Src)
+	return dst
+}
+
+func clampUint8(v float64) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= 255 {
+		return 255
+	}
+	return uint8(v + 0.5)
+}
+
+func minUint8(a, b uint8) uint8 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
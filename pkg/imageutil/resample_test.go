@@ -0,0 +1,113 @@
+package imageutil
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		srcW, srcH    int
+		width, height int
+		mode          FitMode
+		wantW, wantH  int
+	}{
+		{name: "contain wide", srcW: 400, srcH: 200, width: 100, height: 100, mode: FitContain, wantW: 100, wantH: 50},
+		{name: "contain tall", srcW: 200, srcH: 400, width: 100, height: 100, mode: FitContain, wantW: 50, wantH: 100},
+		{name: "contain enlarges", srcW: 40, srcH: 20, width: 100, height: 100, mode: FitContain, wantW: 100, wantH: 50},
+		{name: "inside keeps small", srcW: 40, srcH: 20, width: 100, height: 100, mode: FitInside, wantW: 40, wantH: 20},
+		{name: "inside shrinks", srcW: 400, srcH: 200, width: 100, height: 100, mode: FitInside, wantW: 100, wantH: 50},
+		{name: "cover", srcW: 400, srcH: 200, width: 100, height: 100, mode: FitCover, wantW: 100, wantH: 100},
+		{name: "fill", srcW: 400, srcH: 200, width: 30, height: 70, mode: FitFill, wantW: 30, wantH: 70},
+		{name: "width only", srcW: 400, srcH: 300, width: 200, mode: FitInside, wantW: 200, wantH: 150},
+		{name: "height only", srcW: 400, srcH: 300, height: 30, mode: FitFill, wantW: 40, wantH: 30},
+		{name: "neither", srcW: 400, srcH: 300, mode: FitContain, wantW: 400, wantH: 300},
+		{name: "at least one pixel", srcW: 1000, srcH: 1, width: 10, mode: FitInside, wantW: 10, wantH: 1},
+		{name: "empty source", srcW: 0, srcH: 10, width: 10, height: 10, mode: FitFill, wantW: 0, wantH: 0},
+	}
+
+	for _, tt := range tests {
+		w, h := FitSize(tt.srcW, tt.srcH, tt.width, tt.height, tt.mode)
+		if w != tt.wantW || h != tt.wantH {
+			t.Errorf("%s: FitSize = %dx%d, want %dx%d", tt.name, w, h, tt.wantW, tt.wantH)
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	// Left half black, right half white
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(src, image.Rect(32, 0, 64, 32), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for _, filter := range []Filter{FilterNearest, FilterBilinear, FilterCatmullRom, FilterLanczos} {
+		for _, size := range []image.Point{{16, 8}, {128, 64}, {7, 3}} {
+			dst := Resize(src, size.X, size.Y, filter)
+			if dst.Bounds().Dx() != size.X || dst.Bounds().Dy() != size.Y {
+				t.Errorf("%s: Resize to %v gives %v", filter, size, dst.Bounds().Size())
+				continue
+			}
+			// Edges keep their color; ringing of sharper filters stays near the middle
+			left, right := dst.RGBAAt(0, size.Y/2), dst.RGBAAt(size.X-1, size.Y/2)
+			if left.R > 8 || right.R < 247 || left.A != 255 || right.A != 255 {
+				t.Errorf("%s: Resize to %v: edges %v and %v", filter, size, left, right)
+			}
+		}
+	}
+
+	if dst := Resize(src, 64, 32, FilterLanczos); dst != src {
+		t.Errorf("Resize to the same size did not return the source")
+	}
+	if dst := Resize(src, 0, 10, FilterLanczos); !dst.Bounds().Empty() {
+		t.Errorf("Resize to zero width gives %v", dst.Bounds())
+	}
+}
+
+func TestFitCover(t *testing.T) {
+	// A wide image whose middle third is white: cover to a square keeps
+	// only the middle
+	src := image.NewRGBA(image.Rect(0, 0, 90, 30))
+	draw.Draw(src, image.Rect(30, 0, 60, 30), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	dst := Fit(src, 10, 10, FitCover, FilterNearest)
+	if dst.Bounds().Dx() != 10 || dst.Bounds().Dy() != 10 {
+		t.Fatalf("Fit cover gives %v", dst.Bounds().Size())
+	}
+	for _, x := range []int{0, 9} {
+		if c := dst.RGBAAt(x, 5); c.R != 255 {
+			t.Errorf("pixel %d of the cropped image = %v, want white", x, c)
+		}
+	}
+}
+
+func TestParseFilterAndFitMode(t *testing.T) {
+	filters := map[string]Filter{
+		"":            FilterLanczos,
+		"Nearest":     FilterNearest,
+		"bilinear":    FilterBilinear,
+		"catmull-rom": FilterCatmullRom,
+		"bicubic":     FilterCatmullRom,
+		"lanczos":     FilterLanczos,
+	}
+	for name, want := range filters {
+		if got, err := ParseFilter(name); err != nil || got != want {
+			t.Errorf("ParseFilter(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFilter("box"); err == nil {
+		t.Errorf("ParseFilter(box) succeeded")
+	}
+
+	modes := map[string]FitMode{"": FitInside, "COVER": FitCover, "contain": FitContain, "fill": FitFill, "inside": FitInside}
+	for name, want := range modes {
+		if got, err := ParseFitMode(name); err != nil || got != want {
+			t.Errorf("ParseFitMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseFitMode("stretch"); err == nil {
+		t.Errorf("ParseFitMode(stretch) succeeded")
+	}
+}
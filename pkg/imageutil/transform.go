@@ -0,0 +1,218 @@
+package imageutil
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/gantoho/go-img-sys/pkg/imagemeta"
+)
+
+// TransformOptions 图片变换参数
+type TransformOptions struct {
+	Width   int     // 目标宽度，0 表示按宽高比推算
+	Height  int     // 目标高度，0 表示按宽高比推算
+	Fit     FitMode // 适配模式
+	Filter  Filter  // 重采样滤波器
+	Quality int     // 输出质量（仅JPEG），0 使用默认值
+	Format  string  // 输出格式 jpeg/png/gif，空表示保持原格式
+	Rotate  int     // 顺时针旋转角度，0/90/180/270
+	Blur    float64 // 高斯模糊 sigma，0 表示不模糊
+}
+
+// IsZero 是否没有任何变换
+func (o TransformOptions) IsZero() bool {
+	return o == TransformOptions{}
+}
+
+// Key 返回参数的规范化字符串，相同效果的参数得到相同的 Key，可用作缓存键
+func (o TransformOptions) Key() string {
+	fit, filter := o.Fit, o.Filter
+	if fit == "" {
+		fit = FitInside
+	}
+	if filter == "" {
+		filter = FilterLanczos
+	}
+	return fmt.Sprintf("w=%d,h=%d,fit=%s,filter=%s,q=%d,fmt=%s,rotate=%d,blur=%s",
+		o.Width, o.Height, fit, filter, o.Quality, o.Format, normalizeDegrees(o.Rotate),
+		strconv.FormatFloat(o.Blur, 'f', -1, 64))
+}
+
+// Transform 按参数依次执行旋转、缩放和模糊
+func Transform(img image.Image, opts TransformOptions) image.Image {
+	if deg := normalizeDegrees(opts.Rotate); deg != 0 {
+		img = Rotate(img, deg)
+	}
+
+	if opts.Width > 0 || opts.Height > 0 {
+		fit := opts.Fit
+		if fit == "" {
+			fit = FitInside
+		}
+		img = Fit(img, opts.Width, opts.Height, fit, opts.Filter)
+	}
+
+	if opts.Blur > 0 {
+		img = Blur(img, opts.Blur)
+	}
+
+	return img
+}
+
+// ParseFormat 解析输出格式名称，返回规范名称（jpeg/png/gif）
+func ParseFormat(name string) (string, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return "", nil
+	case "jpg", "jpeg":
+		return "jpeg", nil
+	case "png":
+		return "png", nil
+	case "gif":
+		return "gif", nil
+	default:
+		return "", fmt.Errorf("unsupported output format: %s", name)
+	}
+}
+
+// FormatExtension 返回格式对应的文件扩展名
+func FormatExtension(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// exifHeaderSize 读取 EXIF 方向时预读的字节数，足以容纳 JFIF 与 EXIF 段
+const exifHeaderSize = 128 * 1024
+
+// Decode 解码图片，仅支持可重新编码的格式（jpeg/png/gif）。
+// JPEG 按 EXIF 方向摆正，因此重新编码的图片总是正向的。
+func Decode(r io.Reader) (image.Image, string, error) {
+	br := bufio.NewReaderSize(r, exifHeaderSize)
+	header, _ := br.Peek(exifHeaderSize)
+	orientation := imagemeta.Orientation(header)
+
+	img, format, err := image.Decode(br)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch format {
+	case "jpeg":
+		if orientation > 1 {
+			img = Orient(img, OrientationFromEXIF(orientation))
+		}
+		return img, format, nil
+	case "png", "gif":
+		return img, format, nil
+	default:
+		return nil, "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// Encode 按格式编码图片
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	if quality <= 0 || quality > 100 {
+		quality = 90
+	}
+
+	switch strings.ToLower(format) {
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case "png":
+		return png.Encode(w, img)
+	case "gif":
+		return gif.Encode(w, img, nil)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// Blur 高斯模糊，sigma 越大越模糊
+func Blur(img image.Image, sigma float64) *image.RGBA {
+	src := toRGBA(img)
+	if sigma <= 0 {
+		return src
+	}
+
+	radius := int(math.Ceil(sigma * 3))
+	kernel := make([]float64, radius*2+1)
+	var sum float64
+	for i := range kernel {
+		x := float64(i - radius)
+		kernel[i] = math.Exp(-x * x / (2 * sigma * sigma))
+		sum += kernel[i]
+	}
+	for i := range kernel {
+		kernel[i] /= sum
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	tmp := make([]float64, w*h*4)
+
+	// 水平方向
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c [4]float64
+			for k, weight := range kernel {
+				sx := clampInt(x+k-radius, 0, w-1)
+				s := y*src.Stride + sx*4
+				for i := 0; i < 4; i++ {
+					c[i] += float64(src.Pix[s+i]) * weight
+				}
+			}
+			copy(tmp[(y*w+x)*4:], c[:])
+		}
+	}
+
+	// 垂直方向
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var c [4]float64
+			for k, weight := range kernel {
+				sy := clampInt(y+k-radius, 0, h-1)
+				o := (sy*w + x) * 4
+				for i := 0; i < 4; i++ {
+					c[i] += tmp[o+i] * weight
+				}
+			}
+			d := y*dst.Stride + x*4
+			alpha := clampUint8(c[3])
+			for i := 0; i < 3; i++ {
+				dst.Pix[d+i] = minUint8(clampUint8(c[i]), alpha)
+			}
+			dst.Pix[d+3] = alpha
+		}
+	}
+
+	return dst
+}
+
+// normalizeDegrees 将角度规范到 [0, 360)
+func normalizeDegrees(degrees int) int {
+	degrees %= 360
+	if degrees < 0 {
+		degrees += 360
+	}
+	return degrees
+}
+
+func clampInt(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
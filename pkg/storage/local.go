@@ -0,0 +1,251 @@
+package storage
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LocalStorage stores objects as plain files below a root directory
+type LocalStorage struct {
+	root string
+}
+
+// NewLocalStorage creates a filesystem backed storage rooted at dir
+func NewLocalStorage(dir string) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{root: dir}, nil
+}
+
+// Root returns the root directory of the storage
+func (s *LocalStorage) Root() string {
+	return s.root
+}
+
+// Path returns the filesystem path of name
+func (s *LocalStorage) Path(name string) (string, error) {
+	cleaned, err := CleanName(name)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(s.root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put writes r to a temporary file and renames it into place, so readers
+// never observe a partially written object
+func (s *LocalStorage) Put(name string, r io.Reader) (*FileInfo, error) {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(fullPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	tmpName := tmp.Name()
+
+	// CreateTemp uses 0600, stored files get the usual permissions
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return nil, err
+	}
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+	if err := os.Rename(tmpName, fullPath); err != nil {
+		os.Remove(tmpName)
+		return nil, err
+	}
+
+	return s.Stat(name)
+}
+
+// Get opens name for streaming
+func (s *LocalStorage) Get(name string) (io.ReadCloser, error) {
+	return s.Open(name)
+}
+
+// Open opens name for reading and seeking
+func (s *LocalStorage) Open(name string) (io.ReadSeekCloser, error) {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, ErrNotExist
+	}
+
+	return os.Open(fullPath)
+}
+
+// Stat returns information about name
+func (s *LocalStorage) Stat(name string) (*FileInfo, error) {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cleaned, _ := CleanName(name)
+	return &FileInfo{
+		Name:    cleaned,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}, nil
+}
+
+// List returns the entries below prefix sorted by name
+func (s *LocalStorage) List(prefix string, recursive bool) ([]FileInfo, error) {
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := s.root
+	if prefix != "" {
+		dir = filepath.Join(s.root, filepath.FromSlash(prefix))
+	}
+
+	result := make([]FileInfo, 0)
+
+	if !recursive {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			result = append(result, FileInfo{
+				Name:    joinName(prefix, entry.Name()),
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+				IsDir:   entry.IsDir(),
+			})
+		}
+		return result, nil
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == dir {
+				return err
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return nil
+		}
+
+		result = append(result, FileInfo{
+			Name:    filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Delete removes a file or an empty directory
+func (s *LocalStorage) Delete(name string) error {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fullPath)
+}
+
+// Rename moves a file with os.Rename, which replaces to atomically
+func (s *LocalStorage) Rename(from, to string) error {
+	fromPath, err := s.Path(from)
+	if err != nil {
+		return err
+	}
+	toPath, err := s.Path(to)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(fromPath)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return ErrNotExist
+	}
+
+	if err := os.MkdirAll(filepath.Dir(toPath), 0755); err != nil {
+		return err
+	}
+	return os.Rename(fromPath, toPath)
+}
+
+// Reserve creates an empty file with O_EXCL, which fails when name exists
+func (s *LocalStorage) Reserve(name string) error {
+	fullPath, err := s.Path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// joinName joins a cleaned prefix and a child name
+func joinName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
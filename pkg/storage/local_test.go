@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStorage(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+	testStorage(t, s)
+}
+
+func TestLocalStorageLayout(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewLocalStorage(root)
+	if err != nil {
+		t.Fatalf("NewLocalStorage: %v", err)
+	}
+
+	mustPut(t, s, "dir/sub/a.jpg", "a")
+
+	// Objects are plain files below the root, without temporary leftovers
+	data, err := os.ReadFile(filepath.Join(root, "dir", "sub", "a.jpg"))
+	if err != nil || string(data) != "a" {
+		t.Fatalf("file content = %q, %v", data, err)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "dir", "sub"))
+	if err != nil || len(entries) != 1 {
+		t.Errorf("directory holds %d entries, %v; want only the object", len(entries), err)
+	}
+
+	path, err := s.Path("dir/sub/a.jpg")
+	if err != nil || path != filepath.Join(root, "dir", "sub", "a.jpg") {
+		t.Errorf("Path = %q, %v", path, err)
+	}
+	if _, err := s.Path("../a.jpg"); err != ErrInvalidName {
+		t.Errorf("Path escaping the root: %v, want ErrInvalidName", err)
+	}
+}
@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memObject struct {
+	data    []byte
+	modTime time.Time
+}
+
+// MemoryStorage keeps all objects in memory. It is intended for tests and
+// ephemeral deployments; content is lost when the process exits.
+type MemoryStorage struct {
+	mu      sync.RWMutex
+	objects map[string]memObject
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		objects: make(map[string]memObject),
+	}
+}
+
+// Put stores the content of r under name
+func (s *MemoryStorage) Put(name string, r io.Reader) (*FileInfo, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := memObject{data: data, modTime: time.Now()}
+
+	s.mu.Lock()
+	s.objects[name] = obj
+	s.mu.Unlock()
+
+	return &FileInfo{Name: name, Size: int64(len(data)), ModTime: obj.modTime}, nil
+}
+
+// Get returns a stream over the content of name
+func (s *MemoryStorage) Get(name string) (io.ReadCloser, error) {
+	return s.Open(name)
+}
+
+// Open returns a seekable reader over the content of name
+func (s *MemoryStorage) Open(name string) (io.ReadSeekCloser, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	obj, ok := s.objects[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrNotExist
+	}
+
+	// Objects are replaced, never mutated, so sharing the slice is safe
+	return nopSeekCloser{bytes.NewReader(obj.data)}, nil
+}
+
+// Stat returns information about name. Prefixes of stored objects are
+// reported as directories.
+func (s *MemoryStorage) Stat(name string) (*FileInfo, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if obj, ok := s.objects[name]; ok {
+		return &FileInfo{Name: name, Size: int64(len(obj.data)), ModTime: obj.modTime}, nil
+	}
+
+	dirPrefix := name + "/"
+	for key := range s.objects {
+		if strings.HasPrefix(key, dirPrefix) {
+			return &FileInfo{Name: name, IsDir: true}, nil
+		}
+	}
+
+	return nil, ErrNotExist
+}
+
+// List returns the entries below prefix sorted by name
+func (s *MemoryStorage) List(prefix string, recursive bool) ([]FileInfo, error) {
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPrefix := ""
+	if prefix != "" {
+		keyPrefix = prefix + "/"
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make([]FileInfo, 0)
+	dirs := make(map[string]bool)
+
+	for key, obj := range s.objects {
+		if !strings.HasPrefix(key, keyPrefix) {
+			continue
+		}
+
+		rest := key[len(keyPrefix):]
+		if !recursive {
+			if idx := strings.Index(rest, "/"); idx >= 0 {
+				dirs[joinName(prefix, rest[:idx])] = true
+				continue
+			}
+		}
+
+		result = append(result, FileInfo{Name: key, Size: int64(len(obj.data)), ModTime: obj.modTime})
+	}
+
+	for dir := range dirs {
+		result = append(result, FileInfo{Name: dir, IsDir: true})
+	}
+
+	if len(result) == 0 && prefix != "" {
+		return nil, ErrNotExist
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Delete removes name
+func (s *MemoryStorage) Delete(name string) error {
+	name, err := CleanName(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[name]; !ok {
+		return ErrNotExist
+	}
+	delete(s.objects, name)
+	return nil
+}
+
+// Rename moves the object from to to
+func (s *MemoryStorage) Rename(from, to string) error {
+	from, err := CleanName(from)
+	if err != nil {
+		return err
+	}
+	to, err = CleanName(to)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[from]
+	if !ok {
+		return ErrNotExist
+	}
+	delete(s.objects, from)
+	s.objects[to] = obj
+	return nil
+}
+
+// Reserve stores an empty object at name unless an object or directory
+// with that name exists
+func (s *MemoryStorage) Reserve(name string) error {
+	name, err := CleanName(name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.objects[name]; ok {
+		return ErrExist
+	}
+	for key := range s.objects {
+		if strings.HasPrefix(key, name+"/") {
+			return ErrExist
+		}
+	}
+	s.objects[name] = memObject{modTime: time.Now()}
+	return nil
+}
+
+// nopSeekCloser adds a no-op Close to a bytes.Reader
+type nopSeekCloser struct {
+	*bytes.Reader
+}
+
+func (nopSeekCloser) Close() error { return nil }
@@ -0,0 +1,593 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// minPartSize is the smallest part size S3 accepts for multipart uploads
+	minPartSize = 5 * 1024 * 1024
+	// defaultPartSize is used when S3Config.PartSize is not set
+	defaultPartSize = 8 * 1024 * 1024
+)
+
+// S3Config configures an S3-compatible storage backend
+type S3Config struct {
+	Endpoint  string // e.g. "https://s3.amazonaws.com" or "http://127.0.0.1:9000"
+	Region    string // signing region, "us-east-1" if empty
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	Prefix    string // optional key prefix inside the bucket
+	PathStyle bool   // address objects as endpoint/bucket/key instead of bucket.endpoint/key
+	PartSize  int64  // multipart part size in bytes, objects larger than this are uploaded in parts
+	Client    *http.Client
+}
+
+// S3Storage stores objects in an S3-compatible bucket
+type S3Storage struct {
+	cfg      S3Config
+	endpoint *url.URL
+	signer   *s3Signer
+	client   *http.Client
+}
+
+// NewS3Storage creates an S3 backed storage
+func NewS3Storage(cfg S3Config) (*S3Storage, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3: endpoint and bucket are required")
+	}
+
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/")
+
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.PartSize <= 0 {
+		cfg.PartSize = defaultPartSize
+	}
+	if cfg.PartSize < minPartSize {
+		cfg.PartSize = minPartSize
+	}
+	cfg.Prefix = strings.Trim(cfg.Prefix, "/")
+	if cfg.Prefix != "" {
+		cfg.Prefix += "/"
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Minute}
+	}
+
+	return &S3Storage{
+		cfg:      cfg,
+		endpoint: endpoint,
+		signer: &s3Signer{
+			accessKey: cfg.AccessKey,
+			secretKey: cfg.SecretKey,
+			region:    cfg.Region,
+			service:   "s3",
+		},
+		client: client,
+	}, nil
+}
+
+// Put uploads r under name. Content up to PartSize is sent in a single
+// PUT, larger content uses a multipart upload.
+func (s *S3Storage) Put(name string, r io.Reader) (*FileInfo, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	key := s.cfg.Prefix + name
+
+	buf := make([]byte, s.cfg.PartSize)
+	n, err := io.ReadFull(r, buf)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		err = s.putObject(key, buf[:n])
+	case err == nil:
+		err = s.multipartUpload(key, buf, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Report the server side size and modification time
+	return s.Stat(name)
+}
+
+// putObject uploads data with a single PUT request
+func (s *S3Storage) putObject(key string, data []byte) error {
+	headers := http.Header{}
+	if ctype := mime.TypeByExtension(path.Ext(key)); ctype != "" {
+		headers.Set("Content-Type", ctype)
+	}
+
+	resp, err := s.do(http.MethodPut, key, nil, headers, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// multipartUpload uploads first followed by the rest of r in PartSize
+// chunks. The upload is aborted if any part fails.
+func (s *S3Storage) multipartUpload(key string, first []byte, r io.Reader) error {
+	headers := http.Header{}
+	if ctype := mime.TypeByExtension(path.Ext(key)); ctype != "" {
+		headers.Set("Content-Type", ctype)
+	}
+
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, headers, nil)
+	if err != nil {
+		return err
+	}
+	var initResult initiateMultipartUploadResult
+	err = xml.NewDecoder(resp.Body).Decode(&initResult)
+	resp.Body.Close()
+	if err != nil || initResult.UploadID == "" {
+		return fmt.Errorf("s3: invalid CreateMultipartUpload response: %v", err)
+	}
+	uploadID := initResult.UploadID
+
+	abort := func(cause error) error {
+		if resp, err := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil); err == nil {
+			resp.Body.Close()
+		}
+		return cause
+	}
+
+	var (
+		parts []completedPart
+		chunk = first
+	)
+
+	for partNumber := 1; ; partNumber++ {
+		query := url.Values{
+			"partNumber": {strconv.Itoa(partNumber)},
+			"uploadId":   {uploadID},
+		}
+		resp, err := s.do(http.MethodPut, key, query, nil, chunk)
+		if err != nil {
+			return abort(err)
+		}
+		resp.Body.Close()
+
+		parts = append(parts, completedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+
+		if len(chunk) < len(first) {
+			break
+		}
+
+		next := make([]byte, s.cfg.PartSize)
+		n, err := io.ReadFull(r, next)
+		if n == 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return abort(err)
+		}
+		chunk = next[:n]
+	}
+
+	body, err := xml.Marshal(completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return abort(err)
+	}
+
+	resp, err = s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return abort(err)
+	}
+	defer resp.Body.Close()
+
+	// S3 may report a failed completion with a 200 status and an Error body
+	respBody, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return abort(fmt.Errorf("s3: complete multipart upload failed: %s", respBody))
+	}
+
+	return nil
+}
+
+// Get streams the content of name
+func (s *S3Storage) Get(name string) (io.ReadCloser, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodGet, s.cfg.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Open returns a seekable reader that fetches content with range requests
+func (s *S3Storage) Open(name string) (io.ReadSeekCloser, error) {
+	info, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, ErrNotExist
+	}
+
+	return &s3Reader{storage: s, key: s.cfg.Prefix + info.Name, size: info.Size}, nil
+}
+
+// Stat returns information about name. Prefixes of stored objects are
+// reported as directories.
+func (s *S3Storage) Stat(name string) (*FileInfo, error) {
+	name, err := CleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodHead, s.cfg.Prefix+name, nil, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+		return &FileInfo{Name: name, Size: resp.ContentLength, ModTime: modTime}, nil
+	}
+	if !errors.Is(err, ErrNotExist) {
+		return nil, err
+	}
+
+	page, err := s.listPage(s.cfg.Prefix+name+"/", "", "", 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Contents) > 0 || len(page.CommonPrefixes) > 0 {
+		return &FileInfo{Name: name, IsDir: true}, nil
+	}
+	return nil, ErrNotExist
+}
+
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// listPage performs a single ListObjectsV2 request
+func (s *S3Storage) listPage(prefix, delimiter, token string, maxKeys int) (*listBucketResult, error) {
+	query := url.Values{
+		"list-type": {"2"},
+		"prefix":    {prefix},
+	}
+	if delimiter != "" {
+		query.Set("delimiter", delimiter)
+	}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+
+	resp, err := s.do(http.MethodGet, "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result listBucketResult
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("s3: invalid ListObjectsV2 response: %w", err)
+	}
+	return &result, nil
+}
+
+// List returns the objects below prefix, following continuation tokens
+// until the listing is complete
+func (s *S3Storage) List(prefix string, recursive bool) ([]FileInfo, error) {
+	prefix, err := cleanPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPrefix := s.cfg.Prefix
+	if prefix != "" {
+		keyPrefix += prefix + "/"
+	}
+
+	delimiter := "/"
+	if recursive {
+		delimiter = ""
+	}
+
+	result := make([]FileInfo, 0)
+	token := ""
+	for {
+		page, err := s.listPage(keyPrefix, delimiter, token, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range page.Contents {
+			// Zero-byte "folder/" marker objects are not files
+			if strings.HasSuffix(obj.Key, "/") {
+				continue
+			}
+			result = append(result, FileInfo{
+				Name:    strings.TrimPrefix(obj.Key, s.cfg.Prefix),
+				Size:    obj.Size,
+				ModTime: obj.LastModified,
+			})
+		}
+		for _, cp := range page.CommonPrefixes {
+			result = append(result, FileInfo{
+				Name:  strings.TrimSuffix(strings.TrimPrefix(cp.Prefix, s.cfg.Prefix), "/"),
+				IsDir: true,
+			})
+		}
+
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+
+	if len(result) == 0 && prefix != "" {
+		return nil, ErrNotExist
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Delete removes name. S3 deletes are idempotent, so existence is checked
+// first to report ErrNotExist like the other backends.
+func (s *S3Storage) Delete(name string) error {
+	name, err := CleanName(name)
+	if err != nil {
+		return err
+	}
+	key := s.cfg.Prefix + name
+
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Rename copies from to to on the server side and deletes from. S3 has no
+// rename, so a failure between both steps leaves the object under both names.
+func (s *S3Storage) Rename(from, to string) error {
+	from, err := CleanName(from)
+	if err != nil {
+		return err
+	}
+	to, err = CleanName(to)
+	if err != nil {
+		return err
+	}
+	fromKey := s.cfg.Prefix + from
+
+	source := s.cfg.Bucket + "/" + fromKey
+	segments := strings.Split(source, "/")
+	for i, seg := range segments {
+		segments[i] = awsURIEncode(seg)
+	}
+	headers := http.Header{}
+	headers.Set("X-Amz-Copy-Source", "/"+strings.Join(segments, "/"))
+
+	resp, err := s.do(http.MethodPut, s.cfg.Prefix+to, nil, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Like CompleteMultipartUpload, a copy may fail with a 200 status
+	respBody, _ := io.ReadAll(resp.Body)
+	if bytes.Contains(respBody, []byte("<Error>")) {
+		return fmt.Errorf("s3: copy %s failed: %s", from, respBody)
+	}
+
+	resp, err = s.do(http.MethodDelete, fromKey, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Reserve uploads an empty object with a conditional write (If-None-Match),
+// which the server refuses with 412 Precondition Failed when key exists.
+// Names of directories, which only exist as key prefixes, are checked first.
+func (s *S3Storage) Reserve(name string) error {
+	name, err := CleanName(name)
+	if err != nil {
+		return err
+	}
+
+	page, err := s.listPage(s.cfg.Prefix+name+"/", "", "", 1)
+	if err != nil {
+		return err
+	}
+	if len(page.Contents) > 0 {
+		return ErrExist
+	}
+
+	headers := http.Header{}
+	headers.Set("If-None-Match", "*")
+	resp, err := s.do(http.MethodPut, s.cfg.Prefix+name, nil, headers, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// objectURL builds the request URL for key ("" addresses the bucket)
+func (s *S3Storage) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+
+	objectPath := "/" + key
+	if s.cfg.PathStyle {
+		objectPath = "/" + s.cfg.Bucket + objectPath
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+
+	u.Path = s.endpoint.Path + objectPath
+	segments := strings.Split(u.Path, "/")
+	for i, seg := range segments {
+		segments[i] = awsURIEncode(seg)
+	}
+	u.RawPath = strings.Join(segments, "/")
+
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return &u
+}
+
+// do sends a signed request and converts error responses. 404 responses
+// are reported as ErrNotExist.
+func (s *S3Storage) do(method, key string, query url.Values, headers http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	payloadHash := emptyPayloadSHA
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	s.signer.sign(req, payloadHash, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		resp.Body.Close()
+		return nil, ErrExist
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3: %s %s: %s: %s", method, key, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return resp, nil
+}
+
+// s3Reader implements io.ReadSeekCloser on top of ranged GET requests
+type s3Reader struct {
+	storage *S3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	if r.body == nil {
+		headers := http.Header{}
+		headers.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		resp, err := r.storage.do(http.MethodGet, r.key, nil, headers, nil)
+		if err != nil {
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.offset + offset
+	case io.SeekEnd:
+		abs = r.size + offset
+	default:
+		return 0, errors.New("s3: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("s3: negative position")
+	}
+
+	if abs != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = abs
+	return abs, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body != nil {
+		return r.body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gantoho/go-img-sys/pkg/storage/s3test"
+)
+
+// newTestS3 returns an S3 storage backed by a fake S3 server
+func newTestS3(t *testing.T, prefix string) (*S3Storage, *s3test.Server) {
+	t.Helper()
+
+	server := s3test.NewServer("images")
+	t.Cleanup(server.Close)
+
+	s, err := NewS3Storage(S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "images",
+		AccessKey: "test",
+		SecretKey: "secret",
+		Prefix:    prefix,
+		PathStyle: true,
+		Client:    server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return s, server
+}
+
+func TestS3Storage(t *testing.T) {
+	s, _ := newTestS3(t, "")
+	testStorage(t, s)
+}
+
+func TestS3StoragePrefix(t *testing.T) {
+	s, server := newTestS3(t, "/library/")
+
+	mustPut(t, s, "dir/a.jpg", "a")
+	if got := strings.Join(server.Objects("images"), " "); got != "library/dir/a.jpg" {
+		t.Errorf("bucket holds %s, want the key below the prefix", got)
+	}
+
+	files, err := s.List("", true)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := names(files); got != "dir/a.jpg" {
+		t.Errorf("List = %s, want names without the prefix", got)
+	}
+}
+
+func TestS3StorageMultipartPut(t *testing.T) {
+	s, server := newTestS3(t, "")
+
+	// Two full parts and a short last one
+	data := make([]byte, 2*minPartSize+1234)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Put("big.jpg", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if info.Size != int64(len(data)) {
+		t.Errorf("Put reported size %d, want %d", info.Size, len(data))
+	}
+	if got := read(t, s, "big.jpg"); got != string(data) {
+		t.Error("content read back differs from the multipart upload")
+	}
+	if n := server.PendingUploads(); n != 0 {
+		t.Errorf("%d multipart uploads left pending", n)
+	}
+
+	// Content of exactly one part size also takes the multipart path
+	exact := data[:minPartSize]
+	if _, err := s.Put("exact.jpg", bytes.NewReader(exact)); err != nil {
+		t.Fatalf("Put of one part size: %v", err)
+	}
+	if got := read(t, s, "exact.jpg"); got != string(exact) {
+		t.Error("content read back differs for an upload of one part size")
+	}
+}
+
+func TestS3StorageMultipartAbort(t *testing.T) {
+	s, server := newTestS3(t, "")
+
+	r := io.MultiReader(bytes.NewReader(make([]byte, minPartSize)), errReader{io.ErrClosedPipe})
+	if _, err := s.Put("broken.jpg", r); err != io.ErrClosedPipe {
+		t.Fatalf("Put with failing reader: %v, want the read error", err)
+	}
+	if n := server.PendingUploads(); n != 0 {
+		t.Errorf("%d multipart uploads left pending after a failed Put", n)
+	}
+	if _, err := s.Stat("broken.jpg"); !IsNotExist(err) {
+		t.Errorf("Stat after failed Put: %v, want ErrNotExist", err)
+	}
+}
+
+func TestS3StorageListContinuation(t *testing.T) {
+	s, server := newTestS3(t, "")
+	server.MaxKeys = 2
+
+	var want []string
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d/e.jpg", "d/f.jpg", "g/h/i.jpg", "j.jpg"} {
+		mustPut(t, s, name, name)
+		want = append(want, name)
+	}
+
+	all, err := s.List("", true)
+	if err != nil {
+		t.Fatalf("List recursive: %v", err)
+	}
+	if got := names(all); got != strings.Join(want, " ") {
+		t.Errorf("List(\"\", true) over pages = %s", got)
+	}
+
+	direct, err := s.List("", false)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := names(direct); got != "a.jpg b.jpg c.jpg d/ g/ j.jpg" {
+		t.Errorf("List(\"\", false) over pages = %s", got)
+	}
+}
+
+func TestS3StorageRename(t *testing.T) {
+	s, server := newTestS3(t, "")
+
+	mustPut(t, s, "dir/a b+c.jpg", "content")
+	if err := s.Rename("dir/a b+c.jpg", "other/ä.jpg"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if got := strings.Join(server.Objects("images"), " "); got != "other/ä.jpg" {
+		t.Errorf("bucket holds %s after Rename", got)
+	}
+	if got := read(t, s, "other/ä.jpg"); got != "content" {
+		t.Errorf("renamed content = %q", got)
+	}
+}
+
+func TestS3StorageReserve(t *testing.T) {
+	s, server := newTestS3(t, "")
+
+	if err := s.Reserve("a.jpg"); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	// The conditional write is refused with 412 Precondition Failed
+	if err := s.Reserve("a.jpg"); err != ErrExist {
+		t.Errorf("second Reserve: %v, want ErrExist", err)
+	}
+	if got := strings.Join(server.Objects("images"), " "); got != "a.jpg" {
+		t.Errorf("bucket holds %s", got)
+	}
+}
+
+// errReader fails every read with err
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
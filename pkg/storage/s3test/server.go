@@ -0,0 +1,372 @@
+// Package s3test provides an in-process fake of the S3 API subset used by
+// storage.S3Storage, for tests and local development without MinIO.
+package s3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data    []byte
+	modTime time.Time
+	etag    string
+}
+
+type multipartUpload struct {
+	key   string
+	parts map[int][]byte
+}
+
+// Server is a path-style fake S3 endpoint holding buckets in memory.
+// Requests must carry an AWS4-HMAC-SHA256 Authorization header; signatures
+// themselves are not verified.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	buckets map[string]map[string]*object
+	uploads map[string]*multipartUpload
+	nextID  int
+	// MaxKeys limits ListObjectsV2 pages so continuation tokens get exercised
+	MaxKeys int
+}
+
+// NewServer starts a fake S3 server with the given buckets
+func NewServer(buckets ...string) *Server {
+	s := &Server{
+		buckets: make(map[string]map[string]*object),
+		uploads: make(map[string]*multipartUpload),
+		MaxKeys: 1000,
+	}
+	for _, bucket := range buckets {
+		s.buckets[bucket] = make(map[string]*object)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// Objects returns the keys stored in bucket, sorted
+func (s *Server) Objects(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]string, 0, len(s.buckets[bucket]))
+	for key := range s.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PendingUploads returns the number of multipart uploads not yet completed or aborted
+func (s *Server) PendingUploads() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.uploads)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		writeError(w, http.StatusForbidden, "AccessDenied", "missing signature")
+		return
+	}
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+
+	s.mu.Lock()
+	objects, ok := s.buckets[bucket]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", bucket)
+		return
+	}
+
+	query := r.URL.Query()
+
+	switch {
+	case key == "" && r.Method == http.MethodGet:
+		s.listObjects(w, r, objects)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		s.createUpload(w, bucket, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		s.uploadPart(w, r)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		s.completeUpload(w, r, objects, key)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		s.mu.Lock()
+		delete(s.uploads, query.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		s.copyObject(w, r, objects, key)
+	case r.Method == http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+			return
+		}
+		obj := newObject(data)
+		s.mu.Lock()
+		if _, exists := objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+			s.mu.Unlock()
+			writeError(w, http.StatusPreconditionFailed, "PreconditionFailed", key)
+			return
+		}
+		objects[key] = obj
+		s.mu.Unlock()
+		w.Header().Set("ETag", obj.etag)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.mu.Lock()
+		obj, ok := objects[key]
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+		w.Header().Set("ETag", obj.etag)
+		http.ServeContent(w, r, key, obj.modTime, bytes.NewReader(obj.data))
+	case r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", r.Method)
+	}
+}
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Prefix                string         `xml:"Prefix"`
+	KeyCount              int            `xml:"KeyCount"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Contents              []listContent  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+type listContent struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type copyResult struct {
+	XMLName      xml.Name  `xml:"CopyObjectResult"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) {
+	source, err := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "invalid copy source")
+		return
+	}
+	srcBucket, srcKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	src, ok := s.buckets[srcBucket][srcKey]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchKey", srcKey)
+		return
+	}
+	obj := newObject(bytes.Clone(src.data))
+	objects[key] = obj
+	writeXML(w, copyResult{LastModified: obj.modTime, ETag: obj.etag})
+}
+
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, objects map[string]*object) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+
+	maxKeys := s.MaxKeys
+	if v, err := strconv.Atoi(query.Get("max-keys")); err == nil && v > 0 && v < maxKeys {
+		maxKeys = v
+	}
+
+	// Entries are either object keys or common prefixes, merged in key order
+	s.mu.Lock()
+	entries := make([]string, 0)
+	seenPrefix := make(map[string]bool)
+	for key := range objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				cp := key[:len(prefix)+idx+len(delimiter)]
+				if !seenPrefix[cp] {
+					seenPrefix[cp] = true
+					entries = append(entries, cp)
+				}
+				continue
+			}
+		}
+		entries = append(entries, key)
+	}
+	sort.Strings(entries)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start = sort.SearchStrings(entries, token)
+	}
+
+	result := listResult{Prefix: prefix}
+	for i := start; i < len(entries); i++ {
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = entries[i]
+			break
+		}
+		entry := entries[i]
+		if seenPrefix[entry] {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: entry})
+		} else {
+			obj := objects[entry]
+			result.Contents = append(result.Contents, listContent{
+				Key:          entry,
+				Size:         int64(len(obj.data)),
+				LastModified: obj.modTime,
+				ETag:         obj.etag,
+			})
+		}
+		result.KeyCount++
+	}
+	s.mu.Unlock()
+
+	writeXML(w, result)
+}
+
+func (s *Server) createUpload(w http.ResponseWriter, bucket, key string) {
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[id] = &multipartUpload{key: bucket + "/" + key, parts: make(map[int][]byte)}
+	s.mu.Unlock()
+
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	partNumber, err := strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "partNumber")
+		return
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if ok {
+		upload.parts[partNumber] = data
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", query.Get("uploadId"))
+		return
+	}
+	w.Header().Set("ETag", etag(data))
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, objects map[string]*object, key string) {
+	var req struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+
+	id := r.URL.Query().Get("uploadId")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	upload, ok := s.uploads[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", id)
+		return
+	}
+
+	var buf bytes.Buffer
+	for i, part := range req.Parts {
+		data, ok := upload.parts[part.PartNumber]
+		if !ok || part.PartNumber != i+1 || part.ETag != etag(data) {
+			writeError(w, http.StatusBadRequest, "InvalidPart", strconv.Itoa(part.PartNumber))
+			return
+		}
+		buf.Write(data)
+	}
+
+	obj := newObject(buf.Bytes())
+	objects[key] = obj
+	delete(s.uploads, id)
+
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Key: key, ETag: obj.etag})
+}
+
+func newObject(data []byte) *object {
+	return &object{data: data, modTime: time.Now().UTC().Truncate(time.Second), etag: etag(data)}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	io.WriteString(w, xml.Header)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: message})
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// Common errors
+var (
+	// ErrNotExist is returned when the requested object does not exist.
+	// It wraps fs.ErrNotExist so os.IsNotExist / errors.Is keep working.
+	ErrNotExist = fs.ErrNotExist
+	// ErrExist is returned by Reserve when the object already exists.
+	// It wraps fs.ErrExist so os.IsExist / errors.Is keep working.
+	ErrExist = fs.ErrExist
+	// ErrInvalidName is returned for empty names or names escaping the storage root
+	ErrInvalidName = errors.New("storage: invalid object name")
+)
+
+// IsNotExist reports whether err means the object does not exist
+func IsNotExist(err error) bool {
+	return errors.Is(err, ErrNotExist)
+}
+
+// IsExist reports whether err means the object already exists
+func IsExist(err error) bool {
+	return errors.Is(err, ErrExist)
+}
+
+// FileInfo describes a stored object
+type FileInfo struct {
+	Name    string    // path relative to the storage root, always "/" separated
+	Size    int64     // size in bytes
+	ModTime time.Time // last modification time
+	IsDir   bool      // true for directories (only returned by non-recursive List)
+	// Deduplicated is set by Put of a deduplicating storage when identical
+	// content was already stored and is shared instead of written again
+	Deduplicated bool
+}
+
+// BaseName returns the last element of the object name
+func (fi FileInfo) BaseName() string {
+	return path.Base(fi.Name)
+}
+
+// Storage abstracts where image bytes are kept. Object names are relative,
+// "/" separated paths; implementations must reject names escaping the root.
+type Storage interface {
+	// Put stores the content of r under name, replacing any existing object
+	Put(name string, r io.Reader) (*FileInfo, error)
+	// Get returns a stream with the full content of name
+	Get(name string) (io.ReadCloser, error)
+	// Open returns a seekable handle, suitable for http.ServeContent
+	Open(name string) (io.ReadSeekCloser, error)
+	// Stat returns information about name without reading its content
+	Stat(name string) (*FileInfo, error)
+	// List returns the objects below prefix. When recursive is false only the
+	// direct children are returned, including sub directories (IsDir=true).
+	// When recursive is true only files are returned.
+	List(prefix string, recursive bool) ([]FileInfo, error)
+	// Delete removes name. Deleting a missing object returns ErrNotExist.
+	Delete(name string) error
+	// Rename moves the object from to to, replacing any existing object at
+	// to. Renaming a missing object returns ErrNotExist.
+	Rename(from, to string) error
+	// Reserve creates an empty object at name, or returns ErrExist when
+	// name is already taken. Checking and creating is atomic, so concurrent
+	// callers never reserve the same name; the reservation is then replaced
+	// with Put or Rename, or removed with Delete.
+	Reserve(name string) error
+}
+
+// CleanName normalizes an object name and rejects names that would escape
+// the storage root (absolute paths, ".." segments)
+func CleanName(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") {
+		return "", ErrInvalidName
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", ErrInvalidName
+		}
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." {
+		return "", ErrInvalidName
+	}
+	return cleaned, nil
+}
+
+// cleanPrefix normalizes a List prefix; the empty prefix means the root
+func cleanPrefix(prefix string) (string, error) {
+	prefix = strings.Trim(strings.ReplaceAll(prefix, "\\", "/"), "/")
+	if prefix == "" || prefix == "." {
+		return "", nil
+	}
+	return CleanName(prefix)
+}
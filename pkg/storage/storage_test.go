@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		invalid bool
+	}{
+		{name: "a.jpg", want: "a.jpg"},
+		{name: "dir/sub/a.jpg", want: "dir/sub/a.jpg"},
+		{name: `dir\a.jpg`, want: "dir/a.jpg"},
+		{name: "dir//./a.jpg", want: "dir/a.jpg"},
+		{name: "dir/", want: "dir"},
+		{name: "", invalid: true},
+		{name: ".", invalid: true},
+		{name: "/etc/passwd", invalid: true},
+		{name: "../a.jpg", invalid: true},
+		{name: "dir/../../a.jpg", invalid: true},
+		{name: "dir/../a.jpg", invalid: true},
+		{name: `..\a.jpg`, invalid: true},
+	}
+
+	for _, tt := range tests {
+		got, err := CleanName(tt.name)
+		if tt.invalid {
+			if err != ErrInvalidName {
+				t.Errorf("CleanName(%q) = %q, %v; want ErrInvalidName", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("CleanName(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+// testStorage checks the semantics every Storage implementation shares.
+// s must be empty.
+func testStorage(t *testing.T, s Storage) {
+	t.Run("PutGet", func(t *testing.T) {
+		info, err := s.Put("put/a.jpg", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if info.Name != "put/a.jpg" || info.Size != 5 {
+			t.Errorf("Put returned %+v", info)
+		}
+
+		if got := read(t, s, "put/a.jpg"); got != "hello" {
+			t.Errorf("Get = %q, want %q", got, "hello")
+		}
+		// Names are cleaned the same way on every call
+		if got := read(t, s, `put\./a.jpg`); got != "hello" {
+			t.Errorf("Get of uncleaned name = %q, want %q", got, "hello")
+		}
+
+		if _, err := s.Put("put/a.jpg", strings.NewReader("replaced")); err != nil {
+			t.Fatalf("Put over existing: %v", err)
+		}
+		if got := read(t, s, "put/a.jpg"); got != "replaced" {
+			t.Errorf("Get after overwrite = %q, want %q", got, "replaced")
+		}
+
+		if _, err := s.Get("put/missing.jpg"); !IsNotExist(err) {
+			t.Errorf("Get of missing object: %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("Open", func(t *testing.T) {
+		mustPut(t, s, "open/a.jpg", "0123456789")
+
+		f, err := s.Open("open/a.jpg")
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		defer f.Close()
+
+		if _, err := f.Seek(6, io.SeekStart); err != nil {
+			t.Fatalf("Seek: %v", err)
+		}
+		data, err := io.ReadAll(f)
+		if err != nil || string(data) != "6789" {
+			t.Errorf("read after Seek = %q, %v; want %q", data, err, "6789")
+		}
+
+		if _, err := s.Open("open"); !IsNotExist(err) {
+			t.Errorf("Open of a directory: %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		mustPut(t, s, "stat/dir/a.jpg", "abc")
+
+		info, err := s.Stat("stat/dir/a.jpg")
+		if err != nil {
+			t.Fatalf("Stat: %v", err)
+		}
+		if info.Name != "stat/dir/a.jpg" || info.Size != 3 || info.IsDir {
+			t.Errorf("Stat of file = %+v", info)
+		}
+
+		info, err = s.Stat("stat/dir")
+		if err != nil {
+			t.Fatalf("Stat of directory: %v", err)
+		}
+		if !info.IsDir {
+			t.Errorf("Stat of directory = %+v, want IsDir", info)
+		}
+
+		if _, err := s.Stat("stat/missing"); !IsNotExist(err) {
+			t.Errorf("Stat of missing object: %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		mustPut(t, s, "list/a.jpg", "a")
+		mustPut(t, s, "list/b/c.jpg", "c")
+		mustPut(t, s, "list/b/d/e.jpg", "e")
+
+		direct, err := s.List("list", false)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if got := names(direct); got != "list/a.jpg list/b/" {
+			t.Errorf("List(list, false) = %s", got)
+		}
+
+		all, err := s.List("list/", true)
+		if err != nil {
+			t.Fatalf("List recursive: %v", err)
+		}
+		if got := names(all); got != "list/a.jpg list/b/c.jpg list/b/d/e.jpg" {
+			t.Errorf("List(list/, true) = %s", got)
+		}
+
+		if _, err := s.List("list/missing", false); !IsNotExist(err) {
+			t.Errorf("List of missing prefix: %v, want ErrNotExist", err)
+		}
+		if _, err := s.List("../list", true); err != ErrInvalidName {
+			t.Errorf("List escaping the root: %v, want ErrInvalidName", err)
+		}
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		mustPut(t, s, "rename/a.jpg", "a")
+		mustPut(t, s, "rename/b.jpg", "b")
+
+		if err := s.Rename("rename/a.jpg", "rename/new/dir/a.jpg"); err != nil {
+			t.Fatalf("Rename into new directory: %v", err)
+		}
+		if _, err := s.Stat("rename/a.jpg"); !IsNotExist(err) {
+			t.Errorf("source still exists after Rename: %v", err)
+		}
+		if got := read(t, s, "rename/new/dir/a.jpg"); got != "a" {
+			t.Errorf("renamed content = %q, want %q", got, "a")
+		}
+
+		if err := s.Rename("rename/new/dir/a.jpg", "rename/b.jpg"); err != nil {
+			t.Fatalf("Rename over existing object: %v", err)
+		}
+		if got := read(t, s, "rename/b.jpg"); got != "a" {
+			t.Errorf("replaced content = %q, want %q", got, "a")
+		}
+
+		if err := s.Rename("rename/missing.jpg", "rename/c.jpg"); !IsNotExist(err) {
+			t.Errorf("Rename of missing object: %v, want ErrNotExist", err)
+		}
+		if err := s.Rename("rename/b.jpg", "../b.jpg"); err != ErrInvalidName {
+			t.Errorf("Rename escaping the root: %v, want ErrInvalidName", err)
+		}
+	})
+
+	t.Run("Reserve", func(t *testing.T) {
+		if err := s.Reserve("reserve/a.jpg"); err != nil {
+			t.Fatalf("Reserve: %v", err)
+		}
+		info, err := s.Stat("reserve/a.jpg")
+		if err != nil || info.Size != 0 {
+			t.Errorf("Stat of reservation = %+v, %v; want empty object", info, err)
+		}
+
+		if err := s.Reserve("reserve/a.jpg"); !IsExist(err) {
+			t.Errorf("Reserve of reserved name: %v, want ErrExist", err)
+		}
+		mustPut(t, s, "reserve/b.jpg", "b")
+		if err := s.Reserve("reserve/b.jpg"); !IsExist(err) {
+			t.Errorf("Reserve of existing object: %v, want ErrExist", err)
+		}
+		if got := read(t, s, "reserve/b.jpg"); got != "b" {
+			t.Errorf("Reserve changed existing content to %q", got)
+		}
+		mustPut(t, s, "reserve/dir/c.jpg", "c")
+		if err := s.Reserve("reserve/dir"); !IsExist(err) {
+			t.Errorf("Reserve of directory: %v, want ErrExist", err)
+		}
+
+		// The reservation is replaced by Put
+		mustPut(t, s, "reserve/a.jpg", "content")
+		if got := read(t, s, "reserve/a.jpg"); got != "content" {
+			t.Errorf("content after Put over reservation = %q", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mustPut(t, s, "delete/a.jpg", "a")
+
+		if err := s.Delete("delete/a.jpg"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := s.Get("delete/a.jpg"); !IsNotExist(err) {
+			t.Errorf("Get after Delete: %v, want ErrNotExist", err)
+		}
+		if err := s.Delete("delete/a.jpg"); !IsNotExist(err) {
+			t.Errorf("Delete of missing object: %v, want ErrNotExist", err)
+		}
+	})
+
+	t.Run("Traversal", func(t *testing.T) {
+		for _, name := range []string{"../escape.jpg", "a/../../escape.jpg", "/abs.jpg", ""} {
+			if _, err := s.Put(name, strings.NewReader("x")); err != ErrInvalidName {
+				t.Errorf("Put(%q): %v, want ErrInvalidName", name, err)
+			}
+			if _, err := s.Get(name); err != ErrInvalidName {
+				t.Errorf("Get(%q): %v, want ErrInvalidName", name, err)
+			}
+			if err := s.Reserve(name); err != ErrInvalidName {
+				t.Errorf("Reserve(%q): %v, want ErrInvalidName", name, err)
+			}
+			if err := s.Delete(name); err != ErrInvalidName {
+				t.Errorf("Delete(%q): %v, want ErrInvalidName", name, err)
+			}
+		}
+	})
+}
+
+// mustPut stores content under name or fails the test
+func mustPut(t *testing.T, s Storage, name, content string) {
+	t.Helper()
+	if _, err := s.Put(name, strings.NewReader(content)); err != nil {
+		t.Fatalf("Put(%q): %v", name, err)
+	}
+}
+
+// read returns the content of name or fails the test
+func read(t *testing.T, s Storage, name string) string {
+	t.Helper()
+	r, err := s.Get(name)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", name, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading %q: %v", name, err)
+	}
+	return string(data)
+}
+
+// names joins the names of entries, marking directories with a trailing "/"
+func names(entries []FileInfo) string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir {
+			result = append(result, e.Name+"/")
+		} else {
+			result = append(result, e.Name)
+		}
+	}
+	return strings.Join(result, " ")
+}